@@ -0,0 +1,129 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gerrors contains typed errors returned by Gloomy
+// packages allowing library users (and the HTTP service)
+// to distinguish between different kinds of failures.
+package gerrors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CorpusNotFoundError is returned in case a requested
+// corpus (= index directory) does not exist
+type CorpusNotFoundError struct {
+	CorpusID string
+}
+
+func (e *CorpusNotFoundError) Error() string {
+	return fmt.Sprintf("Corpus %s not found", e.CorpusID)
+}
+
+// IndexNotFoundError is returned in case a directory
+// does not contain any index files
+type IndexNotFoundError struct {
+	Path string
+}
+
+func (e *IndexNotFoundError) Error() string {
+	return fmt.Sprintf("No index found in %s", e.Path)
+}
+
+// CorruptDataError is returned in case an index file
+// (column, dictionary, manifest) is damaged or it has
+// an unexpected format
+type CorruptDataError struct {
+	Path   string
+	Reason string
+}
+
+func (e *CorruptDataError) Error() string {
+	return fmt.Sprintf("Corrupt data file %s: %s", e.Path, e.Reason)
+}
+
+// NewCorruptDataError creates a new CorruptDataError
+// with a formatted reason
+func NewCorruptDataError(path string, format string, args ...interface{}) *CorruptDataError {
+	return &CorruptDataError{Path: path, Reason: fmt.Sprintf(format, args...)}
+}
+
+// UnknownAttributeError is returned in case a requested
+// metadata attribute is not available
+type UnknownAttributeError struct {
+	Attr      string
+	Available []string
+}
+
+func (e *UnknownAttributeError) Error() string {
+	return fmt.Sprintf("Unknown attribute %s (available: %s)", e.Attr, strings.Join(e.Available, ", "))
+}
+
+// InvalidArgumentError is returned in case a user provided
+// argument (query type, offset, ...) is invalid
+type InvalidArgumentError struct {
+	Arg    string
+	Reason string
+}
+
+func (e *InvalidArgumentError) Error() string {
+	return fmt.Sprintf("Invalid argument %s: %s", e.Arg, e.Reason)
+}
+
+// BudgetExceededError is returned in case a query exceeds
+// a configured budget - its time limit ("time") or a maximum
+// number of result items ("results")
+type BudgetExceededError struct {
+	Budget string
+	Limit  string
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("Query exceeded %s budget (limit: %s), please narrow the query", e.Budget, e.Limit)
+}
+
+// ----------------------------------------------------------------------------
+
+// IsNotFound tests whether the error means that
+// a requested corpus (or its index) does not exist
+func IsNotFound(err error) bool {
+	var cnf *CorpusNotFoundError
+	var inf *IndexNotFoundError
+	return errors.As(err, &cnf) || errors.As(err, &inf)
+}
+
+// IsCorruptData tests whether the error is caused
+// by a damaged index file
+func IsCorruptData(err error) bool {
+	var cde *CorruptDataError
+	return errors.As(err, &cde)
+}
+
+// IsInvalidInput tests whether the error is caused
+// by an invalid user input (i.e. the same request
+// will always fail)
+func IsInvalidInput(err error) bool {
+	var uae *UnknownAttributeError
+	var iae *InvalidArgumentError
+	return errors.As(err, &uae) || errors.As(err, &iae)
+}
+
+// IsBudgetExceeded tests whether the error means that
+// a query has been stopped due to a configured budget
+func IsBudgetExceeded(err error) bool {
+	var bee *BudgetExceededError
+	return errors.As(err, &bee)
+}
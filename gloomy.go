@@ -15,14 +15,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/tomachalek/gloomy/index"
 	"github.com/tomachalek/gloomy/index/builder"
 	"github.com/tomachalek/gloomy/index/extras"
 	"github.com/tomachalek/gloomy/index/gconf"
@@ -34,12 +37,13 @@ const (
 	extractNgramsAction = "extract-ngrams"
 	searchServiceAction = "search-service"
 	searchAction        = "search"
+	verifyAction        = "verify"
 	appVersion          = "0.1.0"
 )
 
 func help(topic string) {
 	if topic == "" {
-		fmt.Print("Missing action to help with. Select one of the:\n\tcreate-index, extract-ngrams, search-service, search")
+		fmt.Print("Missing action to help with. Select one of the:\n\tcreate-index, extract-ngrams, search-service, search, verify")
 	}
 	fmt.Printf("HELP on [%s]:\n", topic)
 }
@@ -55,7 +59,9 @@ func createIndex(conf *gconf.IndexBuilderConf, ngramSize int) {
 	}
 	fmt.Println("Output directory: ", conf.OutDirectory)
 	t0 := time.Now()
-	builder.CreateGloomyIndex(conf, ngramSize)
+	if err := builder.CreateGloomyIndex(conf, ngramSize); err != nil {
+		log.Fatalf("Failed to create index: %s", err)
+	}
 	fmt.Printf("DONE in %s\n", time.Since(t0))
 }
 
@@ -70,7 +76,9 @@ func extractNgrams(conf *gconf.IndexBuilderConf, ngramSize int) {
 	}
 	fmt.Println("Output directory: ", conf.OutDirectory)
 	t0 := time.Now()
-	extras.ExtractUniqueNgrams(conf, ngramSize)
+	if err := extras.ExtractUniqueNgrams(conf, ngramSize); err != nil {
+		log.Fatalf("Failed to extract n-grams: %s", err)
+	}
 	fmt.Printf("DONE in %s\n", time.Since(t0))
 }
 
@@ -83,37 +91,122 @@ func loadSearchConf(confBasePath string) *gconf.SearchConf {
 		}
 		confBasePath = filepath.Join(confBasePath, "gloomy.json")
 	}
-	return gconf.LoadSearchConf(confBasePath)
+	conf, err := gconf.LoadSearchConf(confBasePath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %s", err)
+	}
+	return conf
+}
+
+func loadIndexBuilderConf(confPath string) *gconf.IndexBuilderConf {
+	conf, err := gconf.LoadIndexBuilderConf(confPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %s", err)
+	}
+	return conf
 }
 
-func searchCLI(confBasePath string, corpus string, query string, attrs []string, offset int, limit int, queryType int) {
+func searchCLI(confBasePath string, args service.SearchArgs) {
 	conf := loadSearchConf(confBasePath)
 	t1 := time.Now()
-	args := service.SearchArgs{
-		CorpusID:  corpus,
-		Phrase:    query,
-		QueryType: queryType,
-		Attrs:     attrs,
-		Offset:    offset,
-		Limit:     limit,
-	}
-	ans, err := service.Search(conf.DataPath, args)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ans, err := service.Search(ctx, conf, args)
 	if err != nil {
-		log.Printf("Srch error: %s", err)
+		log.Fatalf("Srch error: %s", err)
 	}
 	t2 := time.Since(t1)
 	for i := 0; ans.HasNext(); i++ {
 		v := ans.Next()
 		log.Printf("res[%d]: %s (count: %d, meta: %s)", i, v.Ngram, v.Count, v.Args)
+		if len(v.Distribution) > 1 {
+			for _, d := range v.Distribution {
+				log.Printf("\t%s: %d", d.Args, d.Count)
+			}
+		}
+	}
+	for _, g := range ans.Groups {
+		log.Printf("group %s: %d (n-grams: %d)", g.Args, g.Count, g.NumNgrams)
+	}
+	for _, attr := range args.Facets {
+		for _, f := range ans.Facets[attr] {
+			log.Printf("facet %s = %s: %d", attr, f.Value, f.Count)
+		}
+	}
+	if ans.NextCursor != "" {
+		log.Printf("Next page cursor: %s", ans.NextCursor)
 	}
 	log.Printf("Search time: %s", t2)
 }
 
+func countCLI(confBasePath string, args service.SearchArgs) {
+	conf := loadSearchConf(confBasePath)
+	t1 := time.Now()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ans, err := service.Count(ctx, conf, args)
+	if err != nil {
+		log.Fatalf("Count error: %s", err)
+	}
+	log.Printf("distinct n-grams: %d, total count: %d, min. count: %d, max. count: %d",
+		ans.NumNgrams, ans.TotalCount, ans.MinCount, ans.MaxCount)
+	log.Printf("Search time: %s", time.Since(t1))
+}
+
+func verifyIndex(dirPath string) bool {
+	report := index.VerifyIndex(dirPath)
+	fmt.Printf("Verifying index %s\n", report.DirPath)
+	for _, check := range report.Checks {
+		status := " OK "
+		if !check.Passed {
+			status = "FAIL"
+		}
+		if check.Message != "" {
+			fmt.Printf("[%s] %s: %s\n", status, check.Name, check.Message)
+
+		} else {
+			fmt.Printf("[%s] %s\n", status, check.Name)
+		}
+	}
+	if report.Passed() {
+		fmt.Printf("PASSED (%d checks)\n", len(report.Checks))
+
+	} else {
+		fmt.Printf("FAILED (%d of %d checks failed)\n", report.NumFailed(), len(report.Checks))
+	}
+	return report.Passed()
+}
+
 func startSearchService(confBasePath string) {
 	conf := loadSearchConf(confBasePath)
 	service.Serve(conf, appVersion)
 }
 
+// multiFlag is a command line flag which can be
+// specified multiple times
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ", ")
+}
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func parseFilters(values []string) []index.AttrConstraint {
+	ans := make([]index.AttrConstraint, len(values))
+	for i, v := range values {
+		var err error
+		ans[i], err = service.ParseAttrConstraint(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	return ans
+}
+
 func parseAttrs(attrStr string) []string {
 	if len(attrStr) == 0 {
 		return []string{}
@@ -125,11 +218,20 @@ func main() {
 	ngramSize := flag.Int("ngram-size", 2, "N-gram size, 2: bigram (default), ...")
 	srchConfPath := flag.String("conf-path", "", "Path to the gloomy.conf (by default, working dir is used")
 	metadataAttrs := flag.String("attrs", "", "Metadata attributes separated by comma")
+	groupByAttrs := flag.String("group-by", "", "Metadata attributes to group results by (separated by comma)")
+	facetAttrs := flag.String("facets", "", "Metadata attributes to calculate facets for (separated by comma)")
+	sortSpec := flag.String("sort", "", "Result order: count, ngram, pos:N, attr:NAME (prefix '-' = descending)")
+	minCount := flag.Int("min-count", 0, "Minimum n-gram count (0 = no limit)")
+	maxCount := flag.Int("max-count", 0, "Maximum n-gram count (0 = no limit)")
+	countOnly := flag.Bool("count", false, "Print only aggregated counts of matching n-grams")
+	cursor := flag.String("cursor", "", "Continuation token of a paged search (printed along with a previous page)")
+	var filters multiFlag
+	flag.Var(&filters, "filter", "Metadata constraint attr=value, attr=value1|value2 or attr~regexp (can be repeated)")
 	resultLimit := flag.Int("limit", -1, "Result limit")
 	resultOffset := flag.Int("offset", 0, "Result offset (starting from zero)")
-	queryType := flag.String("qtype", "default", "Query type (0 = default, 1 = regexp)")
+	queryType := flag.String("qtype", "default", "Query type (default, regexp, cql, ci)")
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Gloomy - an n-gram database >>>\n\nUsage:\n\t%s [options] [action] [config.json]\n\nAavailable actions:\n\tsearch, search-service, create-index, extract-ngrams\n\nOptions:\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Gloomy - an n-gram database >>>\n\nUsage:\n\t%s [options] [action] [config.json]\n\nAavailable actions:\n\tsearch, search-service, create-index, extract-ngrams, verify\n\nOptions:\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -143,11 +245,9 @@ func main() {
 		case "help":
 			help(flag.Arg(1))
 		case createIndexAction:
-			conf := gconf.LoadIndexBuilderConf(flag.Arg(1))
-			createIndex(conf, *ngramSize)
+			createIndex(loadIndexBuilderConf(flag.Arg(1)), *ngramSize)
 		case extractNgramsAction:
-			conf := gconf.LoadIndexBuilderConf(flag.Arg(1))
-			extractNgrams(conf, *ngramSize)
+			extractNgrams(loadIndexBuilderConf(flag.Arg(1)), *ngramSize)
 		case searchServiceAction:
 			startSearchService(*srchConfPath)
 		case searchAction:
@@ -158,8 +258,34 @@ func main() {
 			if qtype < 0 {
 				panic(fmt.Sprintf("Unknown query type: %s", *queryType))
 			}
-			searchCLI(*srchConfPath, flag.Arg(1), flag.Arg(2), parseAttrs(*metadataAttrs),
-				*resultOffset, *resultLimit, qtype)
+			args := service.SearchArgs{
+				CorpusID:  flag.Arg(1),
+				Phrase:    flag.Arg(2),
+				QueryType: qtype,
+				Attrs:     parseAttrs(*metadataAttrs),
+				Offset:    *resultOffset,
+				Limit:     *resultLimit,
+				GroupBy:   parseAttrs(*groupByAttrs),
+				Facets:    parseAttrs(*facetAttrs),
+				Filters:   parseFilters(filters),
+				Sort:      *sortSpec,
+				MinCount:  *minCount,
+				MaxCount:  *maxCount,
+				Cursor:    *cursor,
+			}
+			if *countOnly {
+				countCLI(*srchConfPath, args)
+
+			} else {
+				searchCLI(*srchConfPath, args)
+			}
+		case verifyAction:
+			if flag.Arg(1) == "" {
+				log.Fatal("Missing argument (index directory must be specified)")
+			}
+			if !verifyIndex(flag.Arg(1)) {
+				os.Exit(1)
+			}
 		default:
 			fmt.Printf("Unknown action %s\n", flag.Arg(0))
 			os.Exit(1)
@@ -0,0 +1,58 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+// ctxCheckInterval specifies how many leaves are visited
+// between two tests whether a search has been cancelled
+const ctxCheckInterval = 1024
+
+// ResultBudget limits a number of result items a query
+// may collect. The budget can be shared by concurrent
+// searches of the same query.
+type ResultBudget struct {
+	maxItems int64
+	used     int64
+}
+
+// NewResultBudget creates a budget allowing maxItems
+// result items (zero means no limit)
+func NewResultBudget(maxItems int) *ResultBudget {
+	return &ResultBudget{maxItems: int64(maxItems)}
+}
+
+// take consumes a single item of the budget. False is
+// returned in case the budget is exhausted. A nil budget
+// is never exhausted.
+func (rb *ResultBudget) take() bool {
+	if rb == nil || rb.maxItems == 0 {
+		return true
+	}
+	return atomic.AddInt64(&rb.used, 1) <= rb.maxItems
+}
+
+// Err returns an error in case the budget has been exceeded
+func (rb *ResultBudget) Err() error {
+	if rb != nil && rb.maxItems > 0 && atomic.LoadInt64(&rb.used) > rb.maxItems {
+		return &gerrors.BudgetExceededError{Budget: "results", Limit: fmt.Sprintf("%d items", rb.maxItems)}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func TestResultBudget(t *testing.T) {
+	b := NewResultBudget(2)
+	assert.True(t, b.take())
+	assert.True(t, b.take())
+	assert.Nil(t, b.Err())
+	assert.False(t, b.take())
+	assert.True(t, gerrors.IsBudgetExceeded(b.Err()))
+
+	var nilBudget *ResultBudget
+	assert.True(t, nilBudget.take())
+	assert.Nil(t, nilBudget.Err())
+	assert.True(t, NewResultBudget(0).take())
+}
+
+func TestSearchableIndexBudgetExceeded(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetResultBudget(NewResultBudget(2))
+	_, err = si.GetAllNgrams()
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+
+	si = OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetResultBudget(NewResultBudget(3))
+	res, err := si.GetAllNgrams()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res.Size())
+}
+
+func TestSearchableIndexCancelled(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	si := OpenSearchableIndex(ctx, idx, nil)
+	_, err = si.GetAllNgrams()
+	assert.Equal(t, context.Canceled, err)
+	_, err = si.CountAllNgrams()
+	assert.Equal(t, context.Canceled, err)
+	_, _, err = si.GetNgramsPage(si.AllRows(), nil, 10)
+	assert.Equal(t, context.Canceled, err)
+}
@@ -15,8 +15,11 @@
 package builder
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"log"
+	"os"
 
 	"github.com/tomachalek/gloomy/index"
 	"github.com/tomachalek/gloomy/index/builder/filter"
@@ -27,6 +30,8 @@ import (
 	"github.com/tomachalek/vertigo"
 )
 
+// NgramRecord represents a number of occurrences of an n-gram
+// with a specific combination of metadata attribute values
 type NgramRecord struct {
 	Ngram []string
 	Count int
@@ -45,6 +50,26 @@ type NgramList interface {
 	Add(ngram []string, metadata []column.AttrVal)
 }
 
+// ForEachNgramGroup calls fn for each distinct n-gram of the list
+// along with all its records (one per combination of metadata
+// attribute values) and their total count.
+func ForEachNgramGroup(ngramList NgramList, fn func(records []*NgramRecord, total int)) {
+	var group []*NgramRecord
+	total := 0
+	ngramList.ForEach(func(item *NgramRecord) {
+		if len(group) > 0 && ngramsCmp(group[0].Ngram, item.Ngram) != 0 {
+			fn(group, total)
+			group = nil
+			total = 0
+		}
+		group = append(group, item)
+		total += item.Count
+	})
+	if len(group) > 0 {
+		fn(group, total)
+	}
+}
+
 type NgramBuffer interface {
 	AddToken(token string)
 	GetValue() []string
@@ -78,6 +103,17 @@ type IndexBuilder struct {
 	tagBuffer NgramBuffer // this is optional
 
 	nindex *index.DynamicNgramIndex
+
+	rotatedIndices bool
+
+	numTokens int
+
+	// normalization is applied to all the words
+	normalization wdict.Normalization
+
+	// posAttrs collects n-grams of positional attribute tuples
+	// (nil in case no positional attributes are configured)
+	posAttrs *posAttrsBuilder
 }
 
 func (b *IndexBuilder) GetOutputFiles() *gconf.OutputFiles {
@@ -114,33 +150,52 @@ func (b *IndexBuilder) ProcStruct(vline *vertigo.Structure) {}
 
 func (b *IndexBuilder) ProcStructClose(vline *vertigo.StructureClose) {}
 
+// structMetadata encodes values of metadata attributes
+// of a token using dictionaries of an index
+func structMetadata(nindex *index.DynamicNgramIndex, vline *vertigo.Token) []column.AttrVal {
+	meta := make([]column.AttrVal, nindex.MetadataWriter().NumCols())
+	nindex.MetadataWriter().ForEachArg(
+		func(i int, ad *column.ArgsDictWriter, col column.AttrValColumn) {
+			if _, ok := vline.StructAttrs[ad.Name()]; ok {
+				idx := ad.AddValue(vline.StructAttrs[ad.Name()])
+				meta[i] = column.AttrVal(idx)
+			}
+		})
+	return meta
+}
+
 func (b *IndexBuilder) ProcToken(vline *vertigo.Token) {
 	if vline != nil {
-		wordLC := vline.WordLC()
-		if b.isStopWord(wordLC) {
+		b.numTokens++
+		word := b.normalization.Apply(vline.Word)
+		if b.isStopWord(word) {
 			b.buffer.Reset()
 			b.tagBuffer.Reset()
+			if b.posAttrs != nil {
+				b.posAttrs.reset()
+			}
 
-		} else if !b.isIgnoreWord(wordLC) {
-			b.buffer.AddToken(wordLC)
-			b.wordDict.AddToken(wordLC)
+		} else if !b.isIgnoreWord(word) {
+			b.buffer.AddToken(word)
+			b.wordDict.AddToken(word)
 			b.tagBuffer.AddToken(vline.Attrs[b.tagAttrIdx])
+			if b.posAttrs != nil {
+				b.posAttrs.addToken(word, vline)
+			}
 
 			if b.buffer.IsValid() && b.matchesFilter(b.buffer, b.tagBuffer) {
-				meta := make([]column.AttrVal, b.nindex.MetadataWriter().NumCols())
-				b.nindex.MetadataWriter().ForEachArg(
-					func(i int, ad *column.ArgsDictWriter, col column.AttrValColumn) {
-						if _, ok := vline.StructAttrs[ad.Name()]; ok {
-							idx := ad.AddValue(vline.StructAttrs[ad.Name()])
-							meta[i] = column.AttrVal(idx)
-						}
-					})
-				b.ngramList.Add(b.buffer.GetValue(), meta)
+				b.ngramList.Add(b.buffer.GetValue(), structMetadata(b.nindex, vline))
+				if b.posAttrs != nil {
+					b.posAttrs.addNgram(vline)
+				}
 			}
 		}
 
 	} else { // parser encoutered a structure
 		b.buffer.Reset()
+		if b.posAttrs != nil {
+			b.posAttrs.reset()
+		}
 	}
 }
 
@@ -155,18 +210,22 @@ func (b *IndexBuilder) CreateIndices() {
 	})
 }
 
-func CreateIndexBuilder(conf *gconf.IndexBuilderConf, ngramSize int) *IndexBuilder {
-	outputFiles := gconf.NewOutputFiles(conf, ngramSize, 0644, 0755)
+// CreateIndexBuilder creates a new IndexBuilder instance
+// based on provided configuration.
+func CreateIndexBuilder(conf *gconf.IndexBuilderConf, ngramSize int) (*IndexBuilder, error) {
+	outputFiles, err := gconf.NewOutputFiles(conf, ngramSize, 0644, 0755)
+	if err != nil {
+		return nil, err
+	}
 
-	var ngramList NgramList
-	if conf.ProcChunkSize == 0 {
-		ngramList = &RAMNgramList{}
+	ngramList, err := newNgramList(conf, conf.TmpDir)
+	if err != nil {
+		return nil, err
+	}
 
-	} else {
-		if conf.TmpDir == "" {
-			log.Panic("A 'tmpDir' must be configured in case procChunkSize > 0")
-		}
-		ngramList = NewLargeNgramList(conf.TmpDir, conf.ProcChunkSize)
+	customFilter, err := filter.LoadCustomFilter(conf.NgramFilter.Lib, conf.NgramFilter.Fn)
+	if err != nil {
+		return nil, err
 	}
 
 	var tagBuffer NgramBuffer
@@ -177,6 +236,14 @@ func CreateIndexBuilder(conf *gconf.IndexBuilderConf, ngramSize int) *IndexBuild
 		tagBuffer = &DummyNgramBuffer{}
 	}
 
+	var posAttrs *posAttrsBuilder
+	if len(conf.PosAttrs) > 0 {
+		posAttrs, err = newPosAttrsBuilder(conf, ngramSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &IndexBuilder{
 		outputFiles:  outputFiles,
 		ngramList:    ngramList,
@@ -187,54 +254,148 @@ func CreateIndexBuilder(conf *gconf.IndexBuilderConf, ngramSize int) *IndexBuild
 		tagBuffer:    tagBuffer,
 		stopWords:    conf.NgramStopStrings,
 		ignoreWords:  conf.NgramIgnoreStrings,
-		customFilter: filter.LoadCustomFilter(conf.NgramFilter.Lib, conf.NgramFilter.Fn),
+		customFilter: customFilter,
 		wordDict:     wdict.NewWordDictWriter(),
-		nindex:       index.NewDynamicNgramIndex(ngramSize, 10000, conf.Args), // TODO initial size
+		nindex:       newDynamicIndex(conf, ngramSize),
+
+		rotatedIndices: conf.RotatedIndices,
+		posAttrs:       posAttrs,
+		normalization:  conf.Normalization(),
+	}, nil
+}
+
+// newNgramList creates an n-gram list suitable for
+// the configured data size. In case the data are
+// processed in chunks, tmpDir is used to store them.
+func newNgramList(conf *gconf.IndexBuilderConf, tmpDir string) (NgramList, error) {
+	if conf.ProcChunkSize == 0 {
+		return &RAMNgramList{}, nil
+	}
+	if conf.TmpDir == "" {
+		return nil, fmt.Errorf("A 'tmpDir' must be configured in case procChunkSize > 0")
+	}
+	return NewLargeNgramList(tmpDir, conf.ProcChunkSize), nil
+}
+
+func newDynamicIndex(conf *gconf.IndexBuilderConf, ngramSize int) *index.DynamicNgramIndex {
+	ans := index.NewDynamicNgramIndex(ngramSize, 10000, conf.Args) // TODO initial size
+	if conf.CompressColumns {
+		ans.SetColumnFormat(column.VarintFormat)
 	}
+	return ans
 }
 
-func saveEncodedNgrams(builder *IndexBuilder, minFreq int) error {
-	builder.wordDict.Finalize(builder.GetOutputFiles().GetIndexDir())
-	builder.ngramList.ForEach(func(item *NgramRecord) {
-		if item.Count >= minFreq {
-			encodedNg := make([]int, len(item.Ngram))
-			for i, w := range item.Ngram {
-				encodedNg[i] = builder.wordDict.GetTokenIndex(w)
+// sourceChecksum calculates a SHA-256 checksum of a source file
+func sourceChecksum(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// encodeNgrams encodes collected n-grams using a finalized
+// dictionary and adds the ones with total count at least
+// minNgramFreq to an index
+func encodeNgrams(ngramList NgramList, dict *wdict.WordDictWriter, nindex *index.DynamicNgramIndex, minNgramFreq int) {
+	ForEachNgramGroup(ngramList, func(records []*NgramRecord, total int) {
+		if total >= minNgramFreq {
+			encodedNg := make([]int, len(records[0].Ngram))
+			for i, w := range records[0].Ngram {
+				encodedNg[i] = dict.GetTokenIndex(w)
+			}
+			for _, item := range records {
+				nindex.AddNgram(encodedNg, item.Count, item.Args)
 			}
-			builder.nindex.AddNgram(encodedNg, item.Count, item.Args)
 		}
 	})
-	builder.nindex.Finish()
-	log.Printf("Done: %s", builder.nindex.GetInfo())
-	builder.nindex.Save(builder.GetOutputFiles().GetIndexDir())
-	return nil
+	nindex.Finish()
+	log.Printf("Done: %s", nindex.GetInfo())
+}
+
+// saveIndex saves a finished index along with its rotations
+// (if requested). Rotated indices are saved before the main
+// index as the main index writes the manifest.
+func saveIndex(nindex *index.DynamicNgramIndex, dirPath string, rotations int, info *index.BuildInfo) error {
+	for i := 1; i < rotations; i++ {
+		rotIndex := nindex.CreateRotation(i)
+		log.Printf("Done rotation %d: %s", i, rotIndex.GetInfo())
+		if err := rotIndex.Save(dirPath); err != nil {
+			return err
+		}
+	}
+	nindex.SetBuildInfo(info)
+	return nindex.Save(dirPath)
+}
+
+// saveEncodedNgrams encodes collected n-grams using the word
+// dictionary and saves the index. The positional attributes
+// index (if any) is saved before the main index so the main
+// manifest is written as the last file.
+func saveEncodedNgrams(builder *IndexBuilder, conf *gconf.IndexBuilderConf) error {
+	dirPath := builder.GetOutputFiles().GetIndexDir()
+	builder.wordDict.Finalize(dirPath)
+	encodeNgrams(builder.ngramList, builder.wordDict, builder.nindex, conf.MinNgramFreq)
+	checksum, err := sourceChecksum(conf.InputFilePath)
+	if err != nil {
+		return err
+	}
+	info := index.BuildInfo{
+		NumTokens:      builder.numTokens,
+		NumWords:       builder.wordDict.Size(),
+		SourceChecksum: checksum,
+		Conf:           conf,
+		Normalization:  builder.normalization,
+	}
+	rotations := 1
+	if builder.rotatedIndices {
+		rotations = builder.ngramSize
+	}
+	if builder.posAttrs != nil {
+		info.PosAttrs = builder.posAttrs.names()
+		if err := builder.posAttrs.save(dirPath, conf, rotations, info); err != nil {
+			return err
+		}
+	}
+	return saveIndex(builder.nindex, dirPath, rotations, &info)
 }
 
 // CreateGloomyIndex is a high level function which based on
 // provided configuration creates an n-gram index.
-func CreateGloomyIndex(conf *gconf.IndexBuilderConf, ngramSize int) {
-	builder := CreateIndexBuilder(conf, ngramSize)
+func CreateGloomyIndex(conf *gconf.IndexBuilderConf, ngramSize int) error {
 	var procErr error
 
 	switch conf.SourceType {
-	case "vertical":
-		procErr = vertigo.ParseVerticalFile(conf.GetParserConf(), builder)
-	case "plain":
-		procErr = tokenizer.ParseFile(conf.GetParserConf(), builder)
+	case "vertical", "plain":
+	case "":
+		return fmt.Errorf("Data source type not specified. Use 'sourceType' in your config file.")
 	default:
-		if conf.SourceType != "" {
-			panic(fmt.Errorf("Unknown data source type: %s", conf.SourceType))
-
-		} else {
-			panic("Data source type not specified. Use 'sourceType' in your config file.")
-		}
-
+		return fmt.Errorf("Unknown data source type: %s", conf.SourceType)
 	}
-
-	if procErr == nil {
-		saveEncodedNgrams(builder, conf.MinNgramFreq)
+	if len(conf.PosAttrs) > 0 && conf.SourceType != "vertical" {
+		return fmt.Errorf("Positional attributes can be indexed only from a vertical file")
+	}
+	builder, err := CreateIndexBuilder(conf, ngramSize)
+	if err != nil {
+		return err
+	}
+	if conf.SourceType == "vertical" {
+		procErr = vertigo.ParseVerticalFile(conf.GetParserConf(), builder)
 
 	} else {
-		log.Panicf("Failed to process source with error: %s", procErr)
+		procErr = tokenizer.ParseFile(conf.GetParserConf(), builder)
 	}
+
+	if procErr != nil {
+		return fmt.Errorf("Failed to process source with error: %s", procErr)
+	}
+	if err := saveEncodedNgrams(builder, conf); err != nil {
+		return fmt.Errorf("Failed to save index with error: %s", err)
+	}
+	return nil
 }
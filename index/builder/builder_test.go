@@ -0,0 +1,55 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/wdict"
+	"github.com/tomachalek/vertigo"
+)
+
+func TestNormalizedWords(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	srcPath := filepath.Join(dirPath, "test.vert")
+	assert.Nil(t, ioutil.WriteFile(srcPath, []byte("test"), 0644))
+	conf := &gconf.IndexBuilderConf{
+		SourceType:           "vertical",
+		OutDirectory:         dirPath,
+		PreserveCase:         true,
+		UnicodeNormalization: "nfc",
+	}
+	conf.InputFilePath = srcPath
+	b, err := CreateIndexBuilder(conf, 2)
+	assert.Nil(t, err)
+	for _, w := range []string{"Praha", "praha", "\u017dluva", "Z\u030cluva"} {
+		b.ProcToken(&vertigo.Token{Word: w, Attrs: []string{""}})
+	}
+	assert.Equal(t, 3, b.wordDict.Size())
+	assert.True(t, b.wordDict.GetTokenIndex("\u017dluva") >= 0)
+	assert.Nil(t, saveEncodedNgrams(b, conf))
+
+	manifest, err := index.LoadManifest(filepath.Join(dirPath, "test"))
+	assert.Nil(t, err)
+	assert.Equal(t, wdict.Normalization{PreserveCase: true, UnicodeForm: wdict.NormNFC}, manifest.Normalization)
+}
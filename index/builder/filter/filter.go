@@ -52,25 +52,29 @@ func findPluginLib(pathSuff string) (string, error) {
 // In case libPath does not point to an existing file, the function
 // handles it as a path suffix and tries other locations (working
 // directory, /usr/local/lib/gloomy).
-func LoadCustomFilter(libPath string, fn string) CustomFilter {
+func LoadCustomFilter(libPath string, fn string) (CustomFilter, error) {
 	if libPath != "" && fn != "" {
 		fullPath, err := findPluginLib(libPath)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		p, err := plugin.Open(fullPath)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		f, err := p.Lookup(fn)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		filter, ok := f.(*CustomFilter)
+		if !ok {
+			return nil, fmt.Errorf("Function %s in %s is not a CustomFilter", fn, fullPath)
 		}
 		log.Printf("Using filter plug-in %s from %s", fn, fullPath)
-		return *f.(*CustomFilter)
+		return *filter, nil
 	}
 	log.Print("No custom filter plug-in defined")
 	return func(words []string, tags []string) bool {
 		return true
-	}
+	}, nil
 }
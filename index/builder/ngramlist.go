@@ -35,6 +35,29 @@ func ngramsCmp(n1 []string, n2 []string) int {
 	return 0
 }
 
+func metadataCmp(m1 []column.AttrVal, m2 []column.AttrVal) int {
+	for i := 0; i < len(m1) && i < len(m2); i++ {
+		if m1[i] > m2[i] {
+			return 1
+
+		} else if m1[i] < m2[i] {
+			return -1
+		}
+	}
+	return len(m1) - len(m2)
+}
+
+// recordsCmp compares two n-gram records first by their n-grams
+// and then by their metadata attribute values. This means that
+// records of the same n-gram with different metadata are
+// adjacent within a sorted list.
+func recordsCmp(n1 []string, m1 []column.AttrVal, n2 []string, m2 []column.AttrVal) int {
+	if ans := ngramsCmp(n1, n2); ans != 0 {
+		return ans
+	}
+	return metadataCmp(m1, m2)
+}
+
 type NgramNode struct {
 	left  *NgramNode
 	right *NgramNode
@@ -51,6 +74,9 @@ func (n *NgramNode) GetNgram() []string {
 	return n.ngram
 }
 
+// RAMNgramList is an in-memory sorted list of n-grams. Each
+// distinct combination of an n-gram and its metadata attribute
+// values is stored (and counted) as a separate record.
 type RAMNgramList struct {
 	root     *NgramNode
 	numNodes int
@@ -84,7 +110,7 @@ func (n *RAMNgramList) Add(ngram []string, metadata []column.AttrVal) {
 	} else {
 		item := n.root
 		for item != nil {
-			switch ngramsCmp(ngram, item.ngram) {
+			switch recordsCmp(ngram, metadata, item.ngram, item.args) {
 			case -1:
 				if item.left != nil {
 					item = item.left
@@ -104,8 +130,6 @@ func (n *RAMNgramList) Add(ngram []string, metadata []column.AttrVal) {
 					item = nil // stop the iteration
 				}
 			case 0:
-				// TODO here we have actually quite a problem as the
-				// 'metadata' of the incoming item is ignored
 				item.count++
 				item = nil // stop the iteration
 			}
@@ -140,32 +140,32 @@ func (nn *LargeNgramList) saveChunk() error {
 	return nil
 }
 
-func findFirstNonEmptyReader(readers []*chunkReader) *chunkReader {
-	for _, v := range readers {
+func findFirstNonEmptyReader(readers []*chunkReader) int {
+	for i, v := range readers {
 		if v.hasNext() {
-			return v
+			return i
 		}
 	}
-	return nil
+	return -1
 }
 
 func (nn *LargeNgramList) findSmallestNgram(readers []*chunkReader) *NgramRecord {
-	smallestIdx := 0
-	firstReader := findFirstNonEmptyReader(readers)
-	if firstReader == nil {
+	smallestIdx := findFirstNonEmptyReader(readers)
+	if smallestIdx == -1 {
 		return nil
 	}
-	smallestRec := firstReader.getCurrent()
-	for i := 1; i < len(readers); i++ {
+	smallestRec := readers[smallestIdx].getCurrent()
+	for i := smallestIdx + 1; i < len(readers); i++ {
 		if !readers[i].hasNext() {
 			continue
 		}
-		switch ngramsCmp(readers[i].getCurrent().Ngram, smallestRec.Ngram) {
+		curr := readers[i].getCurrent()
+		switch recordsCmp(curr.Ngram, curr.Args, smallestRec.Ngram, smallestRec.Args) {
 		case -1:
 			smallestIdx = i
-			smallestRec = readers[i].getCurrent()
+			smallestRec = curr
 		case 0:
-			smallestRec.Count += readers[i].getCurrent().Count
+			smallestRec.Count += curr.Count
 			if readers[i].hasNext() {
 				readers[i].readNext()
 			}
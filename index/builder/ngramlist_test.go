@@ -15,6 +15,8 @@
 package builder
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -71,3 +73,59 @@ func TestNgramListAddMulti(t *testing.T) {
 	assert.Equal(t, v3[0], n.root.right.ngram[0])
 	assert.Equal(t, v4[0], n.root.right.right.ngram[0])
 }
+
+func TestNgramListAddSameNgramDifferentMetadata(t *testing.T) {
+	n := RAMNgramList{}
+	v := []string{"foo", "bar"}
+	n.Add(v, []column.AttrVal{1})
+	n.Add(v, []column.AttrVal{0})
+	n.Add(v, []column.AttrVal{1})
+	assert.Equal(t, 2, n.Size())
+	records := make([]*NgramRecord, 0, 2)
+	n.ForEach(func(r *NgramRecord) {
+		records = append(records, r)
+	})
+	assert.Equal(t, []column.AttrVal{0}, records[0].Args)
+	assert.Equal(t, 1, records[0].Count)
+	assert.Equal(t, []column.AttrVal{1}, records[1].Args)
+	assert.Equal(t, 2, records[1].Count)
+}
+
+func TestForEachNgramGroup(t *testing.T) {
+	n := RAMNgramList{}
+	n.Add([]string{"foo", "bar"}, []column.AttrVal{1})
+	n.Add([]string{"boo", "bar"}, []column.AttrVal{0})
+	n.Add([]string{"foo", "bar"}, []column.AttrVal{0})
+	n.Add([]string{"foo", "bar"}, []column.AttrVal{1})
+	ngrams := make([]string, 0, 2)
+	totals := make([]int, 0, 2)
+	sizes := make([]int, 0, 2)
+	ForEachNgramGroup(&n, func(records []*NgramRecord, total int) {
+		ngrams = append(ngrams, records[0].Ngram[0])
+		totals = append(totals, total)
+		sizes = append(sizes, len(records))
+	})
+	assert.Equal(t, []string{"boo", "foo"}, ngrams)
+	assert.Equal(t, []int{1, 3}, totals)
+	assert.Equal(t, []int{1, 2}, sizes)
+}
+
+func TestLargeNgramListMergesMetadata(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(tmpDir)
+	n := NewLargeNgramList(tmpDir, 2)
+	v := []string{"foo", "bar"}
+	n.Add(v, []column.AttrVal{1})
+	n.Add(v, []column.AttrVal{0})
+	n.Add(v, []column.AttrVal{1})
+	n.Add(v, []column.AttrVal{2})
+	args := make([]column.AttrVal, 0, 3)
+	counts := make([]int, 0, 3)
+	n.ForEach(func(r *NgramRecord) {
+		args = append(args, r.Args[0])
+		counts = append(counts, r.Count)
+	})
+	assert.Equal(t, []column.AttrVal{0, 1, 2}, args)
+	assert.Equal(t, []int{1, 2, 1}, counts)
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/wdict"
+	"github.com/tomachalek/vertigo"
+)
+
+// posAttrsBuilder collects n-grams of positional attribute
+// tuples (word form, lemma, tag,...) for the positional
+// attributes index (see index.PosAttrsDirPath). Tuples are
+// encoded as single tokens so the index can be created the
+// same way as the main index of word forms.
+type posAttrsBuilder struct {
+	attrs []gconf.PosAttrConf
+
+	buffer NgramBuffer
+
+	ngramList NgramList
+
+	tupleDict *wdict.WordDictWriter
+
+	// attrDicts contains dictionaries of values
+	// of individual attributes (word forms excluded
+	// as they are stored in the main dictionary)
+	attrDicts []*wdict.WordDictWriter
+
+	nindex *index.DynamicNgramIndex
+}
+
+// names returns names of all the attributes
+// of a tuple (including word forms)
+func (p *posAttrsBuilder) names() []string {
+	ans := make([]string, len(p.attrs)+1)
+	ans[0] = index.WordPosAttr
+	for i, attr := range p.attrs {
+		ans[i+1] = attr.Name
+	}
+	return ans
+}
+
+func (p *posAttrsBuilder) reset() {
+	p.buffer.Reset()
+}
+
+// addToken adds a token with an already normalized word
+// (values of other attributes are not normalized)
+func (p *posAttrsBuilder) addToken(word string, vline *vertigo.Token) {
+	values := make([]string, len(p.attrs)+1)
+	values[0] = word
+	for i, attr := range p.attrs {
+		if attr.Idx < len(vline.Attrs) {
+			values[i+1] = vline.Attrs[attr.Idx]
+		}
+		p.attrDicts[i].AddToken(values[i+1])
+	}
+	tuple := index.JoinTuple(values)
+	p.buffer.AddToken(tuple)
+	p.tupleDict.AddToken(tuple)
+}
+
+// addNgram adds the current n-gram of tuples (it is expected
+// the respective n-gram of word forms has been accepted)
+func (p *posAttrsBuilder) addNgram(vline *vertigo.Token) {
+	p.ngramList.Add(p.buffer.GetValue(), structMetadata(p.nindex, vline))
+}
+
+// save saves dictionaries and the index of tuples
+// into a subdirectory of the main index directory
+func (p *posAttrsBuilder) save(dirPath string, conf *gconf.IndexBuilderConf, rotations int, info index.BuildInfo) error {
+	dirPath = index.PosAttrsDirPath(dirPath)
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return err
+	}
+	p.tupleDict.Finalize(dirPath)
+	for i, attr := range p.attrs {
+		p.attrDicts[i].FinalizeAs(dirPath, attr.Name)
+	}
+	encodeNgrams(p.ngramList, p.tupleDict, p.nindex, conf.MinNgramFreq)
+	info.NumWords = p.tupleDict.Size()
+	// only the main index refers to the positional attributes index
+	info.PosAttrs = nil
+	return saveIndex(p.nindex, dirPath, rotations, &info)
+}
+
+func newPosAttrsBuilder(conf *gconf.IndexBuilderConf, ngramSize int) (*posAttrsBuilder, error) {
+	ngramList, err := newNgramList(conf, filepath.Join(conf.TmpDir, "posattrs"))
+	if err != nil {
+		return nil, err
+	}
+	ans := &posAttrsBuilder{
+		attrs:     conf.PosAttrs,
+		buffer:    NewStdNgramBuffer(ngramSize),
+		ngramList: ngramList,
+		tupleDict: wdict.NewWordDictWriter(),
+		attrDicts: make([]*wdict.WordDictWriter, len(conf.PosAttrs)),
+		nindex:    newDynamicIndex(conf, ngramSize),
+	}
+	for i := range ans.attrDicts {
+		ans.attrDicts[i] = wdict.NewWordDictWriter()
+	}
+	return ans, nil
+}
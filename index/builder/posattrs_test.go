@@ -0,0 +1,112 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/wdict"
+	"github.com/tomachalek/vertigo"
+)
+
+func buildTestingPosAttrsIndex(t *testing.T, dirPath string) string {
+	srcPath := filepath.Join(dirPath, "test.vert")
+	assert.Nil(t, ioutil.WriteFile(srcPath, []byte("test"), 0644))
+	conf := &gconf.IndexBuilderConf{
+		SourceType:     "vertical",
+		OutDirectory:   dirPath,
+		Args:           map[string]string{"doc.genre": "col8"},
+		PosAttrs:       []gconf.PosAttrConf{{Name: "lemma", Idx: 0}, {Name: "tag", Idx: 1}},
+		RotatedIndices: true,
+	}
+	conf.InputFilePath = srcPath
+	b, err := CreateIndexBuilder(conf, 2)
+	assert.Nil(t, err)
+	meta := map[string]string{"doc.genre": "news"}
+	for _, tok := range [][]string{
+		{"Dogs", "dog", "NNS"}, {"run", "run", "VBP"}, {"fast", "fast", "RB"},
+		{"the", "the", "DT"}, {"dog", "dog", "NN"}, {"runs", "run", "VBZ"},
+		{"a", "a", "DT"}, {"run", "run", "NN"},
+	} {
+		b.ProcToken(&vertigo.Token{Word: tok[0], Attrs: tok[1:], StructAttrs: meta})
+	}
+	assert.Nil(t, saveEncodedNgrams(b, conf))
+	return filepath.Join(dirPath, "test")
+}
+
+func TestPosAttrsIndex(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	idxPath := buildTestingPosAttrsIndex(t, dirPath)
+
+	manifest, err := index.LoadManifest(idxPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"word", "lemma", "tag"}, manifest.PosAttrs)
+	assert.Equal(t, 7, manifest.NumWords)
+	assert.Equal(t, 7, manifest.NumNgrams)
+
+	paPath := index.PosAttrsDirPath(idxPath)
+	paManifest, err := index.LoadManifest(paPath)
+	assert.Nil(t, err)
+	// "run/run/VBP" and "run/run/NN" are different tuples
+	assert.Equal(t, 8, paManifest.NumWords)
+	assert.Equal(t, 7, paManifest.NumNgrams)
+	assert.Equal(t, []int{0, 1}, paManifest.Rotations)
+	assert.Equal(t, []string{"doc.genre"}, paManifest.AttrNames())
+
+	tags, err := wdict.LoadNamedWordDict(paPath, "tag")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, tags.Size())
+	tuples, err := wdict.LoadWordDict(paPath)
+	assert.Nil(t, err)
+	assert.True(t, tuples.Find(index.JoinTuple([]string{"dogs", "dog", "NNS"})) >= 0)
+
+	report := index.VerifyIndex(idxPath)
+	assert.True(t, report.Passed())
+	found := false
+	for _, check := range report.Checks {
+		if check.Name == "posattrs/tag.dict" {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestPosAttrsStopWord(t *testing.T) {
+	conf := &gconf.IndexBuilderConf{
+		OutDirectory:     os.TempDir(),
+		PosAttrs:         []gconf.PosAttrConf{{Name: "tag", Idx: 0}},
+		NgramStopStrings: []string{"the"},
+	}
+	conf.InputFilePath = "gloomy-test.vert"
+	b, err := CreateIndexBuilder(conf, 2)
+	assert.Nil(t, err)
+	defer os.RemoveAll(b.GetOutputFiles().GetIndexDir())
+	for _, tok := range [][]string{{"a", "DT"}, {"dog", "NN"}, {"the", "DT"}, {"cat", "NN"}} {
+		b.ProcToken(&vertigo.Token{Word: tok[0], Attrs: tok[1:]})
+	}
+	assert.Equal(t, 1, b.ngramList.Size())
+	assert.Equal(t, 1, b.posAttrs.ngramList.Size())
+	b.posAttrs.ngramList.ForEach(func(n *NgramRecord) {
+		assert.Equal(t, []string{"a\tDT", "dog\tNN"}, n.Ngram)
+	})
+}
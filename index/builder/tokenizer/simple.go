@@ -81,12 +81,14 @@ func (st *simpleTokenizer) parseSource(source io.Reader, lproc vertigo.LineProce
 	return nil
 }
 
+// importString decodes a string from a specified charset
+// (words are normalized later by the index builder)
 func importString(s string, ch *charmap.Charmap) string {
 	if ch == nil { // we assume utf-8 here (default Gloomy encoding)
-		return strings.ToLower(s)
+		return s
 	}
 	ans, _, _ := transform.String(ch.NewDecoder(), s)
-	return strings.ToLower(ans)
+	return ans
 }
 
 func newSimpleTokenizer(charsetName string) (*simpleTokenizer, error) {
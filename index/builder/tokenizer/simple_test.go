@@ -64,7 +64,7 @@ func TestParseText(t *testing.T) {
 	}
 	ParseFile(conf, testingProc)
 	for i, s := range testingProc.tokens {
-		assert.Equal(t, strings.ToLower(loremData[i]), s)
+		assert.Equal(t, loremData[i], s)
 	}
 }
 
@@ -88,7 +88,7 @@ func TestNonUTF8Encoding(t *testing.T) {
 		tokens: make([]string, 5),
 	}
 	st.parseSource(r, testingProc)
-	tst := []string{"žluťoučký", "kůň", "úpěl", "ďábelské", "ódy"}
+	tst := []string{"Žluťoučký", "kůň", "úpěl", "ďábelské", "ódy"}
 	for i, s := range tst {
 		assert.Equal(t, s, testingProc.tokens[i])
 	}
@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
 // ArgsWriterList represents a list of ArgsDictWriter
@@ -127,6 +128,35 @@ type ArgsDictReader struct {
 // Name returns name of a respective metadata attribute.
 func (ad *ArgsDictReader) Name() string { return ad.name }
 
+// Size returns number of values in the dictionary.
+func (ad *ArgsDictReader) Size() int { return len(ad.index) }
+
+// FindMatching returns all the values of the dictionary
+// (in ascending order) for which fn returns true
+func (ad *ArgsDictReader) FindMatching(fn func(v string) bool) []AttrVal {
+	ans := make([]AttrVal, 0, 10)
+	for i := 0; i < len(ad.index); i++ {
+		if fn(ad.index[AttrVal(i)]) {
+			ans = append(ans, AttrVal(i))
+		}
+	}
+	return ans
+}
+
+// FindArgsDicts returns names of all the attributes with
+// a dictionary stored within a specified directory.
+func FindArgsDicts(dirPath string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dirPath, "column_*.dict"))
+	if err != nil {
+		return nil, err
+	}
+	ans := make([]string, len(files))
+	for i, f := range files {
+		ans[i] = strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), "column_"), ".dict")
+	}
+	return ans, nil
+}
+
 // LoadArgsDict loads a specific attribute dictionary.
 func LoadArgsDict(dirPath string, ident string) (*ArgsDictReader, error) {
 	filePath := filepath.Join(dirPath, fmt.Sprintf("column_%s.dict", ident))
@@ -20,6 +20,8 @@ package column
 
 import (
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -39,3 +41,15 @@ func TestArgsDictWriterAddValue(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, 1, len(adw.index))
 }
+
+func TestFindArgsDicts(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	NewArgsDictWriter("doc.genre").Save(dirPath)
+	NewArgsDictWriter("doc.year").Save(dirPath)
+
+	ans, err := FindArgsDicts(dirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"doc.genre", "doc.year"}, ans)
+}
@@ -23,8 +23,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+
+	"github.com/tomachalek/gloomy/gerrors"
 )
 
 const (
@@ -43,11 +46,36 @@ type IndexItem struct {
 	UpTo  int
 }
 
+// IndexColumnReader represents a read-only access
+// to an index column used when searching.
+type IndexColumnReader interface {
+	Size() int
+
+	// Item returns a copy of an item at the
+	// specified position
+	Item(idx int) IndexItem
+
+	// LoadChunk loads a partial data starting from
+	// index fromIdx (incl.) up to toIdx (incl.)
+	LoadChunk(fromIdx int, toIdx int) error
+
+	LoadWholeChunk() error
+
+	// Fork returns a reader of the same stored data with
+	// its own loaded chunk. I.e. the original and the forked
+	// reader can load different chunks concurrently.
+	Fork() IndexColumnReader
+}
+
 type IndexColumn struct {
 	data     []*IndexItem
 	fullSize int
 	dataPath string
 	offset   int
+
+	// blockDir is set once a compressed column file is detected
+	blockDir      *blockDirectory
+	formatChecked bool
 }
 
 func (ic *IndexColumn) Size() int {
@@ -58,6 +86,10 @@ func (ic *IndexColumn) Get(idx int) *IndexItem {
 	return ic.data[idx-ic.offset]
 }
 
+func (ic *IndexColumn) Item(idx int) IndexItem {
+	return *ic.data[idx-ic.offset]
+}
+
 func (ic *IndexColumn) Set(idx int, it *IndexItem) {
 	ic.data[idx-ic.offset] = it
 }
@@ -68,14 +100,22 @@ func (ic *IndexColumn) Extend(appendSize int) {
 
 // Shrink removes spare array items
 func (ic *IndexColumn) Shrink(rightIdx int) {
-	if rightIdx >= len(ic.data) {
+	if rightIdx > len(ic.data) {
 		panic("Cannot shrink to a larger column")
 	}
 	ic.data = ic.data[:rightIdx]
 }
 
 func (ic *IndexColumn) Save(colIdx int, dirPath string) error {
+	return ic.SaveAs(colIdx, dirPath, PlainFormat)
+}
+
+// SaveAs stores the column to a file using a specified format
+func (ic *IndexColumn) SaveAs(colIdx int, dirPath string, format ColumnFormat) error {
 	dstPath := CreateColIdxPath(colIdx, dirPath)
+	if format == VarintFormat {
+		return ic.saveCompressed(dstPath)
+	}
 	f, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
 	defer f.Close()
 	if err != nil {
@@ -96,15 +136,82 @@ func (ic *IndexColumn) Save(colIdx int, dirPath string) error {
 	return nil
 }
 
-func (ic *IndexColumn) LoadWholeChunk() {
+func (ic *IndexColumn) saveCompressed(dstPath string) error {
+	f, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw := bufio.NewWriter(f)
+	err = writeCompressed(fw, len(ic.data), 2, func(idx int) blockItem {
+		return blockItem{int64(ic.data[idx].Index), int64(ic.data[idx].UpTo)}
+	})
+	if err == nil {
+		err = fw.Flush()
+	}
+	if err != nil {
+		os.Remove(dstPath) // try to clean but don't care much
+		return err
+	}
+	ic.dataPath = dstPath
+	return nil
+}
+
+// compressedDir returns a block directory in case the
+// column file is compressed. Otherwise nil is returned.
+func (ic *IndexColumn) compressedDir() (*blockDirectory, error) {
+	if !ic.formatChecked {
+		var err error
+		ic.blockDir, err = openBlockDirectory(ic.dataPath)
+		if err != nil {
+			return nil, err
+		}
+		ic.formatChecked = true
+	}
+	return ic.blockDir, nil
+}
+
+func (ic *IndexColumn) loadCompressedChunk(bd *blockDirectory, fromIdx int, toIdx int) error {
+	ic.fullSize = bd.numItems
+	if fromIdx > 0 {
+		fromIdx-- // we must know 'upTo' value of previous index item
+	}
+	ic.data = ic.data[:0]
+	offset, err := loadCompressedChunk(ic.dataPath, bd, fromIdx, toIdx, func(idx int, item blockItem) {
+		ic.data = append(ic.data, &IndexItem{Index: int(item[0]), UpTo: int(item[1])})
+	})
+	if err != nil {
+		return err
+	}
+	ic.offset = offset
+	return nil
+}
+
+func (ic *IndexColumn) LoadWholeChunk() error {
+	bd, err := ic.compressedDir()
+	if err != nil {
+		return err
+	}
+	if bd != nil {
+		return ic.loadCompressedChunk(bd, 0, bd.numItems-1)
+	}
 	f, err := os.Open(ic.dataPath)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer f.Close()
+	finfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
 	fr := bufio.NewReader(f)
 	var colLength int64
-	binary.Read(fr, binary.LittleEndian, &colLength)
+	if err := binary.Read(fr, binary.LittleEndian, &colLength); err != nil {
+		return gerrors.NewCorruptDataError(ic.dataPath, "cannot read column length: %s", err)
+	}
+	if colLength < 0 || indexColumnHeaderSize+colLength*recNumberSizeBytes*2 > finfo.Size() {
+		return gerrors.NewCorruptDataError(ic.dataPath, "declared length %d exceeds file size", colLength)
+	}
 	ic.fullSize = int(colLength)
 
 	if len(ic.data) != cap(ic.data) {
@@ -118,36 +225,74 @@ func (ic *IndexColumn) LoadWholeChunk() {
 		ic.data = ic.data[:ic.fullSize]
 	}
 
+	rec := make([]int64, 2)
 	for i := 0; i < ic.fullSize; i++ {
-		var index, upTo int64
-		binary.Read(fr, binary.LittleEndian, &index)
-		binary.Read(fr, binary.LittleEndian, &upTo)
-		ic.data[i] = &IndexItem{Index: int(index), UpTo: int(upTo)}
+		if err := binary.Read(fr, binary.LittleEndian, rec); err != nil {
+			return gerrors.NewCorruptDataError(ic.dataPath, "cannot read item %d: %s", i, err)
+		}
+		ic.data[i] = &IndexItem{Index: int(rec[0]), UpTo: int(rec[1])}
+	}
+	ic.offset = 0
+	return nil
+}
+
+// Fork creates a new reader of the column file. In case
+// the column is not bound to a file, the column itself
+// is returned as there is nothing to load.
+func (ic *IndexColumn) Fork() IndexColumnReader {
+	if ic.dataPath == "" {
+		return ic
+	}
+	return &IndexColumn{
+		data:          make([]*IndexItem, 0),
+		fullSize:      ic.fullSize,
+		dataPath:      ic.dataPath,
+		blockDir:      ic.blockDir,
+		formatChecked: ic.formatChecked,
 	}
 }
 
-func (ic *IndexColumn) LoadChunk(fromIdx int, toIdx int) {
+func (ic *IndexColumn) LoadChunk(fromIdx int, toIdx int) error {
+	bd, err := ic.compressedDir()
+	if err != nil {
+		return err
+	}
+	if bd != nil {
+		return ic.loadCompressedChunk(bd, fromIdx, toIdx)
+	}
 	f, err := os.Open(ic.dataPath)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer f.Close()
 
+	finfo, err := f.Stat()
+	if err != nil {
+		return err
+	}
 	var colLen int64
-	binary.Read(f, binary.LittleEndian, &colLen)
+	if err := binary.Read(f, binary.LittleEndian, &colLen); err != nil {
+		return gerrors.NewCorruptDataError(ic.dataPath, "cannot read column length: %s", err)
+	}
+	if colLen < 0 || indexColumnHeaderSize+colLen*recNumberSizeBytes*2 > finfo.Size() {
+		return gerrors.NewCorruptDataError(ic.dataPath, "declared length %d exceeds file size", colLen)
+	}
 	ic.fullSize = int(colLen)
 
 	if fromIdx > 0 {
 		fromIdx-- // we must know 'upTo' value of previous index item
 	}
+	if fromIdx < 0 || toIdx >= ic.fullSize {
+		return gerrors.NewCorruptDataError(ic.dataPath, "range [%d, %d] out of column length %d", fromIdx, toIdx, ic.fullSize)
+	}
 
 	f.Seek(int64(fromIdx*recNumberSizeBytes*2+recNumberSizeBytes), os.SEEK_SET)
 	newLength := toIdx + 1 - fromIdx
 
 	rawData := make([]byte, newLength*recNumberSizeBytes*2)
-	_, err = f.Read(rawData)
+	_, err = io.ReadFull(f, rawData)
 	if err != nil {
-		panic(err)
+		return gerrors.NewCorruptDataError(ic.dataPath, "cannot read items [%d, %d]: %s", fromIdx, toIdx, err)
 	}
 	indexData := bytes.NewReader(rawData)
 
@@ -168,6 +313,7 @@ func (ic *IndexColumn) LoadChunk(fromIdx int, toIdx int) {
 		ic.data[i] = &IndexItem{Index: int(index), UpTo: int(upTo)}
 	}
 	ic.offset = fromIdx
+	return nil
 }
 
 // ----------------------------------------------------------------------------
@@ -38,6 +38,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/util"
 )
 
 var _ = log.Print
@@ -83,13 +86,17 @@ type AttrValColumn interface {
 	// guarantees that required data are loaded,
 	// it may also load some additional items.
 	// I.e. loading (1, 5) does not imply Size() == 5
-	LoadChunk(fromIdx int, toIdx int)
+	LoadChunk(fromIdx int, toIdx int) error
 
 	ForEach(func(int, interface{}))
 
 	DataPath() string
 
 	ReadItem(reader io.Reader, idx int)
+
+	// Fork returns a column of the same stored data with
+	// its own loaded chunk (see IndexColumnReader.Fork)
+	Fork() AttrValColumn
 }
 
 // ----------------------------------------------------------------------------
@@ -122,23 +129,27 @@ func saveAttrColumn(col AttrValColumn, dirPath string) (string, error) {
 }
 
 // return actual offset (it is different from 'fromIdx')
-func loadAttrColumnChunk(col AttrValColumn, fromIdx int, toIdx int) int {
+func loadAttrColumnChunk(col AttrValColumn, fromIdx int, toIdx int) (int, error) {
 	f, err := os.Open(col.DataPath())
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 	defer f.Close()
 
 	if fromIdx > 0 {
 		fromIdx-- // we must know 'upTo' value of previous index item
 	}
+	if fromIdx < 0 || toIdx >= col.StoredSize() {
+		return 0, gerrors.NewCorruptDataError(col.DataPath(), "range [%d, %d] out of column length %d",
+			fromIdx, toIdx, col.StoredSize())
+	}
 	col.Seek(f, fromIdx)
 	newLength := toIdx + 1 - fromIdx
 
 	rawData := make([]byte, newLength*col.UnitSize())
-	_, err = f.Read(rawData)
+	_, err = io.ReadFull(f, rawData)
 	if err != nil {
-		panic(err)
+		return 0, gerrors.NewCorruptDataError(col.DataPath(), "cannot read items [%d, %d]: %s", fromIdx, toIdx, err)
 	}
 	indexData := bytes.NewReader(rawData)
 
@@ -152,7 +163,7 @@ func loadAttrColumnChunk(col AttrValColumn, fromIdx int, toIdx int) int {
 	for i := fromIdx; i <= toIdx; i++ {
 		col.ReadItem(indexData, i-fromIdx)
 	}
-	return fromIdx
+	return fromIdx, nil
 }
 
 // ----------------------------------------------------------------------------
@@ -191,7 +202,7 @@ func (c *Column8) UnitSize() int {
 
 // Resize removes spare array items
 func (c *Column8) Shrink(rightIdx int) {
-	if rightIdx >= len(c.data) {
+	if rightIdx > len(c.data) {
 		panic("Cannot shrink to a larger column")
 	}
 	c.data = c.data[:rightIdx]
@@ -225,8 +236,22 @@ func (c *Column8) Save(dirPath string) error {
 	return nil
 }
 
-func (c *Column8) LoadChunk(fromIdx int, toIdx int) {
-	c.offset = loadAttrColumnChunk(c, fromIdx, toIdx)
+func (c *Column8) LoadChunk(fromIdx int, toIdx int) error {
+	offset, err := loadAttrColumnChunk(c, fromIdx, toIdx)
+	if err != nil {
+		return err
+	}
+	c.offset = offset
+	return nil
+}
+
+// Fork creates a new reader of the column file (or returns
+// the column itself in case it is not bound to a file)
+func (c *Column8) Fork() AttrValColumn {
+	if c.dataPath == "" {
+		return c
+	}
+	return &Column8{dataPath: c.dataPath, fullSize: c.fullSize, name: c.name}
 }
 
 func (c *Column8) ReadItem(reader io.Reader, idx int) {
@@ -243,6 +268,10 @@ type Column32 struct {
 	fullSize int
 	offset   int
 	name     string
+
+	// blockDir is set in case the column is loaded
+	// from a compressed file
+	blockDir *blockDirectory
 }
 
 func (c *Column32) Name() string {
@@ -271,7 +300,7 @@ func (c *Column32) UnitSize() int {
 
 // Resize removes spare array items
 func (c *Column32) Shrink(rightIdx int) {
-	if rightIdx >= len(c.data) {
+	if rightIdx > len(c.data) {
 		panic("Cannot shrink to a larger column")
 	}
 	c.data = c.data[:rightIdx]
@@ -292,7 +321,7 @@ func (c *Column32) DataPath() string {
 }
 
 func (c *Column32) Seek(file *os.File, numPos int) {
-	file.Seek(int64(numPos*c.UnitSize()), os.SEEK_SET)
+	file.Seek(int64(numPos*c.UnitSize()+16), os.SEEK_SET)
 }
 
 func (c *Column32) Save(dirPath string) error {
@@ -305,8 +334,40 @@ func (c *Column32) Save(dirPath string) error {
 	return nil
 }
 
-func (c *Column32) LoadChunk(fromIdx int, toIdx int) {
-	c.offset = loadAttrColumnChunk(c, fromIdx, toIdx)
+func (c *Column32) LoadChunk(fromIdx int, toIdx int) error {
+	if c.blockDir != nil {
+		return c.loadCompressedChunk(fromIdx, toIdx)
+	}
+	offset, err := loadAttrColumnChunk(c, fromIdx, toIdx)
+	if err != nil {
+		return err
+	}
+	c.offset = offset
+	return nil
+}
+
+func (c *Column32) loadCompressedChunk(fromIdx int, toIdx int) error {
+	if fromIdx > 0 {
+		fromIdx-- // to be consistent with loadAttrColumnChunk
+	}
+	c.data = c.data[:0]
+	offset, err := loadCompressedChunk(c.dataPath, c.blockDir, fromIdx, toIdx, func(idx int, item blockItem) {
+		c.data = append(c.data, uint32(item[0]))
+	})
+	if err != nil {
+		return err
+	}
+	c.offset = offset
+	return nil
+}
+
+// Fork creates a new reader of the column file (or returns
+// the column itself in case it is not bound to a file)
+func (c *Column32) Fork() AttrValColumn {
+	if c.dataPath == "" {
+		return c
+	}
+	return &Column32{dataPath: c.dataPath, fullSize: c.fullSize, name: c.name, blockDir: c.blockDir}
 }
 
 func (c *Column32) ReadItem(reader io.Reader, idx int) {
@@ -328,19 +389,42 @@ func NewMetadataColumn(ident string, typeIdent string, size int) (AttrValColumn,
 	}
 }
 
+// ColumnTypeIdent returns a type identifier of a column
+// as used by NewMetadataColumn (col8, col32)
+func ColumnTypeIdent(col AttrValColumn) string {
+	return fmt.Sprintf("col%d", col.UnitSize()*8)
+}
+
 //
 // TODO rename to NewBoundMetadataColumn
 func LoadMetadataColumn(ident string, dirPath string) (AttrValColumn, error) {
 	f, err := os.Open(createColumnPath(ident, dirPath))
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer f.Close()
 
+	compressed, err := isCompressedFile(f)
+	if err != nil {
+		return nil, err
+	}
+	if compressed {
+		bd, err := readFileBlockDirectory(f)
+		if err != nil {
+			return nil, err
+		}
+		if bd.numFields != 1 {
+			return nil, gerrors.NewCorruptDataError(f.Name(), "unsupported number of fields %d", bd.numFields)
+		}
+		return &Column32{fullSize: bd.numItems, dataPath: f.Name(), blockDir: bd}, nil
+	}
+
 	var colLen int64
-	binary.Read(f, binary.LittleEndian, &colLen)
 	flags := make([]int8, 8)
-	binary.Read(f, binary.LittleEndian, flags)
+	if err := util.FirstError(binary.Read(f, binary.LittleEndian, &colLen),
+		binary.Read(f, binary.LittleEndian, flags)); err != nil {
+		return nil, gerrors.NewCorruptDataError(f.Name(), "cannot read column header: %s", err)
+	}
 	var ans AttrValColumn
 	var ansErr error
 	switch flags[0] {
@@ -349,15 +433,57 @@ func LoadMetadataColumn(ident string, dirPath string) (AttrValColumn, error) {
 	case 32:
 		ans = &Column32{fullSize: int(colLen), dataPath: f.Name()}
 	default:
-		ansErr = fmt.Errorf("Cannot load metadata column, unsupported item length %d", flags[0])
+		ansErr = gerrors.NewCorruptDataError(f.Name(), "unsupported item length %d", flags[0])
 	}
 	return ans, ansErr
 }
 
+// LoadStoredMetadataColumn loads a metadata column using
+// a specified storage type.
+func LoadStoredMetadataColumn(ident string, dirPath string, storage StorageType) (AttrValColumn, error) {
+	if storage == MmapStorage {
+		return LoadMmapMetadataColumn(ident, dirPath)
+	}
+	return LoadMetadataColumn(ident, dirPath)
+}
+
 func LoadCountsColumn(dirPath string) (AttrValColumn, error) {
 	return LoadMetadataColumn("_counts", dirPath)
 }
 
+// LoadStoredCountsColumn loads the n-gram counts column
+// using a specified storage type.
+func LoadStoredCountsColumn(dirPath string, storage StorageType) (AttrValColumn, error) {
+	return LoadStoredMetadataColumn("_counts", dirPath, storage)
+}
+
+// SaveCountsColumn stores the n-gram counts column
+// using a specified format.
+func SaveCountsColumn(col AttrValColumn, dirPath string, format ColumnFormat) error {
+	if format == PlainFormat {
+		return col.Save(dirPath)
+	}
+	dstPath := createColumnPath(col.Name(), dirPath)
+	f, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fw := bufio.NewWriter(f)
+	err = writeCompressed(fw, col.Size(), 1, func(idx int) blockItem {
+		return blockItem{int64(col.Get(idx))}
+	})
+	if err == nil {
+		err = fw.Flush()
+	}
+	if err != nil {
+		os.Remove(dstPath) // try to clean but don't care much
+		return err
+	}
+	log.Printf("Saved metadata %s (compressed)", col.Name())
+	return nil
+}
+
 func NewCountsColumn(size int) AttrValColumn {
 	return &Column32{name: "_counts", data: make([]uint32, size)}
 }
@@ -128,3 +128,16 @@ func TestColumn8LoadChunk(t *testing.T) {
 	}
 
 }
+
+func TestColumn8Fork(t *testing.T) {
+	col, _ := LoadMetadataColumn("10items", getFilePath())
+	col.LoadChunk(1, 3)
+	fork := col.Fork()
+	fork.LoadChunk(6, 8)
+	for i := 1; i < 3; i++ {
+		assert.Equal(t, AttrVal(i), col.Get(i))
+	}
+	for i := 6; i < 8; i++ {
+		assert.Equal(t, AttrVal(i), fork.Get(i))
+	}
+}
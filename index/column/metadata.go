@@ -71,14 +71,24 @@ func (mw *MetadataWriter) Shrink(rightIdx int) {
 }
 
 func (mw *MetadataWriter) Save(dirPath string) error {
-	for _, avc := range mw.cols {
-		err := avc.Save(dirPath)
+	err := mw.SaveColumns(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, d := range mw.dicts {
+		err := d.Save(dirPath)
 		if err != nil {
 			return err
 		}
 	}
-	for _, d := range mw.dicts {
-		err := d.Save(dirPath)
+	return nil
+}
+
+// SaveColumns stores just the metadata columns without
+// respective attribute dictionaries.
+func (mw *MetadataWriter) SaveColumns(dirPath string) error {
+	for _, avc := range mw.cols {
+		err := avc.Save(dirPath)
 		if err != nil {
 			return err
 		}
@@ -86,6 +96,23 @@ func (mw *MetadataWriter) Save(dirPath string) error {
 	return nil
 }
 
+// NewSharedDictsWriter creates a new MetadataWriter with empty
+// columns of the same names, types and order as the original
+// ones. Attribute dictionaries are shared with the original
+// writer (this is used e.g. by rotated n-gram indices).
+func (mw *MetadataWriter) NewSharedDictsWriter() *MetadataWriter {
+	cols := make([]AttrValColumn, len(mw.cols))
+	for i, c := range mw.cols {
+		switch c.(type) {
+		case *Column8:
+			cols[i] = &Column8{name: c.Name(), data: make([]uint8, 0)}
+		case *Column32:
+			cols[i] = &Column32{name: c.Name(), data: make([]uint32, 0)}
+		}
+	}
+	return &MetadataWriter{cols: cols, dicts: mw.dicts}
+}
+
 func NewMetadataWriter(attrs map[string]string) *MetadataWriter {
 	cols := make([]AttrValColumn, len(attrs))
 	dicts := make([]*ArgsDictWriter, len(attrs))
@@ -113,10 +140,33 @@ type MetadataReader struct {
 	cols  []AttrValColumn
 }
 
-func (mr *MetadataReader) LoadChunk(fromIdx int, toIdx int) {
+func (mr *MetadataReader) LoadChunk(fromIdx int, toIdx int) error {
 	for _, v := range mr.cols {
-		v.LoadChunk(fromIdx, toIdx)
+		if err := v.LoadChunk(fromIdx, toIdx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fork returns a reader sharing attribute dictionaries
+// with its own loaded chunks of metadata columns
+func (mr *MetadataReader) Fork() *MetadataReader {
+	cols := make([]AttrValColumn, len(mr.cols))
+	for i, v := range mr.cols {
+		cols[i] = v.Fork()
+	}
+	return &MetadataReader{dicts: mr.dicts, cols: cols}
+}
+
+// AttrNames returns names of all the loaded attributes
+// in the same order as the values returned by Get
+func (mr *MetadataReader) AttrNames() []string {
+	ans := make([]string, len(mr.dicts))
+	for i, d := range mr.dicts {
+		ans[i] = d.Name()
 	}
+	return ans
 }
 
 func (mr *MetadataReader) Get(idx int) []string {
@@ -127,17 +177,35 @@ func (mr *MetadataReader) Get(idx int) []string {
 	return ans
 }
 
+// GetValue returns an encoded value of an attribute at
+// position attrIdx (see AttrNames) for a specified row
+func (mr *MetadataReader) GetValue(attrIdx int, idx int) AttrVal {
+	return mr.cols[attrIdx].Get(idx)
+}
+
+// Dicts returns dictionaries of all the loaded attributes
+// in the same order as the values returned by Get
+func (mr *MetadataReader) Dicts() ArgsReaderList {
+	return mr.dicts
+}
+
 func LoadMetadataReader(dirPath string, attrNames []string) (*MetadataReader, error) {
+	return LoadMetadataReaderFrom(dirPath, dirPath, attrNames, FileStorage)
+}
+
+// LoadMetadataReaderFrom loads metadata columns and attribute
+// dictionaries stored in possibly different directories.
+func LoadMetadataReaderFrom(colsDirPath string, dictsDirPath string, attrNames []string, storage StorageType) (*MetadataReader, error) {
 	cols := make([]AttrValColumn, len(attrNames))
 	dicts := make([]*ArgsDictReader, len(attrNames))
 	for i, attrName := range attrNames {
-		tmp, err := LoadMetadataColumn(attrName, dirPath)
+		tmp, err := LoadStoredMetadataColumn(attrName, colsDirPath, storage)
 		if err != nil {
 			return nil, err
 		}
 		cols[i] = tmp
 		var err2 error
-		dicts[i], err2 = LoadArgsDict(dirPath, attrName)
+		dicts[i], err2 = LoadArgsDict(dictsDirPath, attrName)
 		if err2 != nil {
 			return nil, err2
 		}
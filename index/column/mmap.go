@@ -0,0 +1,300 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package column
+
+// This file contains read-only implementations of index and
+// metadata columns backed by memory mapped files. Records are
+// decoded on demand directly from the mapped data so there is
+// no need to load chunks (LoadChunk, LoadWholeChunk do nothing)
+// and caching is left to the OS page cache. Items of compressed
+// columns are decoded starting from the beginning of their block.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+const (
+	indexColumnHeaderSize = recNumberSizeBytes
+	attrColumnHeaderSize  = 16
+)
+
+// StorageType specifies how search-time columns
+// access their data
+type StorageType int
+
+const (
+	// FileStorage loads requested chunks of column data
+	// into memory
+	FileStorage StorageType = iota
+
+	// MmapStorage maps whole column files into memory
+	// and decodes records on demand
+	MmapStorage
+)
+
+// ImportStorageType translates a configuration value
+// (file, mmap) into a StorageType. An empty value
+// means FileStorage.
+func ImportStorageType(v string) (StorageType, error) {
+	switch v {
+	case "", "file":
+		return FileStorage, nil
+	case "mmap":
+		return MmapStorage, nil
+	default:
+		return FileStorage, fmt.Errorf("Unknown column storage type %s", v)
+	}
+}
+
+// mapColumnFile maps a whole file into memory. The mapping
+// is released once the owner object is garbage collected
+// (so methods accessing the data must keep the owner alive
+// until they are done - see runtime.KeepAlive).
+func mapColumnFile(path string, owner interface{}) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	finfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := mmapFile(f, int(finfo.Size()))
+	if err != nil {
+		return nil, err
+	}
+	runtime.SetFinalizer(owner, func(interface{}) {
+		munmapFile(data)
+	})
+	return data, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// MmapIndexColumn is a read-only IndexColumnReader
+// backed by a memory mapped file.
+type MmapIndexColumn struct {
+	data     []byte
+	fullSize int
+	dataPath string
+	blockDir *blockDirectory
+}
+
+func (mc *MmapIndexColumn) Size() int {
+	return mc.fullSize
+}
+
+// Item decodes an item at the specified position
+func (mc *MmapIndexColumn) Item(idx int) IndexItem {
+	defer runtime.KeepAlive(mc)
+	if mc.blockDir != nil {
+		item := mc.blockDir.decodeItem(mc.data, idx)
+		return IndexItem{Index: int(item[0]), UpTo: int(item[1])}
+	}
+	pos := indexColumnHeaderSize + idx*recNumberSizeBytes*2
+	return IndexItem{
+		Index: int(int64(binary.LittleEndian.Uint64(mc.data[pos:]))),
+		UpTo:  int(int64(binary.LittleEndian.Uint64(mc.data[pos+recNumberSizeBytes:]))),
+	}
+}
+
+// LoadChunk does nothing as all the data are always available
+func (mc *MmapIndexColumn) LoadChunk(fromIdx int, toIdx int) error {
+	return nil
+}
+
+// LoadWholeChunk does nothing as all the data are always available
+func (mc *MmapIndexColumn) LoadWholeChunk() error {
+	return nil
+}
+
+// Fork returns the column itself as the mapped
+// data are read-only and always available
+func (mc *MmapIndexColumn) Fork() IndexColumnReader {
+	return mc
+}
+
+// OpenMmapIndexColumn maps an index column file into memory
+func OpenMmapIndexColumn(dataPath string) (*MmapIndexColumn, error) {
+	ans := &MmapIndexColumn{dataPath: dataPath}
+	var err error
+	ans.data, err = mapColumnFile(dataPath, ans)
+	if err != nil {
+		return nil, err
+	}
+	if len(ans.data) < indexColumnHeaderSize {
+		return nil, gerrors.NewCorruptDataError(dataPath, "invalid index column header")
+	}
+	if hasCompressedMagic(ans.data) {
+		ans.blockDir, err = parseBlockDirectory(ans.data)
+		if err != nil {
+			return nil, gerrors.NewCorruptDataError(dataPath, "%s", err)
+		}
+		if ans.blockDir.numFields != 2 {
+			return nil, gerrors.NewCorruptDataError(dataPath, "invalid index column header")
+		}
+		ans.fullSize = ans.blockDir.numItems
+		return ans, nil
+	}
+	ans.fullSize = int(int64(binary.LittleEndian.Uint64(ans.data)))
+	if ans.fullSize < 0 {
+		return nil, gerrors.NewCorruptDataError(dataPath, "invalid column length %d", ans.fullSize)
+	}
+	if (len(ans.data)-indexColumnHeaderSize)/(recNumberSizeBytes*2) < ans.fullSize {
+		return nil, gerrors.NewCorruptDataError(dataPath, "file is truncated")
+	}
+	return ans, nil
+}
+
+// ----------------------------------------------------------------------------
+
+// MmapColumn is a read-only AttrValColumn backed by a memory
+// mapped file. It supports both 8-bit and 32-bit columns.
+// Methods modifying the column panic.
+type MmapColumn struct {
+	data     []byte
+	dataPath string
+	fullSize int
+	unitSize int
+	name     string
+	blockDir *blockDirectory
+}
+
+func (c *MmapColumn) Name() string {
+	return c.name
+}
+
+func (c *MmapColumn) Seek(file *os.File, numPos int) {
+	file.Seek(int64(numPos*c.unitSize+attrColumnHeaderSize), os.SEEK_SET)
+}
+
+func (c *MmapColumn) Get(idx int) AttrVal {
+	defer runtime.KeepAlive(c)
+	if c.blockDir != nil {
+		return AttrVal(c.blockDir.decodeItem(c.data, idx)[0])
+	}
+	pos := attrColumnHeaderSize + idx*c.unitSize
+	if c.unitSize == 1 {
+		return AttrVal(c.data[pos])
+	}
+	return AttrVal(binary.LittleEndian.Uint32(c.data[pos:]))
+}
+
+func (c *MmapColumn) Set(idx int, it AttrVal) {
+	panic("Cannot modify a memory mapped column")
+}
+
+func (c *MmapColumn) Save(dirPath string) error {
+	return fmt.Errorf("Cannot save a memory mapped column")
+}
+
+func (c *MmapColumn) Extend(appendSize int) {
+	panic("Cannot modify a memory mapped column")
+}
+
+func (c *MmapColumn) Shrink(rightIdx int) {
+	panic("Cannot modify a memory mapped column")
+}
+
+func (c *MmapColumn) Size() int {
+	return c.fullSize
+}
+
+func (c *MmapColumn) StoredSize() int {
+	return c.fullSize
+}
+
+func (c *MmapColumn) UnitSize() int {
+	return c.unitSize
+}
+
+// LoadChunk does nothing as all the data are always available
+func (c *MmapColumn) LoadChunk(fromIdx int, toIdx int) error {
+	return nil
+}
+
+func (c *MmapColumn) ForEach(fn func(int, interface{})) {
+	for i := 0; i < c.fullSize; i++ {
+		if c.unitSize == 1 {
+			fn(i, uint8(c.Get(i)))
+
+		} else {
+			fn(i, uint32(c.Get(i)))
+		}
+	}
+}
+
+func (c *MmapColumn) DataPath() string {
+	return c.dataPath
+}
+
+// Fork returns the column itself as the mapped
+// data are read-only and always available
+func (c *MmapColumn) Fork() AttrValColumn {
+	return c
+}
+
+func (c *MmapColumn) ReadItem(reader io.Reader, idx int) {
+	panic("Cannot modify a memory mapped column")
+}
+
+// LoadMmapMetadataColumn maps a metadata column file
+// into memory.
+func LoadMmapMetadataColumn(ident string, dirPath string) (AttrValColumn, error) {
+	ans := &MmapColumn{name: ident, dataPath: createColumnPath(ident, dirPath)}
+	var err error
+	ans.data, err = mapColumnFile(ans.dataPath, ans)
+	if err != nil {
+		return nil, err
+	}
+	if len(ans.data) < attrColumnHeaderSize {
+		return nil, gerrors.NewCorruptDataError(ans.dataPath, "invalid metadata column header")
+	}
+	if hasCompressedMagic(ans.data) {
+		ans.blockDir, err = parseBlockDirectory(ans.data)
+		if err != nil {
+			return nil, gerrors.NewCorruptDataError(ans.dataPath, "%s", err)
+		}
+		if ans.blockDir.numFields != 1 {
+			return nil, gerrors.NewCorruptDataError(ans.dataPath, "invalid metadata column header")
+		}
+		ans.fullSize = ans.blockDir.numItems
+		ans.unitSize = 4
+		return ans, nil
+	}
+	ans.fullSize = int(int64(binary.LittleEndian.Uint64(ans.data)))
+	if ans.fullSize < 0 {
+		return nil, gerrors.NewCorruptDataError(ans.dataPath, "invalid column length %d", ans.fullSize)
+	}
+	switch int8(ans.data[8]) {
+	case 8:
+		ans.unitSize = 1
+	case 32:
+		ans.unitSize = 4
+	default:
+		return nil, gerrors.NewCorruptDataError(ans.dataPath, "unsupported item length %d", int8(ans.data[8]))
+	}
+	if (len(ans.data)-attrColumnHeaderSize)/ans.unitSize < ans.fullSize {
+		return nil, gerrors.NewCorruptDataError(ans.dataPath, "file is truncated")
+	}
+	return ans, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package column
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func TestImportStorageType(t *testing.T) {
+	v, err := ImportStorageType("")
+	assert.Nil(t, err)
+	assert.Equal(t, FileStorage, v)
+	v, err = ImportStorageType("mmap")
+	assert.Nil(t, err)
+	assert.Equal(t, MmapStorage, v)
+	_, err = ImportStorageType("foo")
+	assert.Error(t, err)
+}
+
+func TestMmapColumn8(t *testing.T) {
+	col, err := LoadMmapMetadataColumn("10items", getFilePath())
+	assert.Nil(t, err)
+	assert.Equal(t, 10, col.Size())
+	assert.Equal(t, 1, col.UnitSize())
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, AttrVal(i), col.Get(i))
+	}
+}
+
+func TestMmapColumn32SameAsFile(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	col := NewCountsColumn(300)
+	for i := 0; i < 300; i++ {
+		col.Set(i, AttrVal(i*1000))
+	}
+	assert.Nil(t, col.Save(dirPath))
+
+	fcol, err := LoadCountsColumn(dirPath)
+	assert.Nil(t, err)
+	fcol.LoadChunk(0, 299)
+	mcol, err := LoadStoredCountsColumn(dirPath, MmapStorage)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, mcol.Size())
+	for i := 0; i < 300; i++ {
+		assert.Equal(t, fcol.Get(i), mcol.Get(i))
+	}
+}
+
+func TestMmapColumnIsReadOnly(t *testing.T) {
+	col, _ := LoadMmapMetadataColumn("10items", getFilePath())
+	assert.Panics(t, func() {
+		col.Set(0, 1)
+	})
+	assert.Error(t, col.Save(os.TempDir()))
+}
+
+func TestMmapIndexColumnSameAsFile(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := NewIndexColumn(50)
+	for i := 0; i < 50; i++ {
+		ic.Set(i, &IndexItem{Index: i * 3, UpTo: i * 7})
+	}
+	assert.Nil(t, ic.Save(0, dirPath))
+
+	fcol := NewBoundIndexColumn(CreateColIdxPath(0, dirPath))
+	fcol.LoadChunk(10, 20)
+	mcol, err := OpenMmapIndexColumn(CreateColIdxPath(0, dirPath))
+	assert.Nil(t, err)
+	assert.Equal(t, 50, mcol.Size())
+	for i := 10; i <= 20; i++ {
+		assert.Equal(t, fcol.Item(i), mcol.Item(i))
+	}
+}
+
+func TestMmapIndexColumnTruncated(t *testing.T) {
+	f, err := ioutil.TempFile("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.Write([]byte{10, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3})
+	f.Close()
+	_, err = OpenMmapIndexColumn(f.Name())
+	assert.Error(t, err)
+}
+
+func TestMmapColumnsNegativeLength(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	// column length -1 followed by a single index item
+	colPath := CreateColIdxPath(0, dirPath)
+	data := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	assert.Nil(t, ioutil.WriteFile(colPath, append(data, make([]byte, 16)...), 0644))
+	_, err = OpenMmapIndexColumn(colPath)
+	assert.True(t, gerrors.IsCorruptData(err))
+	// metadata column of 8-bit values
+	header := append(data, 8, 0, 0, 0, 0, 0, 0, 0)
+	assert.Nil(t, ioutil.WriteFile(createColumnPath("doc.id", dirPath), append(header, 1, 2), 0644))
+	_, err = LoadMmapMetadataColumn("doc.id", dirPath)
+	assert.True(t, gerrors.IsCorruptData(err))
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package column
+
+// This file contains functions for sequential reading of whole
+// column files used e.g. for index verification. Unlike column
+// loading (LoadChunk etc.), these functions check file sizes against
+// declared column lengths and they return errors instead of
+// panicking in case a file is damaged.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func scanCompressed(f *os.File, fileSize int64, numFields int, fn func(idx int, item blockItem)) (int, error) {
+	bd, err := readBlockDirectory(bufio.NewReader(f), fileSize)
+	if err != nil {
+		return 0, gerrors.NewCorruptDataError(f.Name(), "%s", err)
+	}
+	if bd.numFields != numFields {
+		return 0, gerrors.NewCorruptDataError(f.Name(), "unexpected number of fields per item %d", bd.numFields)
+	}
+	if err := bd.validateOffsets(fileSize - bd.dataStart); err != nil {
+		return 0, gerrors.NewCorruptDataError(f.Name(), "%s", err)
+	}
+	expected := bd.dataStart + bd.offsets[bd.numBlocks()]
+	if expected != fileSize {
+		return 0, gerrors.NewCorruptDataError(f.Name(), "declared length %d requires %d bytes, file has %d",
+			bd.numItems, expected, fileSize)
+	}
+	if _, err := f.Seek(bd.dataStart, os.SEEK_SET); err != nil {
+		return 0, err
+	}
+	fr := bufio.NewReader(f)
+	for b := 0; b < bd.numBlocks(); b++ {
+		data := make([]byte, bd.offsets[b+1]-bd.offsets[b])
+		if _, err := io.ReadFull(fr, data); err != nil {
+			return 0, gerrors.NewCorruptDataError(f.Name(), "%s", err)
+		}
+		if err := bd.decodeBlocks(data, b, fn); err != nil {
+			return 0, gerrors.NewCorruptDataError(f.Name(), "%s", err)
+		}
+	}
+	return bd.numItems, nil
+}
+
+func openScannedFile(dataPath string) (*os.File, int64, bool, error) {
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	finfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, false, err
+	}
+	compressed, err := isCompressedFile(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, false, err
+	}
+	return f, finfo.Size(), compressed, nil
+}
+
+// ScanIndexColumn reads all the items of an index column file
+// (no matter which format is used) and passes them to fn.
+// The function returns the number of items.
+func ScanIndexColumn(dataPath string, fn func(idx int, item IndexItem)) (int, error) {
+	f, fileSize, compressed, err := openScannedFile(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if compressed {
+		return scanCompressed(f, fileSize, 2, func(idx int, item blockItem) {
+			fn(idx, IndexItem{Index: int(item[0]), UpTo: int(item[1])})
+		})
+	}
+	fr := bufio.NewReader(f)
+	var colLen int64
+	if err := binary.Read(fr, binary.LittleEndian, &colLen); err != nil {
+		return 0, gerrors.NewCorruptDataError(dataPath, "cannot read column length: %s", err)
+	}
+	expected := indexColumnHeaderSize + colLen*recNumberSizeBytes*2
+	if colLen < 0 || expected != fileSize {
+		return 0, gerrors.NewCorruptDataError(dataPath, "declared length %d requires %d bytes, file has %d",
+			colLen, expected, fileSize)
+	}
+	rec := make([]int64, 2)
+	for i := 0; i < int(colLen); i++ {
+		if err := binary.Read(fr, binary.LittleEndian, rec); err != nil {
+			return 0, gerrors.NewCorruptDataError(dataPath, "%s", err)
+		}
+		fn(i, IndexItem{Index: int(rec[0]), UpTo: int(rec[1])})
+	}
+	return int(colLen), nil
+}
+
+// ScanAttrColumn reads all the values of a metadata (or counts)
+// column identified by ident and stored within dirPath and passes
+// them to fn. The function returns the number of items.
+func ScanAttrColumn(ident string, dirPath string, fn func(idx int, v AttrVal)) (int, error) {
+	dataPath := createColumnPath(ident, dirPath)
+	f, fileSize, compressed, err := openScannedFile(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if compressed {
+		return scanCompressed(f, fileSize, 1, func(idx int, item blockItem) {
+			fn(idx, AttrVal(item[0]))
+		})
+	}
+	fr := bufio.NewReader(f)
+	var colLen int64
+	if err := binary.Read(fr, binary.LittleEndian, &colLen); err != nil {
+		return 0, gerrors.NewCorruptDataError(dataPath, "cannot read column length: %s", err)
+	}
+	flags := make([]int8, 8)
+	if err := binary.Read(fr, binary.LittleEndian, flags); err != nil {
+		return 0, gerrors.NewCorruptDataError(dataPath, "cannot read column header: %s", err)
+	}
+	var unitSize int
+	switch flags[0] {
+	case 8:
+		unitSize = 1
+	case 32:
+		unitSize = 4
+	default:
+		return 0, gerrors.NewCorruptDataError(dataPath, "unsupported item length %d", flags[0])
+	}
+	expected := attrColumnHeaderSize + colLen*int64(unitSize)
+	if colLen < 0 || expected != fileSize {
+		return 0, gerrors.NewCorruptDataError(dataPath, "declared length %d requires %d bytes, file has %d",
+			colLen, expected, fileSize)
+	}
+	buff := make([]byte, unitSize)
+	for i := 0; i < int(colLen); i++ {
+		if _, err := io.ReadFull(fr, buff); err != nil {
+			return 0, gerrors.NewCorruptDataError(dataPath, "%s", err)
+		}
+		if unitSize == 1 {
+			fn(i, AttrVal(buff[0]))
+
+		} else {
+			fn(i, AttrVal(binary.LittleEndian.Uint32(buff)))
+		}
+	}
+	return int(colLen), nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package column
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func TestScanIndexColumn(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(150)
+	assert.Nil(t, ic.Save(0, dirPath))
+	assert.Nil(t, ic.SaveAs(1, dirPath, VarintFormat))
+	for i := 0; i < 2; i++ {
+		items := make([]IndexItem, 0, 150)
+		size, err := ScanIndexColumn(CreateColIdxPath(i, dirPath), func(idx int, item IndexItem) {
+			items = append(items, item)
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 150, size)
+		for j, v := range items {
+			assert.Equal(t, ic.Item(j), v)
+		}
+	}
+}
+
+func TestScanTruncatedIndexColumn(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(150)
+	assert.Nil(t, ic.Save(0, dirPath))
+	assert.Nil(t, ic.SaveAs(1, dirPath, VarintFormat))
+	for i := 0; i < 2; i++ {
+		colPath := CreateColIdxPath(i, dirPath)
+		finfo, _ := os.Stat(colPath)
+		assert.Nil(t, os.Truncate(colPath, finfo.Size()-3))
+		_, err := ScanIndexColumn(colPath, func(idx int, item IndexItem) {})
+		assert.Error(t, err)
+	}
+}
+
+func TestScanAttrColumn(t *testing.T) {
+	values := make([]AttrVal, 0, 10)
+	size, err := ScanAttrColumn("10items", getFilePath(), func(idx int, v AttrVal) {
+		values = append(values, v)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 10, size)
+	assert.Equal(t, []AttrVal{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, values)
+}
+
+func TestLoadChunkTruncatedIndexColumn(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(150)
+	assert.Nil(t, ic.Save(0, dirPath))
+	assert.Nil(t, ic.SaveAs(1, dirPath, VarintFormat))
+	for i := 0; i < 2; i++ {
+		colPath := CreateColIdxPath(i, dirPath)
+		finfo, _ := os.Stat(colPath)
+		assert.Nil(t, os.Truncate(colPath, finfo.Size()-20))
+		col := NewBoundIndexColumn(colPath)
+		err := col.LoadChunk(100, 149)
+		assert.True(t, gerrors.IsCorruptData(err))
+		assert.True(t, gerrors.IsCorruptData(col.LoadWholeChunk()))
+	}
+}
+
+func TestLoadChunkOutOfRange(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(10)
+	assert.Nil(t, ic.Save(0, dirPath))
+	col := NewBoundIndexColumn(CreateColIdxPath(0, dirPath))
+	assert.Error(t, col.LoadChunk(5, 20))
+	assert.Nil(t, col.LoadChunk(5, 9))
+}
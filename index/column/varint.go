@@ -0,0 +1,359 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package column
+
+// This file contains an implementation of a compressed column
+// format used for index columns and the counts column.
+//
+// A compressed file starts with an 8-byte magic value (its last
+// byte is 0xff so the plain format reading the first 8 bytes as
+// an int64 length would see a negative number). It is followed
+// by a header:
+//
+//   int64 number of items
+//   int64 number of items per block
+//   int64 number of fields per item (2 for index columns, 1 for counts)
+//   int64[numBlocks + 1] block directory (offsets relative to the data
+//                        section; the last one is the data length)
+//
+// and by the data section containing blocks of items. Within
+// a block, each field is encoded as a zig-zag varint delta
+// from the same field of the previous item (the first item of
+// a block is encoded as a delta from zero). This allows random
+// access with the granularity of a single block.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+const (
+	maxBlockFields = 2
+
+	// DefaultBlockSize specifies number of items
+	// per block of a compressed column
+	DefaultBlockSize = 64
+)
+
+var (
+	compressedColumnMagic = []byte{'G', 'L', 'M', 'Y', 'V', 'A', 'R', 0xff}
+)
+
+// ColumnFormat specifies an on-disk format of index
+// and counts columns
+type ColumnFormat int
+
+const (
+	// PlainFormat stores each value as a fixed size integer
+	PlainFormat ColumnFormat = iota
+
+	// VarintFormat stores blocks of delta + varint encoded values
+	VarintFormat
+)
+
+type blockItem [maxBlockFields]int64
+
+// blockDirectory describes layout of a compressed column
+type blockDirectory struct {
+	numItems  int
+	blockSize int
+	numFields int
+
+	// dataStart is an absolute position of the data section
+	dataStart int64
+
+	// offsets contains positions of blocks relative to dataStart
+	offsets []int64
+}
+
+func (bd *blockDirectory) numBlocks() int {
+	return len(bd.offsets) - 1
+}
+
+func (bd *blockDirectory) blockOf(idx int) int {
+	return idx / bd.blockSize
+}
+
+// blockRange returns absolute positions of data
+// for blocks [fromBlock, toBlock] (both incl.)
+func (bd *blockDirectory) blockRange(fromBlock int, toBlock int) (int64, int64) {
+	return bd.dataStart + bd.offsets[fromBlock], bd.dataStart + bd.offsets[toBlock+1]
+}
+
+// decodeBlocks decodes items of all the blocks contained within
+// data (starting with block firstBlock) and passes them to fn
+// along with their absolute positions.
+func (bd *blockDirectory) decodeBlocks(data []byte, firstBlock int, fn func(idx int, item blockItem)) error {
+	pos := 0
+	for idx := firstBlock * bd.blockSize; idx < bd.numItems && pos < len(data); {
+		var item blockItem
+		for i := 0; i < bd.blockSize && idx < bd.numItems; i++ {
+			for f := 0; f < bd.numFields; f++ {
+				v, n := binary.Varint(data[pos:])
+				if n <= 0 {
+					return fmt.Errorf("Corrupted compressed column data at item %d", idx)
+				}
+				item[f] += v
+				pos += n
+			}
+			fn(idx, item)
+			idx++
+		}
+	}
+	return nil
+}
+
+// validateOffsets checks that block offsets are monotonic
+// and within a data section of a specified length
+func (bd *blockDirectory) validateOffsets(dataLen int64) error {
+	if bd.offsets[0] != 0 {
+		return fmt.Errorf("Invalid block directory")
+	}
+	for i := 1; i < len(bd.offsets); i++ {
+		if bd.offsets[i] < bd.offsets[i-1] {
+			return fmt.Errorf("Invalid block directory")
+		}
+	}
+	if bd.offsets[bd.numBlocks()] > dataLen {
+		return fmt.Errorf("Compressed column data truncated")
+	}
+	return nil
+}
+
+// validateBlocks decodes all the blocks of a whole compressed
+// column data to make sure each of them contains the declared
+// number of valid items
+func (bd *blockDirectory) validateBlocks(data []byte) error {
+	for b := 0; b < bd.numBlocks(); b++ {
+		begin, end := bd.blockRange(b, b)
+		numDecoded := 0
+		err := bd.decodeBlocks(data[begin:end], b, func(idx int, item blockItem) {
+			numDecoded++
+		})
+		if err != nil {
+			return err
+		}
+		expected := bd.numItems - b*bd.blockSize
+		if expected > bd.blockSize {
+			expected = bd.blockSize
+		}
+		if numDecoded != expected {
+			return fmt.Errorf("Invalid number of items in block %d", b)
+		}
+	}
+	return nil
+}
+
+// decodeItem decodes a single item from a whole compressed
+// column data (e.g. a memory mapped file). The data must be
+// validated first (see parseBlockDirectory).
+func (bd *blockDirectory) decodeItem(data []byte, idx int) blockItem {
+	blockIdx := bd.blockOf(idx)
+	pos := int(bd.dataStart + bd.offsets[blockIdx])
+	var item blockItem
+	for i := blockIdx * bd.blockSize; i <= idx; i++ {
+		for f := 0; f < bd.numFields; f++ {
+			v, n := binary.Varint(data[pos:])
+			item[f] += v
+			pos += n
+		}
+	}
+	return item
+}
+
+// hasCompressedMagic tests whether a provided file header
+// starts with the compressed column magic value
+func hasCompressedMagic(header []byte) bool {
+	return len(header) >= len(compressedColumnMagic) &&
+		bytes.Equal(header[:len(compressedColumnMagic)], compressedColumnMagic)
+}
+
+// isCompressedFile tests whether a file starts with the compressed
+// column magic value. The file position is reset to the beginning.
+func isCompressedFile(f *os.File) (bool, error) {
+	header := make([]byte, len(compressedColumnMagic))
+	_, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return false, err
+	}
+	return hasCompressedMagic(header), nil
+}
+
+// readBlockDirectory reads a compressed column header
+// (including the magic value). The size of the whole column
+// data limits the number of blocks the directory may contain.
+func readBlockDirectory(r io.Reader, size int64) (*blockDirectory, error) {
+	header := make([]int64, 4)
+	if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+		return nil, err
+	}
+	if !hasCompressedMagic(int64sToBytes(header[:1])) {
+		return nil, fmt.Errorf("Not a compressed column")
+	}
+	ans := &blockDirectory{
+		numItems:  int(header[1]),
+		blockSize: int(header[2]),
+		numFields: int(header[3]),
+	}
+	if ans.numItems < 0 || ans.blockSize <= 0 || ans.numFields <= 0 || ans.numFields > maxBlockFields {
+		return nil, fmt.Errorf("Invalid compressed column header")
+	}
+	numBlocks := ans.numItems / ans.blockSize
+	if ans.numItems%ans.blockSize > 0 {
+		numBlocks++
+	}
+	// each block requires an offset stored in the header
+	if maxBlocks := (size-int64(8*len(header)))/8 - 1; int64(numBlocks) > maxBlocks {
+		return nil, fmt.Errorf("Invalid compressed column header (%d items in blocks of %d exceed data size %d)",
+			ans.numItems, ans.blockSize, size)
+	}
+	ans.offsets = make([]int64, numBlocks+1)
+	if err := binary.Read(r, binary.LittleEndian, ans.offsets); err != nil {
+		return nil, err
+	}
+	ans.dataStart = int64(8 * (len(header) + len(ans.offsets)))
+	return ans, nil
+}
+
+func int64sToBytes(v []int64) []byte {
+	ans := make([]byte, 8*len(v))
+	for i, x := range v {
+		binary.LittleEndian.PutUint64(ans[8*i:], uint64(x))
+	}
+	return ans
+}
+
+// writeCompressed writes numItems items with numFields fields
+// each (obtained via getItem) in the compressed format.
+func writeCompressed(w io.Writer, numItems int, numFields int, getItem func(idx int) blockItem) error {
+	numBlocks := (numItems + DefaultBlockSize - 1) / DefaultBlockSize
+	offsets := make([]int64, numBlocks+1)
+	var data bytes.Buffer
+	buff := make([]byte, binary.MaxVarintLen64)
+	for b := 0; b < numBlocks; b++ {
+		offsets[b] = int64(data.Len())
+		var prev blockItem
+		for i := b * DefaultBlockSize; i < (b+1)*DefaultBlockSize && i < numItems; i++ {
+			item := getItem(i)
+			for f := 0; f < numFields; f++ {
+				n := binary.PutVarint(buff, item[f]-prev[f])
+				data.Write(buff[:n])
+			}
+			prev = item
+		}
+	}
+	offsets[numBlocks] = int64(data.Len())
+	if _, err := w.Write(compressedColumnMagic); err != nil {
+		return err
+	}
+	header := []int64{int64(numItems), DefaultBlockSize, int64(numFields)}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, offsets); err != nil {
+		return err
+	}
+	_, err := data.WriteTo(w)
+	return err
+}
+
+// loadCompressedChunk reads and decodes blocks containing
+// items [fromIdx, toIdx] from a compressed column file.
+// The function returns the position of the first decoded item.
+func loadCompressedChunk(dataPath string, bd *blockDirectory, fromIdx int, toIdx int, fn func(idx int, item blockItem)) (int, error) {
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	fromBlock := bd.blockOf(fromIdx)
+	toBlock := bd.blockOf(toIdx)
+	if toBlock >= bd.numBlocks() {
+		toBlock = bd.numBlocks() - 1
+	}
+	if fromBlock > toBlock {
+		return fromIdx, nil
+	}
+	begin, end := bd.blockRange(fromBlock, toBlock)
+	data := make([]byte, end-begin)
+	if _, err := f.ReadAt(data, begin); err != nil {
+		return 0, gerrors.NewCorruptDataError(dataPath, "cannot read blocks %d-%d: %s", fromBlock, toBlock, err)
+	}
+	if err := bd.decodeBlocks(data, fromBlock, fn); err != nil {
+		return 0, gerrors.NewCorruptDataError(dataPath, "%s", err)
+	}
+	return fromBlock * bd.blockSize, nil
+}
+
+// openBlockDirectory reads a block directory of a compressed
+// column file. In case the file is in the plain format,
+// nil is returned.
+func openBlockDirectory(dataPath string) (*blockDirectory, error) {
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	compressed, err := isCompressedFile(f)
+	if err != nil || !compressed {
+		return nil, err
+	}
+	return readFileBlockDirectory(f)
+}
+
+// readFileBlockDirectory reads a block directory of an opened
+// compressed column file and checks its offsets against
+// the file size
+func readFileBlockDirectory(f *os.File) (*blockDirectory, error) {
+	finfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	ans, err := readBlockDirectory(bufio.NewReader(f), finfo.Size())
+	if err != nil {
+		return nil, gerrors.NewCorruptDataError(f.Name(), "%s", err)
+	}
+	if err := ans.validateOffsets(finfo.Size() - ans.dataStart); err != nil {
+		return nil, gerrors.NewCorruptDataError(f.Name(), "%s", err)
+	}
+	return ans, nil
+}
+
+// parseBlockDirectory reads a block directory from a whole
+// compressed column data (e.g. a memory mapped file). As items
+// are decoded directly from the data, all the blocks are
+// validated too.
+func parseBlockDirectory(data []byte) (*blockDirectory, error) {
+	ans, err := readBlockDirectory(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	if err := ans.validateOffsets(int64(len(data)) - ans.dataStart); err != nil {
+		return nil, err
+	}
+	if err := ans.validateBlocks(data); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
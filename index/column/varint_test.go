@@ -0,0 +1,209 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package column
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func createTestingIndexColumn(size int) *IndexColumn {
+	ic := NewIndexColumn(size)
+	for i := 0; i < size; i++ {
+		ic.Set(i, &IndexItem{Index: (i * 37) % 101, UpTo: i * 3})
+	}
+	return ic
+}
+
+func TestCompressedIndexColumnLoadChunk(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(1000)
+	assert.Nil(t, ic.SaveAs(0, dirPath, VarintFormat))
+
+	col := NewBoundIndexColumn(CreateColIdxPath(0, dirPath))
+	col.LoadChunk(130, 520)
+	for i := 129; i <= 520; i++ {
+		assert.Equal(t, ic.Item(i), col.Item(i))
+	}
+	col.LoadWholeChunk()
+	assert.Equal(t, 1000, col.Size())
+	for i := 0; i < 1000; i++ {
+		assert.Equal(t, ic.Item(i), col.Item(i))
+	}
+}
+
+func TestCompressedIndexColumnIsSmaller(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(1000)
+	assert.Nil(t, ic.Save(0, dirPath))
+	assert.Nil(t, ic.SaveAs(1, dirPath, VarintFormat))
+	plain, _ := os.Stat(CreateColIdxPath(0, dirPath))
+	compressed, _ := os.Stat(CreateColIdxPath(1, dirPath))
+	assert.True(t, compressed.Size() < plain.Size()/2)
+}
+
+func TestCompressedMmapIndexColumn(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(200)
+	assert.Nil(t, ic.SaveAs(0, dirPath, VarintFormat))
+
+	mcol, err := OpenMmapIndexColumn(CreateColIdxPath(0, dirPath))
+	assert.Nil(t, err)
+	assert.Equal(t, 200, mcol.Size())
+	for i := 0; i < 200; i++ {
+		assert.Equal(t, ic.Item(i), mcol.Item(i))
+	}
+}
+
+func TestCompressedEmptyIndexColumn(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	assert.Nil(t, NewIndexColumn(0).SaveAs(0, dirPath, VarintFormat))
+	col := NewBoundIndexColumn(CreateColIdxPath(0, dirPath))
+	col.LoadWholeChunk()
+	assert.Equal(t, 0, col.Size())
+}
+
+func TestCompressedCountsColumn(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	col := NewCountsColumn(300)
+	for i := 0; i < 300; i++ {
+		col.Set(i, AttrVal((i*7919)%1000))
+	}
+	assert.Nil(t, SaveCountsColumn(col, dirPath, VarintFormat))
+
+	fcol, err := LoadCountsColumn(dirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, fcol.StoredSize())
+	fcol.LoadChunk(70, 250)
+	for i := 69; i <= 250; i++ {
+		assert.Equal(t, col.Get(i), fcol.Get(i))
+	}
+	mcol, err := LoadStoredCountsColumn(dirPath, MmapStorage)
+	assert.Nil(t, err)
+	assert.Equal(t, 300, mcol.Size())
+	for i := 0; i < 300; i++ {
+		assert.Equal(t, col.Get(i), mcol.Get(i))
+	}
+}
+
+func TestCompressedTruncated(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(100)
+	assert.Nil(t, ic.SaveAs(0, dirPath, VarintFormat))
+	colPath := CreateColIdxPath(0, dirPath)
+	finfo, _ := os.Stat(colPath)
+	assert.Nil(t, os.Truncate(colPath, finfo.Size()-10))
+	_, err = OpenMmapIndexColumn(colPath)
+	assert.Error(t, err)
+}
+
+// corruptCompressedFile overwrites bytes of a compressed
+// column file at a specified position
+func corruptCompressedFile(t *testing.T, colPath string, pos int, data []byte) {
+	content, err := ioutil.ReadFile(colPath)
+	assert.Nil(t, err)
+	copy(content[pos:], data)
+	assert.Nil(t, ioutil.WriteFile(colPath, content, 0644))
+}
+
+func TestCompressedInvalidOffsets(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(200)
+	assert.Nil(t, ic.SaveAs(0, dirPath, VarintFormat))
+	colPath := CreateColIdxPath(0, dirPath)
+	// the second block offset (after the magic value and 3 header values)
+	offset := make([]byte, 8)
+	binary.LittleEndian.PutUint64(offset, 1<<40)
+	corruptCompressedFile(t, colPath, 40, offset)
+
+	_, err = OpenMmapIndexColumn(colPath)
+	assert.True(t, gerrors.IsCorruptData(err))
+	col := NewBoundIndexColumn(colPath)
+	assert.True(t, gerrors.IsCorruptData(col.LoadChunk(0, 100)))
+	_, err = ScanIndexColumn(colPath, func(idx int, item IndexItem) {})
+	assert.True(t, gerrors.IsCorruptData(err))
+}
+
+func TestCompressedInvalidBlockData(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	ic := createTestingIndexColumn(200)
+	assert.Nil(t, ic.SaveAs(0, dirPath, VarintFormat))
+	colPath := CreateColIdxPath(0, dirPath)
+	finfo, _ := os.Stat(colPath)
+	// an unterminated varint at the end of the last block
+	corruptCompressedFile(t, colPath, int(finfo.Size())-2, []byte{0xff, 0xff})
+
+	_, err = OpenMmapIndexColumn(colPath)
+	assert.True(t, gerrors.IsCorruptData(err))
+	col := NewBoundIndexColumn(colPath)
+	assert.True(t, gerrors.IsCorruptData(col.LoadWholeChunk()))
+}
+
+// writeCompressedHeader writes a compressed column file
+// containing a header with specified values only
+func writeCompressedHeader(t *testing.T, colPath string, values ...int64) {
+	data := append([]byte{}, compressedColumnMagic...)
+	data = append(data, int64sToBytes(values)...)
+	assert.Nil(t, ioutil.WriteFile(colPath, data, 0644))
+}
+
+func assertCorruptIndexColumn(t *testing.T, colPath string) {
+	_, err := ScanIndexColumn(colPath, func(idx int, item IndexItem) {})
+	assert.True(t, gerrors.IsCorruptData(err))
+	assert.True(t, gerrors.IsCorruptData(NewBoundIndexColumn(colPath).LoadWholeChunk()))
+	_, err = OpenMmapIndexColumn(colPath)
+	assert.True(t, gerrors.IsCorruptData(err))
+}
+
+func TestCompressedTruncatedHeader(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	colPath := CreateColIdxPath(0, dirPath)
+	writeCompressedHeader(t, colPath, 100, DefaultBlockSize)
+	assertCorruptIndexColumn(t, colPath)
+}
+
+func TestCompressedOversizedHeader(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	colPath := CreateColIdxPath(0, dirPath)
+	writeCompressedHeader(t, colPath, 1<<61, 1, 2, 0, 0)
+	assertCorruptIndexColumn(t, colPath)
+	writeCompressedHeader(t, colPath, 100, 0, 2, 0, 0)
+	assertCorruptIndexColumn(t, colPath)
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+// searchConcurrently runs many searches of different parts
+// of a shared index at once and compares them with results
+// of the same searches performed one by one
+func searchConcurrently(t *testing.T, idx *NgramIndex) {
+	queries := [][]RowRange{
+		{{From: 0, To: 10}},
+		{{From: 990, To: 1010}, {From: 2400, To: 2499}},
+		{{From: 1500, To: 1500}},
+		{{From: 0, To: testingLargeIndexWords - 1}},
+		{{From: 700, To: 1300}},
+	}
+	expected := make([][][]int, len(queries))
+	for i, q := range queries {
+		si := OpenSearchableIndex(context.Background(), idx, nil)
+		si.SetNumWorkers(1)
+		res, err := si.GetNgramsInRanges(q)
+		assert.Nil(t, err)
+		expected[i], _ = collectNgrams(res)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < len(queries); i++ {
+				qi := (g + i) % len(queries)
+				si := OpenSearchableIndex(context.Background(), idx, nil)
+				si.SetNumWorkers(g%3 + 1)
+				res, err := si.GetNgramsInRanges(queries[qi])
+				assert.Nil(t, err)
+				ngrams, _ := collectNgrams(res)
+				assert.Equal(t, expected[qi], ngrams)
+
+				// the old-style API loading data explicitly
+				row := queries[qi][0].From
+				assert.Nil(t, si.LoadRange(row, row))
+				ngrams, _ = collectNgrams(si.GetNgramsOfColIdx(row))
+				assert.Equal(t, [][]int{{row, row + 1}}, ngrams[:1])
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestConcurrentSearches(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	searchConcurrently(t, idx)
+}
+
+func TestConcurrentSearchesCompressed(t *testing.T) {
+	dirPath := saveTestingLargeIndexAs(t, column.VarintFormat)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	searchConcurrently(t, idx)
+}
+
+func TestConcurrentSearchesMmap(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadRotatedNgramIndex(dirPath, 0, []string{}, column.MmapStorage)
+	assert.Nil(t, err)
+	searchConcurrently(t, idx)
+}
+
+func TestConcurrentSearchesMetadata(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			si := OpenSearchableIndex(context.Background(), idx, nil)
+			genre := []string{"fiction", "news", "poetry"}[g%3]
+			filter, err := idx.NewMetadataFilter([]AttrConstraint{{Attr: "doc.genre", Values: []string{genre}}})
+			assert.Nil(t, err)
+			si.SetMetadataFilter(filter)
+			res, err := si.GetAllNgrams()
+			assert.Nil(t, err)
+			res.ResetCursor()
+			for res.HasNext() {
+				item := res.Next()
+				assert.Equal(t, genre, item.Metadata[0])
+			}
+		}(g)
+	}
+	wg.Wait()
+}
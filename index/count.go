@@ -0,0 +1,89 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+// NgramStats contains aggregated counts of a set of n-grams
+type NgramStats struct {
+	// NumNgrams is a number of distinct n-grams
+	NumNgrams int `json:"numNgrams"`
+
+	// TotalCount is a sum of counts of all the n-grams
+	TotalCount int `json:"totalCount"`
+
+	// MinCount and MaxCount are the smallest and the largest
+	// n-gram counts (both are zero in case of no n-grams)
+	MinCount int `json:"minCount"`
+	MaxCount int `json:"maxCount"`
+}
+
+func (ns *NgramStats) add(count int) {
+	if ns.NumNgrams == 0 || count < ns.MinCount {
+		ns.MinCount = count
+	}
+	if count > ns.MaxCount {
+		ns.MaxCount = count
+	}
+	ns.NumNgrams++
+	ns.TotalCount += count
+}
+
+// Merge adds counts from other stats calculated
+// from a disjoint set of n-grams
+func (ns *NgramStats) Merge(other NgramStats) {
+	if other.NumNgrams == 0 {
+		return
+	}
+	if ns.NumNgrams == 0 || other.MinCount < ns.MinCount {
+		ns.MinCount = other.MinCount
+	}
+	if other.MaxCount > ns.MaxCount {
+		ns.MaxCount = other.MaxCount
+	}
+	ns.NumNgrams += other.NumNgrams
+	ns.TotalCount += other.TotalCount
+}
+
+// countNgramsInRange is like getNgramsInRange but it only
+// aggregates counts without creating any result items
+func (n *NgramIndex) countNgramsInRange(fromPos int, toPos int, filter searchFilter) NgramStats {
+	var ans NgramStats
+	n.forEachNgram(fromPos, toPos, nil, filter, func(ngram []int, count int, rows []int, path []int) bool {
+		ans.add(count)
+		return true
+	})
+	return ans
+}
+
+// CountNgramsOf is like GetNgramsOf but it returns
+// only aggregated counts of the n-grams
+func (si *SearchableIndex) CountNgramsOf(word string) (NgramStats, error) {
+	fromRow, toRow, err := si.loadWord(word)
+	if err != nil || fromRow == -1 {
+		return NgramStats{}, err
+	}
+	ans := si.index.countNgramsInRange(fromRow, toRow, si.filter)
+	return ans, si.Err()
+}
+
+// CountAllNgrams is like GetAllNgrams but it returns
+// only aggregated counts of the n-grams
+func (si *SearchableIndex) CountAllNgrams() (NgramStats, error) {
+	size, err := si.loadAll()
+	if err != nil || size == 0 {
+		return NgramStats{}, err
+	}
+	ans := si.index.countNgramsInRange(0, size-1, si.filter)
+	return ans, si.Err()
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNgramStatsAdd(t *testing.T) {
+	var stats NgramStats
+	for _, v := range []int{3, 1, 7} {
+		stats.add(v)
+	}
+	assert.Equal(t, NgramStats{NumNgrams: 3, TotalCount: 11, MinCount: 1, MaxCount: 7}, stats)
+}
+
+func TestNgramStatsMerge(t *testing.T) {
+	stats := NgramStats{NumNgrams: 2, TotalCount: 5, MinCount: 2, MaxCount: 3}
+	stats.Merge(NgramStats{})
+	assert.Equal(t, NgramStats{NumNgrams: 2, TotalCount: 5, MinCount: 2, MaxCount: 3}, stats)
+	stats.Merge(NgramStats{NumNgrams: 1, TotalCount: 1, MinCount: 1, MaxCount: 1})
+	assert.Equal(t, NgramStats{NumNgrams: 3, TotalCount: 6, MinCount: 1, MaxCount: 3}, stats)
+
+	var empty NgramStats
+	empty.Merge(NgramStats{NumNgrams: 1, TotalCount: 4, MinCount: 4, MaxCount: 4})
+	assert.Equal(t, NgramStats{NumNgrams: 1, TotalCount: 4, MinCount: 4, MaxCount: 4}, empty)
+}
+
+func TestCountNgramsInRange(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	assert.Nil(t, idx.LoadRange(0, 1))
+	stats := idx.countNgramsInRange(0, 1, searchFilter{})
+	assert.Equal(t, NgramStats{NumNgrams: 3, TotalCount: 10, MinCount: 1, MaxCount: 5}, stats)
+
+	matcher := func(ngram []int) bool { return ngram[1] == 2 }
+	stats = idx.countNgramsInRange(0, 1, searchFilter{matcher: matcher})
+	assert.Equal(t, NgramStats{NumNgrams: 2, TotalCount: 5, MinCount: 1, MaxCount: 4}, stats)
+}
@@ -29,21 +29,30 @@ import (
 func saveNgrams(ngramList builder.NgramList, minFreq int, saveFile *os.File) error {
 	fw := bufio.NewWriter(saveFile)
 	defer fw.Flush()
-	ngramList.ForEach(func(item *builder.NgramRecord) {
-		if item.Count >= minFreq {
-			fw.WriteString(fmt.Sprintf("%s\t%d\n", strings.Join(item.Ngram, "\t"), item.Count))
+	builder.ForEachNgramGroup(ngramList, func(records []*builder.NgramRecord, total int) {
+		if total >= minFreq {
+			fw.WriteString(fmt.Sprintf("%s\t%d\n", strings.Join(records[0].Ngram, "\t"), total))
 		}
 	})
 	return nil
 }
 
-func ExtractUniqueNgrams(conf *gconf.IndexBuilderConf, ngramSize int) {
-	builder := builder.CreateIndexBuilder(conf, ngramSize)
-	vertigo.ParseVerticalFile(conf.GetParserConf(), builder)
+func ExtractUniqueNgrams(conf *gconf.IndexBuilderConf, ngramSize int) error {
+	builder, err := builder.CreateIndexBuilder(conf, ngramSize)
+	if err != nil {
+		return err
+	}
+	if err := vertigo.ParseVerticalFile(conf.GetParserConf(), builder); err != nil {
+		return err
+	}
 	sortedIndexTmp, err := builder.GetOutputFiles().GetSortedIndexTmpPath(os.O_CREATE | os.O_TRUNC | os.O_WRONLY)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	defer sortedIndexTmp.Close()
+	if err := saveNgrams(builder.GetNgramList(), conf.MinNgramFreq, sortedIndexTmp); err != nil {
+		return err
 	}
-	saveNgrams(builder.GetNgramList(), conf.MinNgramFreq, sortedIndexTmp)
 	log.Printf("Saved raw n-gram file %s", sortedIndexTmp.Name())
+	return nil
 }
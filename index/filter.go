@@ -0,0 +1,164 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+// This file contains filtering of n-grams by values of their
+// metadata attributes. Constraints are resolved against attribute
+// dictionaries to sets of encoded values so the filtering itself
+// is performed on the (integer) metadata columns.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+// AttrConstraint specifies allowed values of a metadata
+// attribute. A value matches either in case it equals to
+// one of Values or in case it matches Regexp (if specified).
+type AttrConstraint struct {
+	Attr   string
+	Values []string
+	Regexp string
+}
+
+func (ac AttrConstraint) String() string {
+	if ac.Regexp != "" {
+		return fmt.Sprintf("%s~%s", ac.Attr, ac.Regexp)
+	}
+	return fmt.Sprintf("%s=%v", ac.Attr, ac.Values)
+}
+
+// CountRange specifies allowed total counts of n-grams
+// (both ends included). Zero values mean no limit.
+type CountRange struct {
+	Min int
+	Max int
+}
+
+func (cr CountRange) contains(count int) bool {
+	return count >= cr.Min && (cr.Max == 0 || count <= cr.Max)
+}
+
+// WordRange is an interval of word dictionary indices (both
+// ends included). As words are indexed in alphabetical order,
+// a range can represent e.g. all the words with a prefix.
+type WordRange struct {
+	From int
+	To   int
+}
+
+// NgramMatcher tests whether an n-gram (in the original,
+// i.e. unrotated, order) should be accepted
+type NgramMatcher func(ngram []int) bool
+
+// searchFilter joins all the constraints applied
+// while walking the n-gram tree. The walking also
+// stops once ctx is done or the budget is exhausted.
+type searchFilter struct {
+	ctx      context.Context
+	budget   *ResultBudget
+	metadata *MetadataFilter
+	counts   CountRange
+	matcher  NgramMatcher
+
+	// words contains ranges of allowed words for
+	// individual columns (nil = any word)
+	words []*WordRange
+}
+
+// isCancelled tests whether the search context is done
+func (sf searchFilter) isCancelled() bool {
+	return sf.ctx != nil && sf.ctx.Err() != nil
+}
+
+// MetadataFilter is a list of attribute constraints resolved
+// against attribute dictionaries of a specific index. A row
+// is accepted in case all the constraints are satisfied.
+type MetadataFilter struct {
+	attrIdxs []int
+
+	// allowed contains for each constraint a flag for
+	// each encoded value of the respective attribute
+	allowed [][]bool
+}
+
+// accepts tests whether metadata of a specified
+// row (within the last column) match the filter
+func (mf *MetadataFilter) accepts(metadata *column.MetadataReader, row int) bool {
+	for i, attrIdx := range mf.attrIdxs {
+		v := int(metadata.GetValue(attrIdx, row))
+		if v < 0 || v >= len(mf.allowed[i]) || !mf.allowed[i][v] {
+			return false
+		}
+	}
+	return true
+}
+
+func resolveConstraint(dict *column.ArgsDictReader, constraint AttrConstraint) ([]bool, error) {
+	var match func(v string) bool
+	if constraint.Regexp != "" {
+		rg, err := regexp.Compile(fmt.Sprintf("^(%s)$", constraint.Regexp))
+		if err != nil {
+			return nil, &gerrors.InvalidArgumentError{Arg: "filter", Reason: err.Error()}
+		}
+		match = rg.MatchString
+
+	} else {
+		values := make(map[string]bool)
+		for _, v := range constraint.Values {
+			values[v] = true
+		}
+		match = func(v string) bool {
+			return values[v]
+		}
+	}
+	ans := make([]bool, dict.Size())
+	for _, v := range dict.FindMatching(match) {
+		ans[v] = true
+	}
+	return ans, nil
+}
+
+// NewMetadataFilter resolves attribute constraints against
+// the index attribute dictionaries. In case there are
+// no constraints, nil is returned.
+func (n *NgramIndex) NewMetadataFilter(constraints []AttrConstraint) (*MetadataFilter, error) {
+	if len(constraints) == 0 {
+		return nil, nil
+	}
+	ans := &MetadataFilter{
+		attrIdxs: make([]int, len(constraints)),
+		allowed:  make([][]bool, len(constraints)),
+	}
+	for i, c := range constraints {
+		ans.attrIdxs[i] = -1
+		if n.metadata != nil {
+			ans.attrIdxs[i] = n.metadata.Dicts().GetArgIdx(c.Attr)
+		}
+		if ans.attrIdxs[i] == -1 {
+			return nil, &gerrors.UnknownAttributeError{Attr: c.Attr, Available: n.AttrNames()}
+		}
+		var err error
+		ans.allowed[i], err = resolveConstraint(n.metadata.Dicts()[ans.attrIdxs[i]], c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ans, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+// saveTestingGenreIndex saves a 2-gram index with
+// attribute doc.genre (values fiction, news, poetry)
+func saveTestingGenreIndex(t *testing.T) string {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	d := NewDynamicNgramIndex(2, 4, map[string]string{"doc.genre": "col8"})
+	var genres []column.AttrVal
+	d.MetadataWriter().ForEachArg(func(i int, ad *column.ArgsDictWriter, col column.AttrValColumn) {
+		for _, v := range []string{"fiction", "news", "poetry"} {
+			genres = append(genres, column.AttrVal(ad.AddValue(v)))
+		}
+	})
+	d.AddNgram([]int{0, 1}, 3, []column.AttrVal{genres[0]})
+	d.AddNgram([]int{0, 1}, 2, []column.AttrVal{genres[1]})
+	d.AddNgram([]int{0, 2}, 1, []column.AttrVal{genres[1]})
+	d.AddNgram([]int{1, 2}, 4, []column.AttrVal{genres[2]})
+	d.Finish()
+	assert.Nil(t, d.Save(dirPath))
+	return dirPath
+}
+
+func searchFiltered(t *testing.T, dirPath string, constraints ...AttrConstraint) ([][]int, []int) {
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	assert.Nil(t, idx.LoadRange(0, 1))
+	filter, err := idx.NewMetadataFilter(constraints)
+	assert.Nil(t, err)
+	return collectNgrams(idx.getNgramsInRange(0, 1, searchFilter{metadata: filter}))
+}
+
+func TestMetadataFilterEquality(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	ngrams, counts := searchFiltered(t, dirPath, AttrConstraint{Attr: "doc.genre", Values: []string{"news"}})
+	assert.Equal(t, [][]int{{0, 1}, {0, 2}}, ngrams)
+	assert.Equal(t, []int{2, 1}, counts)
+}
+
+func TestMetadataFilterSet(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	ngrams, counts := searchFiltered(t, dirPath,
+		AttrConstraint{Attr: "doc.genre", Values: []string{"fiction", "poetry", "foo"}})
+	assert.Equal(t, [][]int{{0, 1}, {1, 2}}, ngrams)
+	assert.Equal(t, []int{3, 4}, counts)
+}
+
+func TestMetadataFilterRegexp(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	ngrams, counts := searchFiltered(t, dirPath, AttrConstraint{Attr: "doc.genre", Regexp: "n.*|p.*"})
+	assert.Equal(t, [][]int{{0, 1}, {0, 2}, {1, 2}}, ngrams)
+	assert.Equal(t, []int{2, 1, 4}, counts)
+}
+
+func TestMetadataFilterNoMatch(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	ngrams, _ := searchFiltered(t, dirPath, AttrConstraint{Attr: "doc.genre", Values: []string{"foo"}})
+	assert.Equal(t, [][]int{}, ngrams)
+}
+
+func TestMetadataFilterInvalid(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	_, err = idx.NewMetadataFilter([]AttrConstraint{{Attr: "doc.foo", Values: []string{"x"}}})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	_, err = idx.NewMetadataFilter([]AttrConstraint{{Attr: "doc.genre", Regexp: "(foo"}})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	filter, err := idx.NewMetadataFilter([]AttrConstraint{})
+	assert.Nil(t, err)
+	assert.Nil(t, filter)
+}
+
+func TestCountRange(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	assert.Nil(t, idx.LoadRange(0, 1))
+	ngrams, counts := collectNgrams(idx.getNgramsInRange(0, 1, searchFilter{counts: CountRange{Min: 4}}))
+	assert.Equal(t, [][]int{{0, 1}, {1, 2}}, ngrams)
+	assert.Equal(t, []int{5, 4}, counts)
+
+	ngrams, _ = collectNgrams(idx.getNgramsInRange(0, 1, searchFilter{counts: CountRange{Min: 2, Max: 4}}))
+	assert.Equal(t, [][]int{{1, 2}}, ngrams)
+}
+
+func TestCountRangeFiltered(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	assert.Nil(t, idx.LoadRange(0, 1))
+	filter, err := idx.NewMetadataFilter([]AttrConstraint{{Attr: "doc.genre", Values: []string{"news"}}})
+	assert.Nil(t, err)
+	// only the counts matching the metadata filter are summed
+	ngrams, counts := collectNgrams(idx.getNgramsInRange(0, 1, searchFilter{metadata: filter, counts: CountRange{Min: 2}}))
+	assert.Equal(t, [][]int{{0, 1}}, ngrams)
+	assert.Equal(t, []int{2}, counts)
+}
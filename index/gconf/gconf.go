@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/tomachalek/gloomy/wdict"
 	"github.com/tomachalek/vertigo"
 )
 
@@ -39,19 +40,50 @@ type SearchConf struct {
 	DataPath      string `json:"dataPath"`
 	ServerPort    int    `json:"serverPort"`
 	ServerAddress string `json:"serverAddress"`
+
+	// CorpusCacheSize specifies max. number of corpora
+	// kept opened by the search service
+	CorpusCacheSize int `json:"corpusCacheSize"`
+
+	// CorpusCacheMemoryMB specifies an approximate memory
+	// limit for opened corpora (0 = no limit)
+	CorpusCacheMemoryMB int `json:"corpusCacheMemoryMB"`
+
+	// PreloadCorpora lists corpora opened when the search
+	// service starts (others are opened on first request)
+	PreloadCorpora []string `json:"preloadCorpora"`
+
+	// ColumnStorage specifies how index columns are accessed:
+	// "file" (default) loads required chunks into memory,
+	// "mmap" uses memory mapped files
+	ColumnStorage string `json:"columnStorage"`
+
+	// QueryTimeoutMs specifies max. duration of a single
+	// query in milliseconds (0 = no limit)
+	QueryTimeoutMs int `json:"queryTimeoutMs"`
+
+	// MaxResultItems specifies max. number of n-grams
+	// a single query may collect (0 = no limit)
+	MaxResultItems int `json:"maxResultItems"`
+
+	// SearchWorkers specifies max. number of workers searching
+	// a single query concurrently (0 = number of CPUs)
+	SearchWorkers int `json:"searchWorkers"`
 }
 
-func LoadSearchConf(confPath string) *SearchConf {
+// LoadSearchConf loads a search service configuration
+// from a JSON file
+func LoadSearchConf(confPath string) (*SearchConf, error) {
 	rawData, err := ioutil.ReadFile(confPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	var conf SearchConf
 	err = json.Unmarshal(rawData, &conf)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("Invalid configuration %s: %s", confPath, err)
 	}
-	return &conf
+	return &conf, nil
 }
 
 // ---------------------------------------------------------
@@ -61,6 +93,17 @@ type NgramFilterConf struct {
 	Fn  string `json:"fn"`
 }
 
+// PosAttrConf specifies a positional attribute indexed
+// along with word forms
+type PosAttrConf struct {
+	Name string `json:"name"`
+
+	// Idx is a position of the attribute within token
+	// attributes of a vertical file (the word form excluded,
+	// i.e. the same as TagAttrIdx)
+	Idx int `json:"idx"`
+}
+
 type IndexBuilderConf struct {
 	vertigo.ParserConf
 
@@ -89,6 +132,35 @@ type IndexBuilderConf struct {
 	TmpDir string `json:"tmpDir"`
 
 	ProcChunkSize int `json:"procChunkSize"`
+
+	RotatedIndices bool `json:"rotatedIndices"`
+
+	CompressColumns bool `json:"compressColumns"`
+
+	// PosAttrs specifies positional attributes (e.g. lemma, tag)
+	// indexed along with word forms in an additional index of
+	// n-grams of attribute tuples (empty = no such index)
+	PosAttrs []PosAttrConf `json:"posAttrs"`
+
+	// PreserveCase disables lowercasing of words
+	PreserveCase bool `json:"preserveCase"`
+
+	// UnicodeNormalization specifies a Unicode normalization
+	// form applied to words ("nfc", "nfkc", empty = none)
+	UnicodeNormalization string `json:"unicodeNormalization"`
+
+	// StripDiacritics removes diacritical marks from words
+	StripDiacritics bool `json:"stripDiacritics"`
+}
+
+// Normalization returns a normalization of words
+// specified by the configuration
+func (i *IndexBuilderConf) Normalization() wdict.Normalization {
+	return wdict.Normalization{
+		PreserveCase:    i.PreserveCase,
+		UnicodeForm:     i.UnicodeNormalization,
+		StripDiacritics: i.StripDiacritics,
+	}
 }
 
 func (i *IndexBuilderConf) GetParserConf() *vertigo.ParserConf {
@@ -104,17 +176,50 @@ func (i *IndexBuilderConf) GetParserConf() *vertigo.ParserConf {
 	}
 }
 
-func LoadIndexBuilderConf(confPath string) *IndexBuilderConf {
+// validatePosAttrs tests whether positional attributes
+// have unique names other than the reserved "word"
+func (i *IndexBuilderConf) validatePosAttrs() error {
+	names := map[string]bool{"word": true}
+	for _, attr := range i.PosAttrs {
+		if attr.Name == "" {
+			return fmt.Errorf("missing name of a positional attribute")
+		}
+		if names[attr.Name] {
+			return fmt.Errorf("duplicate or reserved positional attribute name %s", attr.Name)
+		}
+		if attr.Idx < 0 {
+			return fmt.Errorf("invalid index %d of positional attribute %s", attr.Idx, attr.Name)
+		}
+		names[attr.Name] = true
+	}
+	return nil
+}
+
+// LoadIndexBuilderConf loads an index builder configuration
+// from a JSON file
+func LoadIndexBuilderConf(confPath string) (*IndexBuilderConf, error) {
 	rawData, err := ioutil.ReadFile(confPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	var conf IndexBuilderConf
 	err = json.Unmarshal(rawData, &conf)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("Invalid configuration %s: %s", confPath, err)
+	}
+	for attr, colType := range conf.Args {
+		if colType != "col8" && colType != "col32" {
+			return nil, fmt.Errorf("Invalid configuration %s: unknown column type %s of attribute %s",
+				confPath, colType, attr)
+		}
 	}
-	return &conf
+	if err := conf.validatePosAttrs(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration %s: %s", confPath, err)
+	}
+	if err := conf.Normalization().Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid configuration %s: %s", confPath, err)
+	}
+	return &conf, nil
 }
 
 // ---------------------------------------------------------
@@ -138,12 +243,12 @@ func (o *OutputFiles) GetIndexDir() string {
 	return o.indexDir
 }
 
-func NewOutputFiles(conf *IndexBuilderConf, ngramSize int, filePerm os.FileMode, dirPerm os.FileMode) *OutputFiles {
+func NewOutputFiles(conf *IndexBuilderConf, ngramSize int, filePerm os.FileMode, dirPerm os.FileMode) (*OutputFiles, error) {
 	inFilenamePrefix := stripSuffix(filepath.Base(conf.InputFilePath))
 	outDir := filepath.Join(conf.OutDirectory, inFilenamePrefix)
 	err := os.MkdirAll(outDir, dirPerm)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &OutputFiles{
 		conf:      conf,
@@ -151,5 +256,5 @@ func NewOutputFiles(conf *IndexBuilderConf, ngramSize int, filePerm os.FileMode,
 		filePerm:  filePerm,
 		dirPerm:   dirPerm,
 		ngramSize: ngramSize,
-	}
+	}, nil
 }
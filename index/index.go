@@ -18,6 +18,7 @@
 package index
 
 import (
+	"context"
 	"fmt"
 	"github.com/tomachalek/gloomy/index/column"
 	"github.com/tomachalek/gloomy/wdict"
@@ -33,11 +34,24 @@ const (
 	MaxNgramSize = 10
 )
 
-type NgramResultItem struct {
-	next     *NgramResultItem
-	Ngram    []int
-	Count    int
+// MetadataCount represents a number of occurrences of an n-gram
+// with a specific combination of metadata attribute values
+type MetadataCount struct {
 	Metadata []string
+	Count    int
+}
+
+// NgramResultItem is a single n-gram of a search result.
+// Count is the total count of the n-gram, Distribution
+// contains its counts per combination of metadata attribute
+// values (in case metadata are loaded). Metadata contains
+// attribute values of the first item of Distribution.
+type NgramResultItem struct {
+	next         *NgramResultItem
+	Ngram        []int
+	Count        int
+	Metadata     []string
+	Distribution []*MetadataCount
 }
 
 // NgramSearchResult is a low level result
@@ -57,6 +71,9 @@ type NgramSearchResult struct {
 }
 
 func (nsr *NgramSearchResult) Append(other *NgramSearchResult) {
+	if other.first == nil {
+		return
+	}
 	if nsr.last != nil {
 		nsr.last.next = other.first
 
@@ -111,7 +128,7 @@ func (nsr *NgramSearchResult) Filter(fn func(*NgramResultItem) bool) {
 // performed only if rightIdx is strictly greater than
 // leftIdx.
 func (nsr *NgramSearchResult) Slice(leftIdx int, rightIdx int) bool {
-	if leftIdx < 0 || rightIdx >= nsr.Size() {
+	if leftIdx < 0 || rightIdx > nsr.Size() {
 		log.Panicf("Invalid slice arguments (%d, %d)", leftIdx, rightIdx)
 	}
 	if leftIdx >= rightIdx {
@@ -133,6 +150,14 @@ func (nsr *NgramSearchResult) Slice(leftIdx int, rightIdx int) bool {
 	return true
 }
 
+// Clear removes all the items of the result
+func (nsr *NgramSearchResult) Clear() {
+	nsr.first = nil
+	nsr.last = nil
+	nsr.curr = nil
+	nsr.size = 0
+}
+
 // Size returns a size of the result
 // (this is an O(1) operation)
 func (nsr *NgramSearchResult) Size() int {
@@ -164,7 +189,7 @@ func (nsr *NgramSearchResult) Next() *NgramResultItem {
 	return ans
 }
 
-func (nsr *NgramSearchResult) addValue(ngram []int, count int, metadata []string) {
+func (nsr *NgramSearchResult) addValue(ngram []int, count int, metadata []string) *NgramResultItem {
 	item := &NgramResultItem{Ngram: ngram, Count: count, Metadata: metadata}
 	if nsr.first == nil {
 		nsr.first = item
@@ -175,16 +200,47 @@ func (nsr *NgramSearchResult) addValue(ngram []int, count int, metadata []string
 	nsr.curr = item
 	nsr.last = item
 	nsr.size++
+	return item
 }
 
 // --------------------------------------------------------------------
 
 // NgramIndex is a low-level implementation
 // of a n-gram index.
+//
+// A loaded index is a read-only handle which can be shared by
+// many goroutines as long as they search it via SearchableIndex
+// (each searchable index loads column chunks into its own view
+// of the index). Methods loading data directly into the index
+// (LoadRange) are not safe for concurrent use.
 type NgramIndex struct {
-	values   []*column.IndexColumn
+	values   []column.IndexColumnReader
 	counts   column.AttrValColumn
 	metadata *column.MetadataReader
+
+	// rotation specifies how many positions are the n-grams
+	// rotated to the left within the index (0 = the main index)
+	rotation int
+}
+
+// NgramSize returns the size of n-grams stored in the index
+func (n *NgramIndex) NgramSize() int {
+	return len(n.values)
+}
+
+// AttrNames returns names of metadata attributes
+// loaded along with the index
+func (n *NgramIndex) AttrNames() []string {
+	if n.metadata == nil {
+		return []string{}
+	}
+	return n.metadata.AttrNames()
+}
+
+// Rotation returns number of positions n-grams are rotated
+// to the left within the index (0 for the main index).
+func (n *NgramIndex) Rotation() int {
+	return n.rotation
 }
 
 // GetInfo returns a human readable overview
@@ -205,54 +261,257 @@ func (n *NgramIndex) GetInfo() string {
 // on 2th column which is calculated automatically).
 //
 // Both interval ends are included.
-func (n *NgramIndex) LoadRange(fromPos int, toPos int) {
-	n.loadData(fromPos, toPos)
+func (n *NgramIndex) LoadRange(fromPos int, toPos int) error {
+	return n.loadData(fromPos, toPos)
 }
 
 // GetNgramsAt returns all the ngrams where the first word
 // index equals position
 func (n *NgramIndex) GetNgramsAt(position int) *NgramSearchResult {
+	return n.getNgramsInRange(position, position, searchFilter{})
+}
+
+// GetNgramsInRange returns all the ngrams where the first word
+// index is within interval [fromPos, toPos] (both ends included)
+func (n *NgramIndex) GetNgramsInRange(fromPos int, toPos int) *NgramSearchResult {
+	return n.getNgramsInRange(fromPos, toPos, searchFilter{})
+}
+
+// getNgramsInRange is like GetNgramsInRange but it also
+// skips n-grams not accepted by a filter
+func (n *NgramIndex) getNgramsInRange(fromPos int, toPos int, filter searchFilter) *NgramSearchResult {
 	result := &NgramSearchResult{}
-	n.getNextTokenRecords(0, position, position, make([]int, 0), result)
+	n.forEachNgram(fromPos, toPos, nil, filter, func(ngram []int, count int, rows []int, path []int) bool {
+		return n.addResultItem(result, ngram, count, rows, filter.budget)
+	})
 	result.ResetCursor()
 	return result
 }
 
+// getTopNgramsInRange is like getNgramsInRange but it keeps only
+// the first k n-grams according to less (see GetTopNgramsInRanges).
+// The result budget is not consumed.
+func (n *NgramIndex) getTopNgramsInRange(fromPos int, toPos int, filter searchFilter, k int, less ItemLess,
+	lessUsesMetadata bool) *itemHeap {
+	ans := &itemHeap{less: less}
+	decodeLater := n.metadata != nil && !lessUsesMetadata
+	itemRows := make(map[*NgramResultItem][]int)
+	n.forEachNgram(fromPos, toPos, nil, filter, func(ngram []int, count int, rows []int, path []int) bool {
+		item := &NgramResultItem{Ngram: ngram, Count: count}
+		if n.metadata != nil && lessUsesMetadata {
+			n.addMetadata(item, rows)
+		}
+		left := ans.offer(item, k)
+		if decodeLater && left != item {
+			delete(itemRows, left)
+			itemRows[item] = append([]int{}, rows...)
+		}
+		return true
+	})
+	for item, rows := range itemRows {
+		n.addMetadata(item, rows)
+	}
+	return ans
+}
+
 func (n *NgramIndex) findLoadRange(colIdx int, fromRow int, toRow int) (int, int) {
 	leftIdx := fromRow
 	if fromRow > 0 {
-		leftIdx = n.values[colIdx].Get(fromRow-1).UpTo + 1
+		leftIdx = n.values[colIdx].Item(fromRow-1).UpTo + 1
 	}
-	rightIdx := n.values[colIdx].Get(toRow).UpTo
+	rightIdx := n.values[colIdx].Item(toRow).UpTo
 	return leftIdx, rightIdx
 }
 
-func (n *NgramIndex) loadData(fromRow int, toRow int) {
+func (n *NgramIndex) loadData(fromRow int, toRow int) error {
 	left := fromRow
 	right := toRow
 	for i := 0; i < len(n.values)-1; i++ {
 		left, right = n.findLoadRange(i, left, right)
-		n.values[i+1].LoadChunk(left, right)
+		if err := n.values[i+1].LoadChunk(left, right); err != nil {
+			return err
+		}
+	}
+	if err := n.counts.LoadChunk(left, right); err != nil {
+		return err
 	}
-	n.counts.LoadChunk(left, right)
-	n.metadata.LoadChunk(left, right)
+	return n.metadata.LoadChunk(left, right)
 }
 
-func (n *NgramIndex) getNextTokenRecords(colIdx int, fromRow int, toRow int, prevTokens []int, result *NgramSearchResult) {
+// fork creates a view of the index sharing the zero column
+// (which is always fully loaded) and attribute dictionaries
+// but with its own loaded chunks of all the other columns.
+// Different views can be searched concurrently.
+func (n *NgramIndex) fork() *NgramIndex {
+	ans := &NgramIndex{
+		values:   make([]column.IndexColumnReader, len(n.values)),
+		counts:   n.counts.Fork(),
+		rotation: n.rotation,
+	}
+	ans.values[0] = n.values[0]
+	for i := 1; i < len(n.values); i++ {
+		ans.values[i] = n.values[i].Fork()
+	}
+	if n.metadata != nil {
+		ans.metadata = n.metadata.Fork()
+	}
+	return ans
+}
+
+// findWordRows narrows sorted rows [fromRow, toRow] of a column
+// (i.e. children of a single node or rows of the zero column)
+// to the ones containing words within a range. In case there
+// are no such rows, the returned interval is empty.
+func (n *NgramIndex) findWordRows(colIdx int, fromRow int, toRow int, words WordRange) (int, int) {
 	col := n.values[colIdx]
+	if fromRow > toRow {
+		return fromRow, toRow
+	}
+	left := fromRow + sort.Search(toRow-fromRow+1, func(i int) bool {
+		return col.Item(fromRow+i).Index >= words.From
+	})
+	right := fromRow + sort.Search(toRow-fromRow+1, func(i int) bool {
+		return col.Item(fromRow+i).Index > words.To
+	})
+	return left, right - 1
+}
+
+// walkLeaves traverses the n-gram tree starting from rows
+// [fromRow, toRow] of column colIdx and calls fn for each
+// found n-gram along with its path - rows within all the columns
+// (the last one is also the row of its count and metadata).
+// In case resume contains a path (of columns colIdx...), the traversal
+// starts right after the leaf identified by the path. Once fn returns
+// false, the traversal stops and walkLeaves returns false too.
+// Rows of columns with a range in words (if specified) are restricted
+// to the ones with words within the range.
+// N-grams are in the index's own column order (see rotation).
+func (n *NgramIndex) walkLeaves(colIdx int, fromRow int, toRow int, prevTokens []int, prevPath []int,
+	resume []int, words []*WordRange, fn func(ngram []int, path []int) bool) bool {
+	col := n.values[colIdx]
+	isLeaf := colIdx == len(n.values)-1
+	if len(resume) > 0 && resume[0] >= fromRow {
+		if isLeaf {
+			fromRow = resume[0] + 1
+
+		} else {
+			fromRow = resume[0]
+		}
+
+	} else {
+		resume = nil
+	}
+	if colIdx < len(words) && words[colIdx] != nil {
+		fromRow, toRow = n.findWordRows(colIdx, fromRow, toRow, *words[colIdx])
+	}
 	for i := fromRow; i <= toRow; i++ {
-		idx := col.Get(i)
-		currNgram := append(prevTokens, idx.Index)
-		if colIdx == len(n.values)-1 {
-			result.addValue(currNgram, int(n.counts.Get(i)), n.metadata.Get(i))
+		idx := col.Item(i)
+		currNgram := append(prevTokens[:len(prevTokens):len(prevTokens)], idx.Index)
+		currPath := append(prevPath[:len(prevPath):len(prevPath)], i)
+		if isLeaf {
+			if !fn(currNgram, currPath) {
+				return false
+			}
 
 		} else {
 			nextFromIdx := 0
-			if fromRow > 0 {
-				nextFromIdx = col.Get(i-1).UpTo + 1
+			if i > 0 {
+				nextFromIdx = col.Item(i-1).UpTo + 1
 			}
 			nextToIdx := idx.UpTo
-			n.getNextTokenRecords(colIdx+1, nextFromIdx, nextToIdx, currNgram, result)
+			var nextResume []int
+			if resume != nil && i == resume[0] {
+				nextResume = resume[1:]
+			}
+			if !n.walkLeaves(colIdx+1, nextFromIdx, nextToIdx, currNgram, currPath, nextResume, words, fn) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// forEachNgram walks n-grams found within rows [fromRow, toRow]
+// of the zero column (optionally resuming after a leaf identified
+// by its path - see walkLeaves). Leaves of the same n-gram (with
+// different metadata) are adjacent within the last column and they
+// are passed to fn together along with their total count and a path
+// of the last of them. Leaves not accepted by the metadata filter
+// are skipped and so are n-grams with total count out of the filter's
+// count range or rejected by its matcher. N-grams passed to fn are
+// unrotated. Once fn returns false or the filter's context is done,
+// the walking stops and forEachNgram returns false.
+func (n *NgramIndex) forEachNgram(fromRow int, toRow int, resume []int, filter searchFilter,
+	fn func(ngram []int, count int, rows []int, path []int) bool) bool {
+	var groupNgram []int
+	var groupPath []int
+	groupRows := make([]int, 0, 10)
+	flush := func() bool {
+		if len(groupRows) == 0 {
+			return true
+		}
+		total := 0
+		for _, row := range groupRows {
+			total += int(n.counts.Get(row))
+		}
+		ans := true
+		if filter.counts.contains(total) {
+			ngram := unrotateNgram(groupNgram, n.rotation)
+			if filter.matcher == nil || filter.matcher(ngram) {
+				ans = fn(ngram, total, groupRows, groupPath)
+			}
+		}
+		groupRows = groupRows[:0]
+		return ans
+	}
+	numVisited := 0
+	completed := n.walkLeaves(0, fromRow, toRow, make([]int, 0), make([]int, 0), resume, filter.words,
+		func(ngram []int, path []int) bool {
+			numVisited++
+			if numVisited%ctxCheckInterval == 0 && filter.isCancelled() {
+				return false
+			}
+			row := path[len(path)-1]
+			if filter.metadata != nil && !filter.metadata.accepts(n.metadata, row) {
+				return true
+			}
+			if len(groupRows) > 0 && compareNgrams(groupNgram, ngram) != 0 && !flush() {
+				return false
+			}
+			groupNgram = ngram
+			groupPath = path
+			groupRows = append(groupRows, row)
+			return true
+		})
+	return completed && !filter.isCancelled() && flush()
+}
+
+// addResultItem adds an n-gram found by forEachNgram to a result.
+// False is returned in case the result budget is exhausted.
+func (n *NgramIndex) addResultItem(result *NgramSearchResult, ngram []int, count int, rows []int,
+	budget *ResultBudget) bool {
+	if !budget.take() {
+		return false
+	}
+	item := result.addValue(ngram, count, nil)
+	// metadata are decoded only for n-grams accepted by the filter
+	if n.metadata != nil {
+		n.addMetadata(item, rows)
+	}
+	return true
+}
+
+// addMetadata attaches metadata of n-gram's leaves
+// (rows) to a respective result item
+func (n *NgramIndex) addMetadata(item *NgramResultItem, rows []int) {
+	for i, row := range rows {
+		metadata := n.metadata.Get(row)
+		if i == 0 {
+			item.Metadata = metadata
+		}
+		if len(metadata) > 0 {
+			item.Distribution = append(item.Distribution,
+				&MetadataCount{Metadata: metadata, Count: int(n.counts.Get(row))})
 		}
 	}
 }
@@ -261,7 +520,7 @@ func (n *NgramIndex) getNextTokenRecords(colIdx int, fromRow int, toRow int, pre
 func NewNgramIndex(ngramSize int, initialLength int, attrMap map[string]string) *NgramIndex {
 	countsCol := column.NewCountsColumn(initialLength)
 	ans := &NgramIndex{
-		values:   make([]*column.IndexColumn, ngramSize),
+		values:   make([]column.IndexColumnReader, ngramSize),
 		counts:   countsCol,
 		metadata: nil,
 	}
@@ -282,77 +541,213 @@ func NewNgramIndex(ngramSize int, initialLength int, attrMap map[string]string)
 // is up to a search routine (which decides which words
 // we are actually looking for by parsing a query),
 type SearchableIndex struct {
-	index  *NgramIndex
-	wstore *wdict.WordDictReader
+	index      *NgramIndex
+	wstore     *wdict.WordDictReader
+	filter     searchFilter
+	numWorkers int
 }
 
-// GetNgramsOf returns all the n-grams with first word
-// equal to the 'word' argument
-func (si *SearchableIndex) GetNgramsOf(word string) *NgramSearchResult {
-	var ans *NgramSearchResult
+// SetNumWorkers sets max. number of workers used by searches
+// processing multiple chunks of the index (see GetNgramsInRanges)
+func (si *SearchableIndex) SetNumWorkers(numWorkers int) {
+	si.numWorkers = numWorkers
+}
+
+// SetResultBudget sets a budget shared by all the searches
+// of the searchable index. Once the budget is exhausted,
+// the searches stop (see Err).
+func (si *SearchableIndex) SetResultBudget(budget *ResultBudget) {
+	si.filter.budget = budget
+}
+
+// Err returns an error in case some of the searches has been
+// stopped before completion - either because the context of the
+// searchable index is done or because the result budget has been
+// exceeded. Results of such searches are incomplete.
+func (si *SearchableIndex) Err() error {
+	if err := si.filter.budget.Err(); err != nil {
+		return err
+	}
+	if si.filter.isCancelled() {
+		return si.filter.ctx.Err()
+	}
+	return nil
+}
+
+// SetMetadataFilter sets a filter applied to all
+// the n-grams returned by the searchable index
+func (si *SearchableIndex) SetMetadataFilter(filter *MetadataFilter) {
+	si.filter.metadata = filter
+}
+
+// SetCountRange restricts the n-grams returned by the
+// searchable index to ones with a total count within
+// a specified range
+func (si *SearchableIndex) SetCountRange(counts CountRange) {
+	si.filter.counts = counts
+}
+
+// SetNgramMatcher sets a function applied to all the n-grams
+// returned by the searchable index (nil means no restriction)
+func (si *SearchableIndex) SetNgramMatcher(matcher NgramMatcher) {
+	si.filter.matcher = matcher
+}
+
+// SetWordRanges restricts the n-grams returned by the searchable
+// index to ones with words within specified ranges. The ranges
+// are specified for n-gram positions in the original (unrotated)
+// order, nil means any word.
+func (si *SearchableIndex) SetWordRanges(words []*WordRange) {
+	ngramSize := len(si.index.values)
+	si.filter.words = make([]*WordRange, ngramSize)
+	for i := range si.filter.words {
+		pos := (i + si.index.rotation) % ngramSize
+		if pos < len(words) {
+			si.filter.words[i] = words[pos]
+		}
+	}
+}
+
+// WordRows returns zero column rows containing words
+// within a range (nil means all the rows)
+func (si *SearchableIndex) WordRows(words *WordRange) []RowRange {
+	if words == nil {
+		return si.AllRows()
+	}
+	from, to := si.index.findWordRows(0, 0, si.index.values[0].Size()-1, *words)
+	if from > to {
+		return []RowRange{}
+	}
+	return []RowRange{{From: from, To: to}}
+}
+
+// loadWord finds zero column rows of a word (more rows are
+// possible only for repeated 1-grams) and loads respective
+// column data. In case the word is not found, -1 is returned.
+func (si *SearchableIndex) loadWord(word string) (int, int, error) {
 	w := si.wstore.Find(word)
 	if w == -1 {
-		return &NgramSearchResult{}
+		return -1, -1, nil
 	}
-	col0Idx := sort.Search(si.index.values[0].Size(), func(i int) bool {
-		return si.index.values[0].Get(i).Index >= w
-	})
-	if col0Idx == si.index.values[0].Size() {
-		return ans
+	fromRow, toRow := si.col0Rows(w)
+	if fromRow == -1 {
+		return -1, -1, nil
 	}
-	si.LoadRange(col0Idx, col0Idx)
-	ans = si.index.GetNgramsAt(col0Idx)
-	return ans
+	if err := si.LoadRange(fromRow, toRow); err != nil {
+		return -1, -1, err
+	}
+	return fromRow, toRow, nil
+}
+
+// col0Rows returns zero column rows of a word identified
+// by an index within word dictionary. In case the word
+// is not found, -1 is returned.
+func (si *SearchableIndex) col0Rows(widx int) (int, int) {
+	fromRow, toRow := si.index.findWordRows(0, 0, si.index.values[0].Size()-1, WordRange{From: widx, To: widx})
+	if fromRow > toRow {
+		return -1, -1
+	}
+	return fromRow, toRow
+}
+
+// loadAll loads all the column data and returns a size
+// of the zero column
+func (si *SearchableIndex) loadAll() (int, error) {
+	size := si.index.values[0].Size()
+	if size == 0 {
+		return 0, nil
+	}
+	if err := si.LoadRange(0, size-1); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// GetNgramsOf returns all the n-grams with first word
+// equal to the 'word' argument. In case of a rotated index,
+// the "first word" is the one at position Rotation() of
+// the original n-gram.
+func (si *SearchableIndex) GetNgramsOf(word string) (*NgramSearchResult, error) {
+	fromRow, toRow, err := si.loadWord(word)
+	if err != nil || fromRow == -1 {
+		return &NgramSearchResult{}, err
+	}
+	ans := si.index.getNgramsInRange(fromRow, toRow, si.filter)
+	if err := si.Err(); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// GetAllNgrams loads and returns all the n-grams
+// stored in the index.
+func (si *SearchableIndex) GetAllNgrams() (*NgramSearchResult, error) {
+	size, err := si.loadAll()
+	if err != nil || size == 0 {
+		return &NgramSearchResult{}, err
+	}
+	ans := si.index.getNgramsInRange(0, size-1, si.filter)
+	if err := si.Err(); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// Index returns the wrapped low-level index
+func (si *SearchableIndex) Index() *NgramIndex {
+	return si.index
 }
 
 // LoadRange loads column data starting from fromIdx
 // up to toIdx
-func (si *SearchableIndex) LoadRange(fromIdx int, toIdx int) {
-	si.index.LoadRange(fromIdx, toIdx)
+func (si *SearchableIndex) LoadRange(fromIdx int, toIdx int) error {
+	return si.index.LoadRange(fromIdx, toIdx)
 }
 
 // GetCol0Idx returns an index within zero column
 // of provided word identied by an index within
-// word dictionary
+// word dictionary (the first one in case of
+// a repeated 1-gram)
 func (si *SearchableIndex) GetCol0Idx(widx int) int {
 	ans := sort.Search(si.index.values[0].Size(), func(i int) bool {
-		return si.index.values[0].Get(i).Index >= widx
+		return si.index.values[0].Item(i).Index >= widx
 	})
-	if si.index.values[0].Get(ans).Index == widx {
+	if ans < si.index.values[0].Size() && si.index.values[0].Item(ans).Index == widx {
 		return ans
 	}
 	return -1
 }
 
 // GetNgramsOfColIdx returns all the n-grams with the first word identified
-// by its index within zero column
+// by its index within zero column. Please note that in case the search is
+// stopped, the result is incomplete (see Err).
 func (si *SearchableIndex) GetNgramsOfColIdx(idx int) *NgramSearchResult {
-	var ans *NgramSearchResult
 	if idx >= si.index.values[0].Size() {
-		return ans
+		return &NgramSearchResult{}
 	}
-	ans = si.index.GetNgramsAt(idx)
-	return ans
+	return si.index.getNgramsInRange(idx, idx, si.filter)
 }
 
 // GetNgramsOfWidx returns all the n-grams with the first word identified
-// by its word dictionary index value
+// by its word dictionary index value. Please note that in case the search
+// is stopped, the result is incomplete (see Err).
 func (si *SearchableIndex) GetNgramsOfWidx(idx int) *NgramSearchResult {
-	var ans *NgramSearchResult
-	col0Idx := sort.Search(si.index.values[0].Size(), func(i int) bool {
-		return si.index.values[0].Get(i).Index >= idx
-	})
-	if col0Idx == si.index.values[0].Size() {
-		return ans
+	fromRow, toRow := si.col0Rows(idx)
+	if fromRow == -1 {
+		return &NgramSearchResult{}
 	}
-	ans = si.index.GetNgramsAt(col0Idx)
-	return ans
+	return si.index.getNgramsInRange(fromRow, toRow, si.filter)
 }
 
 // OpenSearchableIndex creates a instance of SearchableIndex
-// based on internal NgramIndex instance and WordIndex instance
-func OpenSearchableIndex(index *NgramIndex, wstore *wdict.WordDictReader) *SearchableIndex {
-	return &SearchableIndex{index: index, wstore: wstore}
+// based on internal NgramIndex instance and WordIndex instance.
+// The searchable index is expected to serve a single query -
+// all its searches stop once ctx is done. Data are loaded into
+// a separate view of the index so multiple searchable indices
+// of the same NgramIndex can be used concurrently (but a single
+// searchable index must not).
+func OpenSearchableIndex(ctx context.Context, index *NgramIndex, wstore *wdict.WordDictReader) *SearchableIndex {
+	return &SearchableIndex{index: index.fork(), wstore: wstore, filter: searchFilter{ctx: ctx}}
 }
 
 // ----------------------------------------------------------------------------
@@ -360,9 +755,13 @@ func OpenSearchableIndex(index *NgramIndex, wstore *wdict.WordDictReader) *Searc
 // DynamicNgramIndex allows adding items to the index
 type DynamicNgramIndex struct {
 	index          *NgramIndex
+	columns        []*column.IndexColumn
 	cursors        []int
 	initialLength  int
 	metadataWriter *column.MetadataWriter
+	rotation       int
+	columnFormat   column.ColumnFormat
+	buildInfo      *BuildInfo
 }
 
 // NewDynamicNgramIndex creates a new instance of DynamicNgramIndex
@@ -372,14 +771,26 @@ func NewDynamicNgramIndex(ngramSize int, initialLength int, attrMap map[string]s
 		cursors[i] = -1
 	}
 
+	nindex := NewNgramIndex(ngramSize, initialLength, attrMap)
 	return &DynamicNgramIndex{
 		initialLength:  initialLength,
-		index:          NewNgramIndex(ngramSize, initialLength, attrMap),
+		index:          nindex,
+		columns:        writableColumns(nindex),
 		cursors:        cursors,
 		metadataWriter: column.NewMetadataWriter(attrMap),
 	}
 }
 
+// writableColumns returns index columns of a newly
+// created (i.e. not loaded) index
+func writableColumns(nindex *NgramIndex) []*column.IndexColumn {
+	ans := make([]*column.IndexColumn, len(nindex.values))
+	for i, v := range nindex.values {
+		ans[i] = v.(*column.IndexColumn)
+	}
+	return ans
+}
+
 // GetIndex returns internal index structure
 func (nib *DynamicNgramIndex) GetIndex() *NgramIndex {
 	return nib.index
@@ -391,6 +802,18 @@ func (nib *DynamicNgramIndex) GetInfo() string {
 	return nib.index.GetInfo()
 }
 
+// SetColumnFormat specifies a format used to store
+// index columns and the counts column
+func (nib *DynamicNgramIndex) SetColumnFormat(format column.ColumnFormat) {
+	nib.columnFormat = format
+}
+
+// SetBuildInfo attaches an information about the index
+// origin which is written to the index manifest
+func (nib *DynamicNgramIndex) SetBuildInfo(info *BuildInfo) {
+	nib.buildInfo = info
+}
+
 // MetadataWriter provides access to attached
 // metadata index writer
 func (nib *DynamicNgramIndex) MetadataWriter() *column.MetadataWriter {
@@ -406,8 +829,14 @@ func (nib *DynamicNgramIndex) GetNgramsAt(position int) *NgramSearchResult {
 // of indices to the index
 func (nib *DynamicNgramIndex) AddNgram(ngram []int, count int, metadata []column.AttrVal) {
 	sp := nib.findSplitPosition(ngram)
-	for i := 0; i < len(nib.index.values); i++ {
-		col := nib.index.values[i]
+	if sp == -1 {
+		// the same n-gram with different metadata is
+		// stored as a sibling leaf in the last column
+		// (for 1-grams, it is a repeated zero column row)
+		sp = len(nib.columns) - 1
+	}
+	for i := 0; i < len(nib.columns); i++ {
+		col := nib.columns[i]
 		if nib.cursors[i] >= col.Size()-1 {
 			col.Extend(nib.initialLength / 2)
 		}
@@ -424,7 +853,7 @@ func (nib *DynamicNgramIndex) AddNgram(ngram []int, count int, metadata []column
 			col.Set(nib.cursors[i], &column.IndexItem{Index: ngram[i], UpTo: upTo})
 		}
 	}
-	lastPos := nib.cursors[len(nib.index.values)-1]
+	lastPos := nib.cursors[len(nib.columns)-1]
 	if lastPos >= nib.index.counts.Size()-1 {
 		nib.index.counts.Extend(nib.initialLength / 2)
 	}
@@ -433,14 +862,13 @@ func (nib *DynamicNgramIndex) AddNgram(ngram []int, count int, metadata []column
 		nib.metadataWriter.Extend(nib.initialLength / 2)
 	}
 	nib.metadataWriter.Set(lastPos, metadata)
-	// TODO add metadata
 }
 
 // findSplitPosition returns a position within an n-gram (i.e. value from 0...n-1)
 // where the currently stored n-gram "tree" should split to create a new branch.
 func (nib *DynamicNgramIndex) findSplitPosition(ngram []int) int {
 	for i := 0; i < len(ngram); i++ {
-		if nib.cursors[i] == -1 || ngram[i] != nib.index.values[i].Get(nib.cursors[i]).Index {
+		if nib.cursors[i] == -1 || ngram[i] != nib.columns[i].Get(nib.cursors[i]).Index {
 			return i
 		}
 	}
@@ -451,57 +879,128 @@ func (nib *DynamicNgramIndex) findSplitPosition(ngram []int) int {
 // is done. The method frees up some memory preallocated
 // for new n-grams.
 func (nib *DynamicNgramIndex) Finish() {
-	for i, v := range nib.index.values {
-		v.Shrink(nib.cursors[i])
+	for i, v := range nib.columns {
+		v.Shrink(nib.cursors[i] + 1)
 	}
-	nib.metadataWriter.Shrink(nib.cursors[len(nib.index.values)-1])
+	lastPos := nib.cursors[len(nib.columns)-1]
+	nib.index.counts.Shrink(lastPos + 1)
+	nib.metadataWriter.Shrink(lastPos + 1)
 }
 
 // Save stores current index data to bunch of files
-// within the provided directory.
+// within the provided directory. A rotated index is
+// stored into its own subdirectory (see RotationDirPath)
+// and it shares metadata dictionaries with the main index.
+// The main index writes also the index manifest (which
+// means rotated indices should be saved first).
 func (nib *DynamicNgramIndex) Save(dirPath string) error {
 	var err error
-	for i, col := range nib.index.values {
-		if err = col.Save(i, dirPath); err != nil {
+	if nib.rotation > 0 {
+		dirPath = RotationDirPath(dirPath, nib.rotation)
+		if err = os.MkdirAll(dirPath, 0755); err != nil {
 			return err
 		}
 	}
-	nib.index.counts.Save(dirPath)
-	nib.metadataWriter.Save(dirPath)
-	return err
+	for i, col := range nib.columns {
+		if err = col.SaveAs(i, dirPath, nib.columnFormat); err != nil {
+			return err
+		}
+	}
+	if err = column.SaveCountsColumn(nib.index.counts, dirPath, nib.columnFormat); err != nil {
+		return err
+	}
+	if nib.rotation > 0 {
+		return nib.metadataWriter.SaveColumns(dirPath)
+	}
+	if err = nib.metadataWriter.Save(dirPath); err != nil {
+		return err
+	}
+	return nib.createManifest(dirPath).save(dirPath)
 }
 
 // ---------------------------------------------------------------------
 
-// LoadNgramIndex loads index data from within
-// a specified directory.
-func LoadNgramIndex(dirPath string, attrs []string) *NgramIndex {
-	colIdxPaths := make([]string, MaxNgramSize)
-	ans := &NgramIndex{}
+// DetectNgramSize returns size of n-grams stored in an index
+// within a specified directory. The value is determined by
+// probing index column files.
+func DetectNgramSize(dirPath string) int {
 	for i := 0; i < MaxNgramSize; i++ {
-		tmp := column.CreateColIdxPath(i, dirPath)
-		if _, err := os.Stat(tmp); os.IsNotExist(err) {
-			colIdxPaths = colIdxPaths[:i]
-			break
+		if _, err := os.Stat(column.CreateColIdxPath(i, dirPath)); os.IsNotExist(err) {
+			return i
 		}
-		colIdxPaths[i] = tmp
 	}
-	var err2 error
-	ans.counts, err2 = column.LoadCountsColumn(dirPath)
-	if err2 != nil {
-		panic(err2)
+	return MaxNgramSize
+}
+
+// LoadNgramIndex loads index data from within
+// a specified directory.
+func LoadNgramIndex(dirPath string, attrs []string) (*NgramIndex, error) {
+	return LoadRotatedNgramIndex(dirPath, 0, attrs, column.FileStorage)
+}
+
+// LoadRotatedNgramIndex loads a rotated variant of the index
+// stored within a specified directory. Rotation 0 means
+// the main index. Columns are accessed according to
+// the storage argument. The index is validated against
+// its manifest.
+func LoadRotatedNgramIndex(dirPath string, rotation int, attrs []string, storage column.StorageType) (*NgramIndex, error) {
+	manifest, err := LoadManifest(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	return LoadIndexWithManifest(dirPath, manifest, rotation, attrs, storage)
+}
+
+// LoadIndexWithManifest loads a rotated variant of the index
+// described by an already loaded manifest.
+func LoadIndexWithManifest(dirPath string, manifest *Manifest, rotation int, attrs []string, storage column.StorageType) (*NgramIndex, error) {
+	if err := manifest.Validate(rotation, attrs); err != nil {
+		return nil, err
+	}
+	colsDirPath := dirPath
+	if rotation > 0 {
+		colsDirPath = RotationDirPath(dirPath, rotation)
+	}
+	ans, err := loadNgramIndex(colsDirPath, dirPath, manifest.NgramSize, attrs, storage)
+	if err != nil {
+		return nil, err
 	}
-	var err3 error
-	ans.metadata, err3 = column.LoadMetadataReader(dirPath, attrs)
-	if err3 != nil {
-		panic(err3)
+	if err := manifest.validateColumns(colsDirPath, ans.counts.StoredSize()); err != nil {
+		return nil, err
 	}
-	ans.values = make([]*column.IndexColumn, len(colIdxPaths))
+	ans.rotation = rotation
+	return ans, nil
+}
+
+func loadNgramIndex(colsDirPath string, dictsDirPath string, ngramSize int, attrs []string, storage column.StorageType) (*NgramIndex, error) {
+	ans := &NgramIndex{}
+	var err error
+	ans.counts, err = column.LoadStoredCountsColumn(colsDirPath, storage)
+	if err != nil {
+		return nil, err
+	}
+	ans.metadata, err = column.LoadMetadataReaderFrom(colsDirPath, dictsDirPath, attrs, storage)
+	if err != nil {
+		return nil, err
+	}
+	ans.values = make([]column.IndexColumnReader, ngramSize)
 	for i := range ans.values {
-		ans.values[i] = column.NewBoundIndexColumn(colIdxPaths[i])
+		colPath := column.CreateColIdxPath(i, colsDirPath)
+		if storage == column.MmapStorage {
+			ans.values[i], err = column.OpenMmapIndexColumn(colPath)
+			if err != nil {
+				return nil, err
+			}
+
+		} else {
+			ans.values[i] = column.NewBoundIndexColumn(colPath)
+		}
 		if i == 0 {
-			ans.values[i].LoadWholeChunk() // TODO
+			// TODO
+			if err := ans.values[i].LoadWholeChunk(); err != nil {
+				return nil, err
+			}
 		}
 	}
-	return ans
+	return ans, nil
 }
@@ -15,9 +15,13 @@
 package index
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index/column"
 )
 
 func createSimpleResult() *NgramSearchResult {
@@ -123,6 +127,16 @@ func TestNgramAppendNonemptyToEmpty(t *testing.T) {
 	assert.True(t, r1.curr == r1.first)
 }
 
+func TestNgramAppendEmpty(t *testing.T) {
+	r1 := createSimpleResult()
+	last := r1.last
+	r1.Append(&NgramSearchResult{})
+	assert.Equal(t, 5, r1.Size())
+	assert.True(t, r1.last == last)
+	r1.Append(createAnotherResult())
+	assert.Equal(t, 8, r1.Size())
+}
+
 func TestNgramSearchResultSlice(t *testing.T) {
 	r := &NgramSearchResult{}
 	for i := 0; i < 20; i++ {
@@ -138,6 +152,17 @@ func TestNgramSearchResultSlice(t *testing.T) {
 	assert.True(t, r.first == r.curr)
 }
 
+func TestNgramSearchResultSliceUpToSize(t *testing.T) {
+	r := &NgramSearchResult{}
+	for i := 0; i < 5; i++ {
+		r.addValue([]int{i}, 1, []string{})
+	}
+	assert.True(t, r.Slice(2, 5))
+	assert.Equal(t, 3, r.Size())
+	assert.Equal(t, 2, r.first.Ngram[0])
+	assert.Equal(t, 4, r.last.Ngram[0])
+}
+
 func TestNgramSearchResultSliceZero(t *testing.T) {
 	r := &NgramSearchResult{}
 	for i := 0; i < 10; i++ {
@@ -158,6 +183,15 @@ func TestNgramSearchResultSliceNegativeRight(t *testing.T) {
 	assert.Equal(t, 10, r.Size())
 }
 
+func TestNgramSearchResultClear(t *testing.T) {
+	r := createSimpleResult()
+	r.Clear()
+	assert.Equal(t, 0, r.Size())
+	assert.False(t, r.HasNext())
+	r.Append(createAnotherResult())
+	assert.Equal(t, 3, r.Size())
+}
+
 func TestNgramSearchResultSliceNegativeLeft(t *testing.T) {
 	r := &NgramSearchResult{}
 	for i := 0; i < 5; i++ {
@@ -277,6 +311,24 @@ func TestNgramSearchResultFilterAcceptBlock(t *testing.T) {
 	assert.Equal(t, 3, counter)
 }
 
+func TestSaveAndLoadCompressed(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	d := createTestingDynamicIndex()
+	d.SetColumnFormat(column.VarintFormat)
+	assert.Nil(t, d.Save(dirPath))
+
+	for _, storage := range []column.StorageType{column.FileStorage, column.MmapStorage} {
+		idx, err := LoadRotatedNgramIndex(dirPath, 0, []string{}, storage)
+		assert.Nil(t, err)
+		idx.LoadRange(0, 2)
+		ngrams, counts := collectNgrams(idx.GetNgramsInRange(0, 2))
+		assert.Equal(t, [][]int{{0, 1, 2}, {0, 1, 3}, {0, 2, 1}, {1, 0, 2}, {2, 1, 3}}, ngrams)
+		assert.Equal(t, []int{3, 1, 5, 2, 7}, counts)
+	}
+}
+
 /*
 func TestLoadNgramIndex(t *testing.T) {
 	tmpDir := util.GetSysTmpDir()
@@ -285,3 +337,75 @@ func TestLoadNgramIndex(t *testing.T) {
 	assert.NotNil(t, idx)
 }
 */
+
+func TestNgramDistribution(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	d := NewDynamicNgramIndex(2, 4, map[string]string{"doc.genre": "col8"})
+	var genres []column.AttrVal
+	d.MetadataWriter().ForEachArg(func(i int, ad *column.ArgsDictWriter, col column.AttrValColumn) {
+		genres = []column.AttrVal{column.AttrVal(ad.AddValue("fiction")), column.AttrVal(ad.AddValue("news"))}
+	})
+	d.AddNgram([]int{0, 1}, 3, []column.AttrVal{genres[0]})
+	d.AddNgram([]int{0, 1}, 2, []column.AttrVal{genres[1]})
+	d.AddNgram([]int{0, 2}, 1, []column.AttrVal{genres[1]})
+	d.AddNgram([]int{1, 2}, 4, []column.AttrVal{genres[0]})
+	d.Finish()
+	assert.Nil(t, d.Save(dirPath))
+
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	assert.Nil(t, idx.LoadRange(0, 1))
+	res := idx.GetNgramsInRange(0, 1)
+	assert.Equal(t, 3, res.Size())
+	item := res.Next()
+	assert.Equal(t, []int{0, 1}, item.Ngram)
+	assert.Equal(t, 5, item.Count)
+	assert.Equal(t, []string{"fiction"}, item.Metadata)
+	assert.Equal(t, []*MetadataCount{
+		{Metadata: []string{"fiction"}, Count: 3},
+		{Metadata: []string{"news"}, Count: 2},
+	}, item.Distribution)
+	item = res.Next()
+	assert.Equal(t, []int{0, 2}, item.Ngram)
+	assert.Equal(t, []*MetadataCount{{Metadata: []string{"news"}, Count: 1}}, item.Distribution)
+}
+
+func TestUnigramDistribution(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	d := NewDynamicNgramIndex(1, 4, map[string]string{"doc.genre": "col8"})
+	var genres []column.AttrVal
+	d.MetadataWriter().ForEachArg(func(i int, ad *column.ArgsDictWriter, col column.AttrValColumn) {
+		genres = []column.AttrVal{column.AttrVal(ad.AddValue("fiction")), column.AttrVal(ad.AddValue("news"))}
+	})
+	d.AddNgram([]int{0}, 3, []column.AttrVal{genres[0]})
+	d.AddNgram([]int{0}, 2, []column.AttrVal{genres[1]})
+	d.AddNgram([]int{1}, 4, []column.AttrVal{genres[1]})
+	d.Finish()
+	assert.Nil(t, d.Save(dirPath))
+
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	assert.Nil(t, idx.LoadRange(0, 2))
+	res := idx.GetNgramsInRange(0, 2)
+	assert.Equal(t, 2, res.Size())
+	item := res.Next()
+	assert.Equal(t, []int{0}, item.Ngram)
+	assert.Equal(t, 5, item.Count)
+	assert.Equal(t, []*MetadataCount{
+		{Metadata: []string{"fiction"}, Count: 3},
+		{Metadata: []string{"news"}, Count: 2},
+	}, item.Distribution)
+	item = res.Next()
+	assert.Equal(t, []int{1}, item.Ngram)
+	assert.Equal(t, []*MetadataCount{{Metadata: []string{"news"}, Count: 4}}, item.Distribution)
+
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	assert.Nil(t, si.LoadRange(0, 2))
+	res = si.GetNgramsOfWidx(0)
+	assert.Equal(t, 1, res.Size())
+	assert.Equal(t, 5, res.Next().Count)
+}
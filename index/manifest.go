@@ -0,0 +1,272 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+// This file contains an implementation of the index manifest
+// (manifest.json) which describes the contents of an index
+// directory. The manifest is written as the last file of
+// the main index so its presence also means the index has
+// been completely written.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index/column"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+const (
+	manifestFilename = "manifest.json"
+
+	// ManifestFormatVersion specifies the current version
+	// of the index format. Indices with a higher version
+	// cannot be loaded.
+	ManifestFormatVersion = 1
+)
+
+// AttrInfo describes an indexed metadata attribute
+type AttrInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// BuildInfo contains information about the index origin
+// which cannot be derived from the index data itself.
+type BuildInfo struct {
+	NumTokens      int
+	NumWords       int
+	SourceChecksum string
+	Conf           *gconf.IndexBuilderConf
+
+	// PosAttrs contains names of positional attributes
+	// indexed in the positional attributes index (empty
+	// if there is no such index)
+	PosAttrs []string
+
+	// Normalization specifies how words have been
+	// normalized before adding them to the dictionary
+	Normalization wdict.Normalization
+}
+
+// Manifest describes the contents of an index directory
+type Manifest struct {
+	FormatVersion int        `json:"formatVersion"`
+	NgramSize     int        `json:"ngramSize"`
+	ColumnFormat  string     `json:"columnFormat"`
+	Attrs         []AttrInfo `json:"attrs"`
+	Rotations     []int      `json:"rotations"`
+	NumTokens     int        `json:"numTokens"`
+	NumWords      int        `json:"numWords"`
+
+	// NumNgrams is a number of stored n-gram records (an n-gram
+	// is stored once per each combination of its attribute values)
+	NumNgrams      int                     `json:"numNgrams"`
+	SourceChecksum string                  `json:"sourceChecksum,omitempty"`
+	BuildConf      *gconf.IndexBuilderConf `json:"buildConf,omitempty"`
+	Created        string                  `json:"created"`
+
+	// PosAttrs contains names of attributes of tuples stored
+	// in the positional attributes index (see PosAttrsDirPath)
+	PosAttrs []string `json:"posAttrs,omitempty"`
+
+	// Normalization specifies how words are normalized (query
+	// terms must be normalized the same way); older indices
+	// contain lowercased words only which corresponds to
+	// the zero value
+	Normalization wdict.Normalization `json:"normalization"`
+
+	// legacy is true in case the manifest has been
+	// derived from index files (i.e. no manifest.json
+	// has been found)
+	legacy bool
+
+	// dirPath is a directory the manifest has been loaded from
+	dirPath string
+}
+
+// AttrNames returns names of all the indexed attributes
+func (m *Manifest) AttrNames() []string {
+	ans := make([]string, len(m.Attrs))
+	for i, v := range m.Attrs {
+		ans[i] = v.Name
+	}
+	return ans
+}
+
+// IsLegacy returns true in case the index directory
+// contains no manifest.json and the manifest has been
+// derived by probing the index files
+func (m *Manifest) IsLegacy() bool {
+	return m.legacy
+}
+
+func (m *Manifest) hasRotation(rotation int) bool {
+	for _, v := range m.Rotations {
+		if v == rotation {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate tests whether the index described by the manifest
+// can be loaded with a specified rotation and attributes.
+func (m *Manifest) Validate(rotation int, attrs []string) error {
+	if m.FormatVersion > ManifestFormatVersion {
+		return gerrors.NewCorruptDataError(manifestPath(m.dirPath),
+			"unsupported index format version %d (max. supported version is %d)",
+			m.FormatVersion, ManifestFormatVersion)
+	}
+	if m.NgramSize < 1 || m.NgramSize > MaxNgramSize {
+		return gerrors.NewCorruptDataError(manifestPath(m.dirPath), "invalid n-gram size %d", m.NgramSize)
+	}
+	if !m.hasRotation(rotation) {
+		return &gerrors.InvalidArgumentError{
+			Arg:    "rotation",
+			Reason: fmt.Sprintf("index rotation %d not available", rotation),
+		}
+	}
+	known := m.AttrNames()
+	for _, attr := range attrs {
+		found := false
+		for _, v := range known {
+			if v == attr {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &gerrors.UnknownAttributeError{Attr: attr, Available: known}
+		}
+	}
+	return nil
+}
+
+// validateColumns tests whether actual index files
+// match the manifest
+func (m *Manifest) validateColumns(colsDirPath string, numNgrams int) error {
+	if m.legacy {
+		return nil
+	}
+	for i := 0; i < m.NgramSize; i++ {
+		colPath := column.CreateColIdxPath(i, colsDirPath)
+		if _, err := os.Stat(colPath); err != nil {
+			return gerrors.NewCorruptDataError(colPath, "column not found (n-gram size %d declared by manifest)", m.NgramSize)
+		}
+	}
+	if numNgrams != m.NumNgrams {
+		return gerrors.NewCorruptDataError(colsDirPath, "counts column contains %d items, manifest declares %d n-grams",
+			numNgrams, m.NumNgrams)
+	}
+	return nil
+}
+
+func manifestPath(dirPath string) string {
+	return filepath.Join(dirPath, manifestFilename)
+}
+
+func (m *Manifest) save(dirPath string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(manifestPath(dirPath), data, 0664)
+}
+
+func columnFormatIdent(format column.ColumnFormat) string {
+	if format == column.VarintFormat {
+		return "varint"
+	}
+	return "plain"
+}
+
+// createManifest creates a manifest describing the index. Rotations
+// are detected within dirPath so they should be already saved.
+func (nib *DynamicNgramIndex) createManifest(dirPath string) *Manifest {
+	ans := &Manifest{
+		FormatVersion: ManifestFormatVersion,
+		NgramSize:     len(nib.columns),
+		ColumnFormat:  columnFormatIdent(nib.columnFormat),
+		Attrs:         make([]AttrInfo, 0, nib.metadataWriter.NumCols()),
+		Rotations:     FindRotations(dirPath, len(nib.columns)),
+		NumNgrams:     nib.index.counts.Size(),
+		Created:       time.Now().Format(time.RFC3339),
+	}
+	nib.metadataWriter.ForEachArg(func(i int, v *column.ArgsDictWriter, col column.AttrValColumn) {
+		ans.Attrs = append(ans.Attrs, AttrInfo{Name: col.Name(), Type: column.ColumnTypeIdent(col)})
+	})
+	sort.Slice(ans.Attrs, func(i, j int) bool {
+		return ans.Attrs[i].Name < ans.Attrs[j].Name
+	})
+	if nib.buildInfo != nil {
+		ans.NumTokens = nib.buildInfo.NumTokens
+		ans.NumWords = nib.buildInfo.NumWords
+		ans.SourceChecksum = nib.buildInfo.SourceChecksum
+		ans.BuildConf = nib.buildInfo.Conf
+		ans.PosAttrs = nib.buildInfo.PosAttrs
+		ans.Normalization = nib.buildInfo.Normalization
+	}
+	return ans
+}
+
+// LoadManifest loads a manifest stored within an index
+// directory. In case there is no manifest (i.e. the index
+// has been created by an older version), a manifest
+// is derived by probing the index files.
+func LoadManifest(dirPath string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(manifestPath(dirPath))
+	if os.IsNotExist(err) {
+		return probeManifest(dirPath)
+
+	} else if err != nil {
+		return nil, err
+	}
+	ans := Manifest{dirPath: dirPath}
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, gerrors.NewCorruptDataError(manifestPath(dirPath), "%s", err)
+	}
+	return &ans, nil
+}
+
+func probeManifest(dirPath string) (*Manifest, error) {
+	ngramSize := DetectNgramSize(dirPath)
+	if ngramSize == 0 {
+		return nil, &gerrors.IndexNotFoundError{Path: dirPath}
+	}
+	attrs, err := column.FindArgsDicts(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	ans := &Manifest{
+		FormatVersion: ManifestFormatVersion,
+		NgramSize:     ngramSize,
+		Attrs:         make([]AttrInfo, len(attrs)),
+		Rotations:     FindRotations(dirPath, ngramSize),
+		legacy:        true,
+		dirPath:       dirPath,
+	}
+	for i, v := range attrs {
+		ans.Attrs[i] = AttrInfo{Name: v}
+	}
+	return ans, nil
+}
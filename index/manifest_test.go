@@ -0,0 +1,114 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+func saveTestingIndex(t *testing.T) string {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	d := createTestingDynamicIndex()
+	assert.Nil(t, d.CreateRotation(1).Save(dirPath))
+	d.SetBuildInfo(&BuildInfo{NumTokens: 20, NumWords: 4, SourceChecksum: "sha256:abcd"})
+	assert.Nil(t, d.Save(dirPath))
+	return dirPath
+}
+
+func TestSaveManifest(t *testing.T) {
+	dirPath := saveTestingIndex(t)
+	defer os.RemoveAll(dirPath)
+	m, err := LoadManifest(dirPath)
+	assert.Nil(t, err)
+	assert.False(t, m.IsLegacy())
+	assert.Equal(t, ManifestFormatVersion, m.FormatVersion)
+	assert.Equal(t, 3, m.NgramSize)
+	assert.Equal(t, "plain", m.ColumnFormat)
+	assert.Equal(t, []int{0, 1}, m.Rotations)
+	assert.Equal(t, 5, m.NumNgrams)
+	assert.Equal(t, 20, m.NumTokens)
+	assert.Equal(t, 4, m.NumWords)
+	assert.Equal(t, "sha256:abcd", m.SourceChecksum)
+	assert.Equal(t, []string{}, m.AttrNames())
+}
+
+func TestLegacyManifest(t *testing.T) {
+	dirPath := saveTestingIndex(t)
+	defer os.RemoveAll(dirPath)
+	assert.Nil(t, os.Remove(filepath.Join(dirPath, manifestFilename)))
+	m, err := LoadManifest(dirPath)
+	assert.Nil(t, err)
+	assert.True(t, m.IsLegacy())
+	assert.Equal(t, 3, m.NgramSize)
+	assert.Equal(t, []int{0, 1}, m.Rotations)
+	_, err = LoadRotatedNgramIndex(dirPath, 1, []string{}, column.FileStorage)
+	assert.Nil(t, err)
+}
+
+func TestLoadManifestNoIndex(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	_, err = LoadManifest(dirPath)
+	assert.True(t, gerrors.IsNotFound(err))
+}
+
+func TestManifestValidate(t *testing.T) {
+	m := &Manifest{
+		FormatVersion: ManifestFormatVersion,
+		NgramSize:     3,
+		Attrs:         []AttrInfo{{Name: "doc.id", Type: "col32"}},
+		Rotations:     []int{0},
+	}
+	assert.Nil(t, m.Validate(0, []string{"doc.id"}))
+	assert.True(t, gerrors.IsInvalidInput(m.Validate(0, []string{"doc.title"})))
+	assert.True(t, gerrors.IsInvalidInput(m.Validate(1, []string{})))
+	m.NgramSize = MaxNgramSize + 1
+	assert.True(t, gerrors.IsCorruptData(m.Validate(0, []string{})))
+	m.NgramSize = 3
+	m.FormatVersion = ManifestFormatVersion + 1
+	assert.True(t, gerrors.IsCorruptData(m.Validate(0, []string{})))
+}
+
+func TestLoadIndexUnknownAttr(t *testing.T) {
+	dirPath := saveTestingIndex(t)
+	defer os.RemoveAll(dirPath)
+	_, err := LoadNgramIndex(dirPath, []string{"doc.id"})
+	assert.Error(t, err)
+}
+
+func TestLoadIndexMissingRotation(t *testing.T) {
+	dirPath := saveTestingIndex(t)
+	defer os.RemoveAll(dirPath)
+	_, err := LoadRotatedNgramIndex(dirPath, 2, []string{}, column.FileStorage)
+	assert.Error(t, err)
+}
+
+func TestLoadIndexCountsMismatch(t *testing.T) {
+	dirPath := saveTestingIndex(t)
+	defer os.RemoveAll(dirPath)
+	counts := column.NewCountsColumn(3)
+	assert.Nil(t, counts.Save(dirPath))
+	_, err := LoadNgramIndex(dirPath, []string{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,170 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+const cursorVersion = 1
+
+// Cursor identifies a position within the n-gram tree of an index
+// with a specific rotation. The position is specified by a path
+// (rows within all the columns) of the last leaf of the last
+// n-gram returned by a previous page.
+type Cursor struct {
+	Rotation int
+	Path     []int
+}
+
+// Encode exports the cursor as an opaque URL-safe token
+func (c *Cursor) Encode() string {
+	buff := make([]byte, 0, (len(c.Path)+3)*binary.MaxVarintLen64)
+	buff = binary.AppendUvarint(buff, cursorVersion)
+	buff = binary.AppendUvarint(buff, uint64(c.Rotation))
+	buff = binary.AppendUvarint(buff, uint64(len(c.Path)))
+	for _, v := range c.Path {
+		buff = binary.AppendUvarint(buff, uint64(v))
+	}
+	return base64.RawURLEncoding.EncodeToString(buff)
+}
+
+func invalidCursorError(reason string) error {
+	return &gerrors.InvalidArgumentError{Arg: "cursor", Reason: reason}
+}
+
+// DecodeCursor imports a cursor encoded by Cursor.Encode
+func DecodeCursor(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, invalidCursorError("malformed token")
+	}
+	values := make([]int, 0, MaxNgramSize+3)
+	for len(data) > 0 && len(values) < cap(values) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 || v > uint64(^uint32(0)) {
+			return nil, invalidCursorError("malformed token")
+		}
+		values = append(values, int(v))
+		data = data[n:]
+	}
+	if len(data) > 0 || len(values) < 3 || values[0] != cursorVersion || values[2] != len(values)-3 {
+		return nil, invalidCursorError("malformed token")
+	}
+	return &Cursor{Rotation: values[1], Path: values[3:]}, nil
+}
+
+// validateFor tests whether the cursor may
+// identify a leaf of a specified index
+func (c *Cursor) validateFor(n *NgramIndex) error {
+	if c.Rotation != n.rotation {
+		return invalidCursorError(fmt.Sprintf("cursor belongs to index rotation %d", c.Rotation))
+	}
+	if len(c.Path) != len(n.values) {
+		return invalidCursorError("path does not match n-gram size")
+	}
+	// rows of other columns cannot be tested here as the columns
+	// are loaded partially (but walkLeaves ignores invalid rows)
+	if c.Path[0] >= n.values[0].Size() {
+		return invalidCursorError("path out of index")
+	}
+	return nil
+}
+
+// RowRange is an interval of zero column rows
+// (both ends included)
+type RowRange struct {
+	From int
+	To   int
+}
+
+// NewRowRanges creates a sorted list of intervals
+// covering provided zero column rows
+func NewRowRanges(rows []int) []RowRange {
+	sorted := append([]int{}, rows...)
+	sort.Ints(sorted)
+	ans := make([]RowRange, 0, len(sorted))
+	for _, row := range sorted {
+		if len(ans) > 0 && row <= ans[len(ans)-1].To+1 {
+			if row > ans[len(ans)-1].To {
+				ans[len(ans)-1].To = row
+			}
+
+		} else {
+			ans = append(ans, RowRange{From: row, To: row})
+		}
+	}
+	return ans
+}
+
+// AllRows returns an interval covering whole zero column
+func (si *SearchableIndex) AllRows() []RowRange {
+	size := si.index.values[0].Size()
+	if size == 0 {
+		return []RowRange{}
+	}
+	return []RowRange{{From: 0, To: size - 1}}
+}
+
+// GetNgramsPage returns up to limit n-grams starting within sorted
+// intervals of zero column rows. In case cursor is not nil, the
+// n-grams are returned starting right after the cursor position.
+// Along with the result, a cursor for the next page is returned
+// (nil in case there are no more n-grams). Column data are
+// loaded automatically.
+func (si *SearchableIndex) GetNgramsPage(ranges []RowRange, cursor *Cursor, limit int) (*NgramSearchResult, *Cursor, error) {
+	if limit < 1 {
+		return nil, nil, &gerrors.InvalidArgumentError{Arg: "limit", Reason: "paging requires a positive limit"}
+	}
+	var resume []int
+	if cursor != nil {
+		if err := cursor.validateFor(si.index); err != nil {
+			return nil, nil, err
+		}
+		resume = cursor.Path
+	}
+	result := &NgramSearchResult{}
+	var lastPath []int
+	for _, chunk := range si.index.splitChunks(ranges) {
+		if resume != nil && resume[0] > chunk.To {
+			continue
+		}
+		if err := si.LoadRange(chunk.From, chunk.To); err != nil {
+			return nil, nil, err
+		}
+		completed := si.index.forEachNgram(chunk.From, chunk.To, resume, si.filter,
+			func(ngram []int, count int, rows []int, path []int) bool {
+				if result.Size() == limit || !si.index.addResultItem(result, ngram, count, rows, si.filter.budget) {
+					return false
+				}
+				lastPath = path
+				return true
+			})
+		if err := si.Err(); err != nil {
+			return nil, nil, err
+		}
+		if !completed {
+			result.ResetCursor()
+			return result, &Cursor{Rotation: si.index.rotation, Path: lastPath}, nil
+		}
+	}
+	result.ResetCursor()
+	return result, nil, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	c := &Cursor{Rotation: 2, Path: []int{0, 130, 70000}}
+	c2, err := DecodeCursor(c.Encode())
+	assert.Nil(t, err)
+	assert.Equal(t, c, c2)
+}
+
+func TestDecodeCursorMalformed(t *testing.T) {
+	for _, token := range []string{"", "!!!", "AQ", (&Cursor{Path: []int{1}}).Encode() + "AA"} {
+		_, err := DecodeCursor(token)
+		assert.True(t, gerrors.IsInvalidInput(err), token)
+	}
+}
+
+func TestNewRowRanges(t *testing.T) {
+	assert.Equal(t, []RowRange{{From: 1, To: 3}, {From: 7, To: 7}, {From: 9, To: 10}},
+		NewRowRanges([]int{10, 3, 1, 2, 7, 9, 2}))
+	assert.Equal(t, []RowRange{}, NewRowRanges([]int{}))
+}
+
+func TestGetNgramsPage(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	for _, limit := range []int{1, 2, 3} {
+		var ngrams [][]int
+		var cursor *Cursor
+		for i := 0; i == 0 || cursor != nil; i++ {
+			var res *NgramSearchResult
+			res, cursor, err = si.GetNgramsPage(si.AllRows(), cursor, limit)
+			assert.Nil(t, err)
+			assert.True(t, res.Size() <= limit)
+			pageNgrams, _ := collectNgrams(res)
+			ngrams = append(ngrams, pageNgrams...)
+		}
+		assert.Equal(t, [][]int{{0, 1}, {0, 2}, {1, 2}}, ngrams, "limit %d", limit)
+	}
+}
+
+func TestGetNgramsPageRanges(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	res, cursor, err := si.GetNgramsPage([]RowRange{{From: 1, To: 1}}, nil, 5)
+	assert.Nil(t, err)
+	assert.Nil(t, cursor)
+	ngrams, counts := collectNgrams(res)
+	assert.Equal(t, [][]int{{1, 2}}, ngrams)
+	assert.Equal(t, []int{4}, counts)
+}
+
+func TestGetNgramsPageInvalidCursor(t *testing.T) {
+	dirPath := saveTestingGenreIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{"doc.genre"})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	for _, c := range []*Cursor{{Rotation: 1, Path: []int{0, 0}}, {Path: []int{0}}, {Path: []int{5, 0}}} {
+		_, _, err = si.GetNgramsPage(si.AllRows(), c, 1)
+		assert.True(t, gerrors.IsInvalidInput(err))
+	}
+}
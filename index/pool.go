@@ -0,0 +1,201 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"sync"
+)
+
+// loadChunkRows specifies max. number of zero column
+// rows loaded (and searched) at once
+const loadChunkRows = 1000
+
+// splitRanges splits row ranges into chunks
+// with at most chunkSize rows
+func splitRanges(ranges []RowRange, chunkSize int) []RowRange {
+	ans := make([]RowRange, 0, len(ranges))
+	for _, rng := range ranges {
+		for from := rng.From; from <= rng.To; from += chunkSize {
+			to := from + chunkSize - 1
+			if to > rng.To {
+				to = rng.To
+			}
+			ans = append(ans, RowRange{From: from, To: to})
+		}
+	}
+	return ans
+}
+
+// splitChunks splits zero column row ranges into chunks
+// loaded at once (see splitRanges). Zero column rows of the same
+// word (i.e. leaves of a repeated 1-gram) are always kept within
+// a single chunk so the n-gram is not returned twice.
+func (n *NgramIndex) splitChunks(ranges []RowRange) []RowRange {
+	col := n.values[0]
+	chunks := splitRanges(ranges, loadChunkRows)
+	ans := chunks[:0]
+	for _, chunk := range chunks {
+		if len(ans) > 0 {
+			prev := &ans[len(ans)-1]
+			for chunk.From <= chunk.To && chunk.From == prev.To+1 &&
+				col.Item(chunk.From).Index == col.Item(prev.To).Index {
+				prev.To++
+				chunk.From++
+			}
+			if chunk.From > chunk.To {
+				continue
+			}
+		}
+		ans = append(ans, chunk)
+	}
+	return ans
+}
+
+// processChunks splits zero column row ranges into chunks
+// and calls fn for each of them (along with its position
+// within all the chunks). The chunks are processed by up to
+// numWorkers workers, each using its own view of the index
+// with the respective chunk already loaded. Processing stops
+// on the first error or once the search is stopped (see Err).
+func (si *SearchableIndex) processChunks(ranges []RowRange, fn func(view *NgramIndex, chunkIdx int, chunk RowRange)) error {
+	chunks := si.index.splitChunks(ranges)
+	numWorkers := si.numWorkers
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > len(chunks) {
+		numWorkers = len(chunks)
+	}
+	jobs := make(chan int)
+	var firstErr error
+	var errMutex sync.Mutex
+	setErr := func(err error) {
+		errMutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMutex.Unlock()
+	}
+	getErr := func() error {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		if firstErr != nil {
+			return firstErr
+		}
+		return si.Err()
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			view := si.index.fork()
+			for chunkIdx := range jobs {
+				chunk := chunks[chunkIdx]
+				if err := view.loadData(chunk.From, chunk.To); err != nil {
+					setErr(err)
+					continue
+				}
+				fn(view, chunkIdx, chunk)
+			}
+		}()
+	}
+	for i := range chunks {
+		if getErr() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return getErr()
+}
+
+// GetNgramsInRanges returns all the n-grams starting within
+// sorted intervals of zero column rows. The intervals are loaded
+// and searched in chunks by a limited number of workers (see
+// SetNumWorkers). The n-grams are returned in the index order.
+func (si *SearchableIndex) GetNgramsInRanges(ranges []RowRange) (*NgramSearchResult, error) {
+	results := make([]*NgramSearchResult, len(si.index.splitChunks(ranges)))
+	err := si.processChunks(ranges, func(view *NgramIndex, chunkIdx int, chunk RowRange) {
+		results[chunkIdx] = view.getNgramsInRange(chunk.From, chunk.To, si.filter)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ans := &NgramSearchResult{}
+	for _, res := range results {
+		ans.Append(res)
+	}
+	return ans, nil
+}
+
+// GetTopNgramsInRanges is like GetNgramsInRanges followed by TopK
+// but the first k n-grams (according to less) are selected while
+// searching the chunks so only O(k) items are kept per worker.
+// Metadata are decoded only for the selected n-grams unless
+// lessUsesMetadata is set (then less needs them for all the compared
+// n-grams). Only the returned n-grams count against the result
+// budget. A negative k means no limit (i.e. all the n-grams are sorted).
+func (si *SearchableIndex) GetTopNgramsInRanges(ranges []RowRange, k int, less ItemLess,
+	lessUsesMetadata bool) (*NgramSearchResult, error) {
+	if k < 0 {
+		ans, err := si.GetNgramsInRanges(ranges)
+		if err != nil {
+			return nil, err
+		}
+		ans.Sort(less)
+		return ans, nil
+	}
+	top := &itemHeap{less: less}
+	var topMutex sync.Mutex
+	err := si.processChunks(ranges, func(view *NgramIndex, chunkIdx int, chunk RowRange) {
+		chunkTop := view.getTopNgramsInRange(chunk.From, chunk.To, si.filter, k, less, lessUsesMetadata)
+		topMutex.Lock()
+		for _, item := range chunkTop.items {
+			top.offer(item, k)
+		}
+		topMutex.Unlock()
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := top.popSorted()
+	for range items {
+		if !si.filter.budget.take() {
+			return nil, si.filter.budget.Err()
+		}
+	}
+	ans := &NgramSearchResult{}
+	ans.relink(items)
+	return ans, nil
+}
+
+// CountNgramsInRanges is like GetNgramsInRanges but it returns
+// only aggregated counts of the n-grams
+func (si *SearchableIndex) CountNgramsInRanges(ranges []RowRange) (NgramStats, error) {
+	results := make([]NgramStats, len(si.index.splitChunks(ranges)))
+	err := si.processChunks(ranges, func(view *NgramIndex, chunkIdx int, chunk RowRange) {
+		results[chunkIdx] = view.countNgramsInRange(chunk.From, chunk.To, si.filter)
+	})
+	if err != nil {
+		return NgramStats{}, err
+	}
+	var ans NgramStats
+	for _, res := range results {
+		ans.Merge(res)
+	}
+	return ans, nil
+}
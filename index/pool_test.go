@@ -0,0 +1,252 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+const testingLargeIndexWords = 2500
+
+// saveTestingLargeIndex saves a 2-gram index with more
+// zero column rows than a single loaded chunk
+func saveTestingLargeIndex(t *testing.T) string {
+	return saveTestingLargeIndexAs(t, column.PlainFormat)
+}
+
+func saveTestingLargeIndexAs(t *testing.T, format column.ColumnFormat) string {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	d := NewDynamicNgramIndex(2, 100, map[string]string{})
+	d.SetColumnFormat(format)
+	for w := 0; w < testingLargeIndexWords; w++ {
+		d.AddNgram([]int{w, w + 1}, w%7+1, nil)
+		if w%2 == 0 {
+			d.AddNgram([]int{w, w + 2}, 1, nil)
+		}
+	}
+	d.Finish()
+	assert.Nil(t, d.Save(dirPath))
+	return dirPath
+}
+
+func TestSplitRanges(t *testing.T) {
+	assert.Equal(t,
+		[]RowRange{{From: 0, To: 2}, {From: 3, To: 4}, {From: 7, To: 7}, {From: 9, To: 11}, {From: 12, To: 12}},
+		splitRanges([]RowRange{{From: 0, To: 4}, {From: 7, To: 7}, {From: 9, To: 12}}, 3))
+	assert.Equal(t, []RowRange{}, splitRanges([]RowRange{}, 3))
+}
+
+func TestGetNgramsInRangesWorkers(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	expected, err := OpenSearchableIndex(context.Background(), idx, nil).GetAllNgrams()
+	assert.Nil(t, err)
+	expNgrams, expCounts := collectNgrams(expected)
+	assert.Equal(t, testingLargeIndexWords*3/2, len(expNgrams))
+
+	for _, numWorkers := range []int{0, 1, 3, 16} {
+		si := OpenSearchableIndex(context.Background(), idx, nil)
+		si.SetNumWorkers(numWorkers)
+		res, err := si.GetNgramsInRanges(si.AllRows())
+		assert.Nil(t, err)
+		ngrams, counts := collectNgrams(res)
+		assert.Equal(t, expNgrams, ngrams, "workers: %d", numWorkers)
+		assert.Equal(t, expCounts, counts, "workers: %d", numWorkers)
+
+		stats, err := si.CountNgramsInRanges(si.AllRows())
+		assert.Nil(t, err)
+		assert.Equal(t, len(expNgrams), stats.NumNgrams)
+		assert.Equal(t, 1, stats.MinCount)
+		assert.Equal(t, 7, stats.MaxCount)
+	}
+}
+
+func TestGetNgramsInRangesSubset(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetNumWorkers(4)
+	res, err := si.GetNgramsInRanges([]RowRange{{From: 998, To: 1001}, {From: 2499, To: 2499}})
+	assert.Nil(t, err)
+	ngrams, _ := collectNgrams(res)
+	assert.Equal(t,
+		[][]int{{998, 999}, {998, 1000}, {999, 1000}, {1000, 1001}, {1000, 1002}, {1001, 1002}, {2499, 2500}},
+		ngrams)
+}
+
+func TestGetNgramsInRangesStopped(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetNumWorkers(4)
+	si.SetResultBudget(NewResultBudget(100))
+	_, err = si.GetNgramsInRanges(si.AllRows())
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	si = OpenSearchableIndex(ctx, idx, nil)
+	si.SetNumWorkers(4)
+	_, err = si.CountNgramsInRanges(si.AllRows())
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestGetTopNgramsInRanges(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	less := func(item1 *NgramResultItem, item2 *NgramResultItem) bool {
+		if item1.Count != item2.Count {
+			return item1.Count > item2.Count
+		}
+		return compareNgrams(item1.Ngram, item2.Ngram) < 0
+	}
+	for _, k := range []int{0, 1, 10, 1500, 5000, -1} {
+		expected, err := OpenSearchableIndex(context.Background(), idx, nil).GetNgramsInRanges(
+			[]RowRange{{From: 10, To: 2200}})
+		assert.Nil(t, err)
+		expected.TopK(k, less)
+		expNgrams, expCounts := collectNgrams(expected)
+		for _, numWorkers := range []int{1, 3} {
+			si := OpenSearchableIndex(context.Background(), idx, nil)
+			si.SetNumWorkers(numWorkers)
+			res, err := si.GetTopNgramsInRanges([]RowRange{{From: 10, To: 2200}}, k, less, false)
+			assert.Nil(t, err)
+			ngrams, counts := collectNgrams(res)
+			assert.Equal(t, expNgrams, ngrams, "k: %d, workers: %d", k, numWorkers)
+			assert.Equal(t, expCounts, counts, "k: %d, workers: %d", k, numWorkers)
+		}
+	}
+}
+
+func TestGetTopNgramsInRangesBudget(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	// only the selected n-grams count against the budget
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetNumWorkers(4)
+	si.SetResultBudget(NewResultBudget(100))
+	res, err := si.GetTopNgramsInRanges(si.AllRows(), 100, byCountDesc, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, res.Size())
+
+	si = OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetResultBudget(NewResultBudget(100))
+	_, err = si.GetTopNgramsInRanges(si.AllRows(), 101, byCountDesc, false)
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+}
+
+func TestRepeatedUnigramChunks(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	d := NewDynamicNgramIndex(1, 100, map[string]string{})
+	for w := 0; w < 1200; w++ {
+		d.AddNgram([]int{w}, 1, nil)
+		if w == loadChunkRows-1 {
+			// leaves at both sides of the first chunk boundary
+			d.AddNgram([]int{w}, 2, nil)
+		}
+	}
+	d.Finish()
+	assert.Nil(t, d.Save(dirPath))
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	assert.Equal(t, []RowRange{{From: 0, To: 1000}, {From: 1001, To: 1200}}, si.index.splitChunks(si.AllRows()))
+
+	si.SetNumWorkers(2)
+	res, err := si.GetNgramsInRanges(si.AllRows())
+	assert.Nil(t, err)
+	ngrams, counts := collectNgrams(res)
+	assert.Equal(t, 1200, len(ngrams))
+	assert.Equal(t, []int{loadChunkRows - 1}, ngrams[loadChunkRows-1])
+	assert.Equal(t, 3, counts[loadChunkRows-1])
+
+	page, cursor, err := si.GetNgramsPage(si.AllRows(), nil, loadChunkRows)
+	assert.Nil(t, err)
+	assert.Equal(t, loadChunkRows, page.Size())
+	page, cursor, err = si.GetNgramsPage(si.AllRows(), cursor, loadChunkRows)
+	assert.Nil(t, err)
+	assert.Nil(t, cursor)
+	ngrams, _ = collectNgrams(page)
+	assert.Equal(t, 200, len(ngrams))
+	assert.Equal(t, []int{loadChunkRows}, ngrams[0])
+}
+
+func TestForkedIndexIndependence(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	view1 := idx.fork()
+	view2 := idx.fork()
+	assert.Nil(t, view1.loadData(0, 1))
+	assert.Nil(t, view2.loadData(2000, 2001))
+	ngrams, counts := collectNgrams(view1.getNgramsInRange(0, 1, searchFilter{}))
+	assert.Equal(t, [][]int{{0, 1}, {0, 2}, {1, 2}}, ngrams)
+	assert.Equal(t, []int{1, 1, 2}, counts)
+	ngrams, _ = collectNgrams(view2.getNgramsInRange(2001, 2001, searchFilter{}))
+	assert.Equal(t, [][]int{{2001, 2002}}, ngrams)
+}
+
+func TestWordRanges(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	si.SetWordRanges([]*WordRange{nil, {From: 1000, To: 1001}})
+	res, err := si.GetNgramsInRanges(si.WordRows(nil))
+	assert.Nil(t, err)
+	ngrams, _ := collectNgrams(res)
+	assert.Equal(t, [][]int{{998, 1000}, {999, 1000}, {1000, 1001}}, ngrams)
+
+	si.SetWordRanges([]*WordRange{{From: 10, To: 11}, {From: 12, To: 20}})
+	res, err = si.GetNgramsInRanges(si.WordRows(&WordRange{From: 10, To: 11}))
+	assert.Nil(t, err)
+	ngrams, _ = collectNgrams(res)
+	assert.Equal(t, [][]int{{10, 12}, {11, 12}}, ngrams)
+}
+
+func TestWordRows(t *testing.T) {
+	dirPath := saveTestingLargeIndex(t)
+	defer os.RemoveAll(dirPath)
+	idx, err := LoadNgramIndex(dirPath, []string{})
+	assert.Nil(t, err)
+	si := OpenSearchableIndex(context.Background(), idx, nil)
+	assert.Equal(t, []RowRange{{From: 5, To: 7}}, si.WordRows(&WordRange{From: 5, To: 7}))
+	assert.Equal(t, []RowRange{{From: 2490, To: 2499}}, si.WordRows(&WordRange{From: 2490, To: 5000}))
+	assert.Equal(t, []RowRange{}, si.WordRows(&WordRange{From: 3000, To: 3100}))
+	assert.Equal(t, []RowRange{}, si.WordRows(&WordRange{From: 0, To: -1}))
+	assert.Equal(t, si.AllRows(), si.WordRows(nil))
+}
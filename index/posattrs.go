@@ -0,0 +1,60 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+// This file contains helpers of the positional attributes index.
+// Besides the main index of word forms, an index can contain
+// an index of n-grams of positional attribute tuples (word form,
+// lemma, tag,...). The index is stored in a subdirectory of the
+// main index directory along with its own dictionary of tuples
+// and dictionaries of individual attributes' values. It has the
+// same structure as the main index (including rotations and
+// metadata) so it can be loaded and searched the same way.
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const (
+	posAttrsDirName = "posattrs"
+
+	// WordPosAttr is a name of the positional attribute
+	// containing word forms (always the first one of a tuple)
+	WordPosAttr = "word"
+
+	// tupleSeparator separates values of a tuple within
+	// the tuple dictionary (a tab cannot be contained in
+	// values parsed from a vertical file)
+	tupleSeparator = "\t"
+)
+
+// PosAttrsDirPath returns a path of a directory containing
+// the index of positional attribute tuples
+func PosAttrsDirPath(dirPath string) string {
+	return filepath.Join(dirPath, posAttrsDirName)
+}
+
+// JoinTuple encodes values of positional attributes
+// into a single token of the positional attributes index
+func JoinTuple(values []string) string {
+	return strings.Join(values, tupleSeparator)
+}
+
+// SplitTuple decodes a token of the positional attributes
+// index into values of individual attributes
+func SplitTuple(tuple string) []string {
+	return strings.Split(tuple, tupleSeparator)
+}
@@ -0,0 +1,138 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+// This file contains an implementation of rotated (permuted)
+// n-gram indices. The main index allows an efficient search
+// only by the first token of an n-gram. A rotated index with
+// rotation k stores n-grams with tokens shifted k positions
+// to the left (e.g. for k = 1, "in any case" is stored
+// as "any case in"), which allows searching efficiently
+// by the token at position k (and subsequent ones).
+//
+// Rotated indices are stored in subdirectories of the main
+// index directory and they share all the dictionaries
+// (words, metadata attributes) with the main index.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+const (
+	rotationDirMask = "rot_%d"
+)
+
+// RotationDirPath returns a path of a directory containing
+// a rotated index with a specified rotation.
+func RotationDirPath(dirPath string, rotation int) string {
+	return filepath.Join(dirPath, fmt.Sprintf(rotationDirMask, rotation))
+}
+
+// FindRotations returns a list of all the available
+// index rotations (including 0 = the main index) stored
+// within a specified directory.
+func FindRotations(dirPath string, ngramSize int) []int {
+	ans := []int{0}
+	for i := 1; i < ngramSize; i++ {
+		tmp := column.CreateColIdxPath(0, RotationDirPath(dirPath, i))
+		if _, err := os.Stat(tmp); err == nil {
+			ans = append(ans, i)
+		}
+	}
+	return ans
+}
+
+// rotateNgram returns a new n-gram with tokens shifted
+// 'rotation' positions to the left.
+func rotateNgram(ngram []int, rotation int) []int {
+	ans := make([]int, len(ngram))
+	for i := range ngram {
+		ans[i] = ngram[(i+rotation)%len(ngram)]
+	}
+	return ans
+}
+
+// unrotateNgram reverts rotateNgram. In case
+// rotation is zero, the original slice is returned.
+func unrotateNgram(ngram []int, rotation int) []int {
+	if rotation == 0 {
+		return ngram
+	}
+	ans := make([]int, len(ngram))
+	for i, v := range ngram {
+		ans[(i+rotation)%len(ngram)] = v
+	}
+	return ans
+}
+
+func compareNgrams(n1 []int, n2 []int) int {
+	for i := 0; i < len(n1) && i < len(n2); i++ {
+		if n1[i] < n2[i] {
+			return -1
+
+		} else if n1[i] > n2[i] {
+			return 1
+		}
+	}
+	return len(n1) - len(n2)
+}
+
+type rotatedRecord struct {
+	ngram []int
+	row   int
+}
+
+// CreateRotation creates a new index containing all the n-grams
+// of the current one rotated 'rotation' positions to the left.
+// The method should be called once the current index is finished.
+// Please note that all the n-grams must fit into memory.
+func (nib *DynamicNgramIndex) CreateRotation(rotation int) *DynamicNgramIndex {
+	ngramSize := len(nib.index.values)
+	records := make([]rotatedRecord, 0, nib.index.counts.Size())
+	nib.index.walkLeaves(0, 0, nib.index.values[0].Size()-1, make([]int, 0, ngramSize), make([]int, 0, ngramSize),
+		nil, nil, func(ngram []int, path []int) bool {
+			records = append(records, rotatedRecord{ngram: rotateNgram(ngram, rotation), row: path[ngramSize-1]})
+			return true
+		})
+	sort.Slice(records, func(i, j int) bool {
+		return compareNgrams(records[i].ngram, records[j].ngram) < 0
+	})
+
+	cursors := make([]int, ngramSize)
+	for i := range cursors {
+		cursors[i] = -1
+	}
+	nindex := NewNgramIndex(ngramSize, nib.initialLength, nil)
+	ans := &DynamicNgramIndex{
+		initialLength:  nib.initialLength,
+		index:          nindex,
+		columns:        writableColumns(nindex),
+		cursors:        cursors,
+		metadataWriter: nib.metadataWriter.NewSharedDictsWriter(),
+		rotation:       rotation,
+		columnFormat:   nib.columnFormat,
+	}
+	nindex.rotation = rotation
+	for _, rec := range records {
+		ans.AddNgram(rec.ngram, int(nib.index.counts.Get(rec.row)), nib.metadataWriter.Get(rec.row))
+	}
+	ans.Finish()
+	return ans
+}
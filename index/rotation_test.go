@@ -0,0 +1,104 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index/column"
+)
+
+func createTestingDynamicIndex() *DynamicNgramIndex {
+	d := NewDynamicNgramIndex(3, 4, map[string]string{})
+	d.AddNgram([]int{0, 1, 2}, 3, []column.AttrVal{})
+	d.AddNgram([]int{0, 1, 3}, 1, []column.AttrVal{})
+	d.AddNgram([]int{0, 2, 1}, 5, []column.AttrVal{})
+	d.AddNgram([]int{1, 0, 2}, 2, []column.AttrVal{})
+	d.AddNgram([]int{2, 1, 3}, 7, []column.AttrVal{})
+	d.Finish()
+	return d
+}
+
+func collectNgrams(r *NgramSearchResult) ([][]int, []int) {
+	ngrams := make([][]int, 0, r.Size())
+	counts := make([]int, 0, r.Size())
+	for r.HasNext() {
+		v := r.Next()
+		ngrams = append(ngrams, v.Ngram)
+		counts = append(counts, v.Count)
+	}
+	return ngrams, counts
+}
+
+func TestRotateNgram(t *testing.T) {
+	assert.Equal(t, []int{2, 3, 1}, rotateNgram([]int{1, 2, 3}, 1))
+	assert.Equal(t, []int{3, 1, 2}, rotateNgram([]int{1, 2, 3}, 2))
+	assert.Equal(t, []int{1, 2, 3}, rotateNgram([]int{1, 2, 3}, 0))
+}
+
+func TestUnrotateNgram(t *testing.T) {
+	assert.Equal(t, []int{1, 2, 3}, unrotateNgram([]int{2, 3, 1}, 1))
+	assert.Equal(t, []int{1, 2, 3}, unrotateNgram([]int{3, 1, 2}, 2))
+	assert.Equal(t, []int{1, 2, 3}, unrotateNgram([]int{1, 2, 3}, 0))
+}
+
+func TestDynamicIndexAllNgrams(t *testing.T) {
+	d := createTestingDynamicIndex()
+	ngrams, counts := collectNgrams(d.GetIndex().GetNgramsInRange(0, 2))
+	assert.Equal(t, [][]int{{0, 1, 2}, {0, 1, 3}, {0, 2, 1}, {1, 0, 2}, {2, 1, 3}}, ngrams)
+	assert.Equal(t, []int{3, 1, 5, 2, 7}, counts)
+}
+
+func TestDynamicIndexNgramsAtNonFirstRow(t *testing.T) {
+	d := createTestingDynamicIndex()
+	ngrams, counts := collectNgrams(d.GetNgramsAt(1))
+	assert.Equal(t, [][]int{{1, 0, 2}}, ngrams)
+	assert.Equal(t, []int{2}, counts)
+}
+
+func TestCreateRotation(t *testing.T) {
+	d := createTestingDynamicIndex()
+	rot := d.CreateRotation(1)
+	assert.Equal(t, 1, rot.GetIndex().Rotation())
+	// the first column now contains the middle words
+	// of the original n-grams (i.e. 0, 1, 2)
+	assert.Equal(t, 3, rot.GetIndex().values[0].Size())
+	ngrams, counts := collectNgrams(rot.GetNgramsAt(1))
+	// n-grams are returned in the original word order
+	assert.Equal(t, [][]int{{0, 1, 2}, {0, 1, 3}, {2, 1, 3}}, ngrams)
+	assert.Equal(t, []int{3, 1, 7}, counts)
+}
+
+func TestSaveAndLoadRotation(t *testing.T) {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	d := createTestingDynamicIndex()
+	assert.Nil(t, d.CreateRotation(2).Save(dirPath))
+	assert.Nil(t, d.Save(dirPath))
+
+	assert.Equal(t, 3, DetectNgramSize(dirPath))
+	assert.Equal(t, []int{0, 2}, FindRotations(dirPath, 3))
+
+	idx, err := LoadRotatedNgramIndex(dirPath, 2, []string{}, column.FileStorage)
+	assert.Nil(t, err)
+	idx.LoadRange(2, 2)
+	ngrams, counts := collectNgrams(idx.GetNgramsInRange(2, 2))
+	assert.Equal(t, [][]int{{0, 1, 3}, {2, 1, 3}}, ngrams)
+	assert.Equal(t, []int{1, 7}, counts)
+}
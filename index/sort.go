@@ -0,0 +1,120 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// ItemLess specifies an order of n-gram result items
+type ItemLess func(item1 *NgramResultItem, item2 *NgramResultItem) bool
+
+// itemHeap keeps the "largest" item (according
+// to less) on the top
+type itemHeap struct {
+	items []*NgramResultItem
+	less  ItemLess
+}
+
+func (h *itemHeap) Len() int { return len(h.items) }
+
+func (h *itemHeap) Less(i, j int) bool { return h.less(h.items[j], h.items[i]) }
+
+func (h *itemHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *itemHeap) Push(x interface{}) { h.items = append(h.items, x.(*NgramResultItem)) }
+
+func (h *itemHeap) Pop() interface{} {
+	ans := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return ans
+}
+
+// offer adds an item to a heap keeping at most k items. In case
+// the heap is full, the item replaces the top one only if it
+// precedes it. The item left out of the heap (i.e. either the offered
+// or the replaced one) is returned (nil if there is no such item).
+func (h *itemHeap) offer(item *NgramResultItem, k int) *NgramResultItem {
+	if h.Len() < k {
+		heap.Push(h, item)
+		return nil
+	}
+	if k > 0 && h.less(item, h.items[0]) {
+		ans := h.items[0]
+		h.items[0] = item
+		heap.Fix(h, 0)
+		return ans
+	}
+	return item
+}
+
+// popSorted empties the heap and returns its items
+// sorted according to less
+func (h *itemHeap) popSorted() []*NgramResultItem {
+	items := make([]*NgramResultItem, h.Len())
+	for i := len(items) - 1; i >= 0; i-- {
+		items[i] = heap.Pop(h).(*NgramResultItem)
+	}
+	return items
+}
+
+// relink replaces the result items by the provided ones
+// (in the same order). The cursor is reset.
+func (nsr *NgramSearchResult) relink(items []*NgramResultItem) {
+	nsr.first = nil
+	nsr.last = nil
+	for i := len(items) - 1; i >= 0; i-- {
+		items[i].next = nsr.first
+		nsr.first = items[i]
+		if nsr.last == nil {
+			nsr.last = items[i]
+		}
+	}
+	nsr.curr = nsr.first
+	nsr.size = len(items)
+}
+
+// Sort sorts the result items. The sort is stable.
+func (nsr *NgramSearchResult) Sort(less ItemLess) {
+	items := make([]*NgramResultItem, 0, nsr.size)
+	for curr := nsr.first; curr != nil; curr = curr.next {
+		items = append(items, curr)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return less(items[i], items[j])
+	})
+	nsr.relink(items)
+}
+
+// TopK keeps only the first k items according to a specified
+// order (and sorts them). Unlike Sort, the method requires
+// only O(k) additional memory and O(n log k) time.
+// In case of items equal according to less, the result
+// is not guaranteed to be stable. A negative k means
+// no limit (i.e. the same as Sort).
+func (nsr *NgramSearchResult) TopK(k int, less ItemLess) {
+	if k < 0 || k >= nsr.size {
+		nsr.Sort(less)
+		return
+	}
+	h := &itemHeap{items: make([]*NgramResultItem, 0, k), less: less}
+	if k > 0 {
+		for curr := nsr.first; curr != nil; curr = curr.next {
+			h.offer(curr, k)
+		}
+	}
+	nsr.relink(h.popSorted())
+}
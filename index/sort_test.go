@@ -0,0 +1,99 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createCountedResult(counts []int) *NgramSearchResult {
+	r := &NgramSearchResult{}
+	for i, c := range counts {
+		r.addValue([]int{i}, c, nil)
+	}
+	r.ResetCursor()
+	return r
+}
+
+func byCountDesc(item1 *NgramResultItem, item2 *NgramResultItem) bool {
+	if item1.Count != item2.Count {
+		return item1.Count > item2.Count
+	}
+	return item1.Ngram[0] < item2.Ngram[0]
+}
+
+func TestNgramSearchResultSort(t *testing.T) {
+	r := createCountedResult([]int{3, 10, 1, 7, 3})
+	r.Sort(byCountDesc)
+	ngrams, counts := collectNgrams(r)
+	assert.Equal(t, [][]int{{1}, {3}, {0}, {4}, {2}}, ngrams)
+	assert.Equal(t, []int{10, 7, 3, 3, 1}, counts)
+	assert.Equal(t, 5, r.Size())
+}
+
+func TestNgramSearchResultTopK(t *testing.T) {
+	r := createCountedResult([]int{3, 10, 1, 7, 3})
+	r.TopK(3, byCountDesc)
+	ngrams, counts := collectNgrams(r)
+	assert.Equal(t, [][]int{{1}, {3}, {0}}, ngrams)
+	assert.Equal(t, []int{10, 7, 3}, counts)
+	assert.Equal(t, 3, r.Size())
+	assert.Equal(t, 0, r.last.Ngram[0])
+}
+
+func TestNgramSearchResultTopKLargerThanSize(t *testing.T) {
+	r := createCountedResult([]int{3, 10})
+	r.TopK(5, byCountDesc)
+	_, counts := collectNgrams(r)
+	assert.Equal(t, []int{10, 3}, counts)
+}
+
+func TestNgramSearchResultTopKZero(t *testing.T) {
+	r := createCountedResult([]int{3, 10})
+	r.TopK(0, byCountDesc)
+	assert.Equal(t, 0, r.Size())
+	assert.False(t, r.HasNext())
+}
+
+func TestNgramSearchResultTopKNegative(t *testing.T) {
+	r := createCountedResult([]int{3, 10, 1, 7, 3})
+	r.TopK(-2, byCountDesc)
+	_, counts := collectNgrams(r)
+	assert.Equal(t, []int{10, 7, 3, 3, 1}, counts)
+}
+
+func TestNgramSearchResultTopKSameAsSort(t *testing.T) {
+	counts := make([]int, 1000)
+	for i := range counts {
+		counts[i] = rand.Intn(100)
+	}
+	r := createCountedResult(counts)
+	r.TopK(50, byCountDesc)
+	_, topCounts := collectNgrams(r)
+	sort.Sort(sort.Reverse(sort.IntSlice(counts)))
+	assert.Equal(t, counts[:50], topCounts)
+}
+
+func TestNgramSearchResultSortAppend(t *testing.T) {
+	r := createCountedResult([]int{3, 10, 1})
+	r.Sort(byCountDesc)
+	r.Append(createCountedResult([]int{5}))
+	_, counts := collectNgrams(r)
+	assert.Equal(t, []int{10, 3, 1, 5}, counts)
+}
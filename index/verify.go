@@ -0,0 +1,260 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+// This file contains an implementation of index integrity
+// verification. All the files are read sequentially without
+// loading whole columns into memory.
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/tomachalek/gloomy/index/column"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+// VerificationCheck is a result of a single verification check
+type VerificationCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// VerificationReport contains results of all
+// the checks performed on an index directory
+type VerificationReport struct {
+	DirPath string               `json:"dirPath"`
+	Checks  []*VerificationCheck `json:"checks"`
+}
+
+// Passed returns true if all the checks passed
+func (vr *VerificationReport) Passed() bool {
+	return vr.NumFailed() == 0
+}
+
+// NumFailed returns number of failed checks
+func (vr *VerificationReport) NumFailed() int {
+	ans := 0
+	for _, v := range vr.Checks {
+		if !v.Passed {
+			ans++
+		}
+	}
+	return ans
+}
+
+func (vr *VerificationReport) add(name string, err error) {
+	check := &VerificationCheck{Name: name, Passed: err == nil}
+	if err != nil {
+		check.Message = err.Error()
+	}
+	vr.Checks = append(vr.Checks, check)
+}
+
+func (vr *VerificationReport) addNote(name string, msg string) {
+	vr.Checks = append(vr.Checks, &VerificationCheck{Name: name, Passed: true, Message: msg})
+}
+
+// ----------------------------------------------------------------------------
+
+// violations counts invalid values found within a column
+// and keeps a description of the first one
+type violations struct {
+	count int
+	first string
+}
+
+func (v *violations) add(format string, args ...interface{}) {
+	if v.count == 0 {
+		v.first = fmt.Sprintf(format, args...)
+	}
+	v.count++
+}
+
+func (v *violations) err(what string) error {
+	if v.count == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d %s (first: %s)", v.count, what, v.first)
+}
+
+// ----------------------------------------------------------------------------
+
+type indexVerifier struct {
+	report    *VerificationReport
+	dirPath   string
+	manifest  *Manifest
+	numWords  int
+	dictSizes map[string]int
+}
+
+func (iv *indexVerifier) checkName(colsDirPath string, file string) string {
+	rel, err := filepath.Rel(iv.dirPath, filepath.Join(colsDirPath, file))
+	if err != nil {
+		return file
+	}
+	return rel
+}
+
+// verifyColumns checks index columns, counts and metadata
+// columns of the main index or one of its rotations
+func (iv *indexVerifier) verifyColumns(colsDirPath string) {
+	colSizes := make([]int, iv.manifest.NgramSize)
+	lastUpTo := make([]int, iv.manifest.NgramSize)
+	for i := range colSizes {
+		colSizes[i] = -1
+		lastUpTo[i] = -1
+		name := iv.checkName(colsDirPath, filepath.Base(column.CreateColIdxPath(i, colsDirPath)))
+		var wordErrs, upToErrs violations
+		isLast := i == len(colSizes)-1
+		size, err := column.ScanIndexColumn(column.CreateColIdxPath(i, colsDirPath),
+			func(row int, item column.IndexItem) {
+				if iv.numWords >= 0 && (item.Index < 0 || item.Index >= iv.numWords) {
+					wordErrs.add("row %d: %d not in [0, %d)", row, item.Index, iv.numWords)
+				}
+				if !isLast && item.UpTo <= lastUpTo[i] {
+					upToErrs.add("row %d: %d after %d", row, item.UpTo, lastUpTo[i])
+				}
+				lastUpTo[i] = item.UpTo
+			})
+		if err != nil {
+			iv.report.add(name, err)
+			continue
+		}
+		colSizes[i] = size
+		iv.report.add(name+": length", nil)
+		if iv.numWords >= 0 {
+			iv.report.add(name+": word ids", wordErrs.err("word ids out of range"))
+		}
+		if !isLast {
+			iv.report.add(name+": UpTo monotonicity", upToErrs.err("non-increasing UpTo values"))
+		}
+	}
+	for i := 0; i < len(colSizes)-1; i++ {
+		if colSizes[i] < 0 || colSizes[i+1] < 0 {
+			continue
+		}
+		name := iv.checkName(colsDirPath, fmt.Sprintf("idx_col_%d.idx -> idx_col_%d.idx", i, i+1))
+		var err error
+		if lastUpTo[i] != colSizes[i+1]-1 {
+			err = fmt.Errorf("last UpTo value %d does not match the next column length %d",
+				lastUpTo[i], colSizes[i+1])
+		}
+		iv.report.add(name, err)
+	}
+	numNgrams := colSizes[len(colSizes)-1]
+
+	countsName := iv.checkName(colsDirPath, "column__counts.idx")
+	size, err := column.ScanAttrColumn("_counts", colsDirPath, func(row int, v column.AttrVal) {})
+	if err == nil && numNgrams >= 0 && size != numNgrams {
+		err = fmt.Errorf("column contains %d items, there are %d n-grams", size, numNgrams)
+
+	} else if err == nil && !iv.manifest.IsLegacy() && size != iv.manifest.NumNgrams {
+		err = fmt.Errorf("column contains %d items, manifest declares %d n-grams", size, iv.manifest.NumNgrams)
+	}
+	iv.report.add(countsName, err)
+
+	for _, attr := range iv.manifest.AttrNames() {
+		dictSize, ok := iv.dictSizes[attr]
+		if !ok {
+			continue
+		}
+		name := iv.checkName(colsDirPath, fmt.Sprintf("column_%s.idx", attr))
+		var valErrs violations
+		size, err := column.ScanAttrColumn(attr, colsDirPath, func(row int, v column.AttrVal) {
+			if int(v) < 0 || int(v) >= dictSize {
+				valErrs.add("row %d: %d not in [0, %d)", row, v, dictSize)
+			}
+		})
+		if err == nil && numNgrams >= 0 && size != numNgrams {
+			err = fmt.Errorf("column contains %d items, there are %d n-grams", size, numNgrams)
+		}
+		if err == nil {
+			err = valErrs.err("attribute ids out of range")
+		}
+		iv.report.add(name, err)
+	}
+}
+
+// verifyPosAttrs checks the positional attributes index
+// (the same way as the main index) and dictionaries
+// of the individual attributes
+func (iv *indexVerifier) verifyPosAttrs() {
+	subDirPath := PosAttrsDirPath(iv.dirPath)
+	for _, check := range VerifyIndex(subDirPath).Checks {
+		check.Name = posAttrsDirName + "/" + check.Name
+		iv.report.Checks = append(iv.report.Checks, check)
+	}
+	for _, attr := range iv.manifest.PosAttrs[1:] {
+		_, err := wdict.LoadNamedWordDict(subDirPath, attr)
+		iv.report.add(posAttrsDirName+"/"+attr+".dict", err)
+	}
+}
+
+// VerifyIndex checks integrity of an index stored within
+// a specified directory (including all its rotations).
+// The function does not stop on the first error - it
+// tries to perform as many checks as possible.
+func VerifyIndex(dirPath string) *VerificationReport {
+	iv := &indexVerifier{
+		report:    &VerificationReport{DirPath: dirPath, Checks: make([]*VerificationCheck, 0, 20)},
+		dirPath:   dirPath,
+		numWords:  -1, // = unknown
+		dictSizes: make(map[string]int),
+	}
+	var err error
+	iv.manifest, err = LoadManifest(dirPath)
+	if err != nil {
+		iv.report.add(manifestFilename, err)
+		return iv.report
+	}
+	if iv.manifest.IsLegacy() {
+		iv.report.addNote(manifestFilename, "manifest not found, index metadata derived from index files")
+
+	} else {
+		iv.report.add(manifestFilename, iv.manifest.Validate(0, []string{}))
+	}
+
+	wd, err := wdict.LoadWordDict(dirPath)
+	if err == nil {
+		iv.numWords = wd.Size()
+		if iv.manifest.NumWords > 0 && iv.numWords != iv.manifest.NumWords {
+			err = fmt.Errorf("dictionary contains %d words, manifest declares %d", iv.numWords, iv.manifest.NumWords)
+		}
+	}
+	iv.report.add("words.dict", err)
+
+	for _, attr := range iv.manifest.AttrNames() {
+		dict, err := column.LoadArgsDict(dirPath, attr)
+		if err == nil {
+			iv.dictSizes[attr] = dict.Size()
+		}
+		iv.report.add(fmt.Sprintf("column_%s.dict", attr), err)
+	}
+
+	for _, rotation := range iv.manifest.Rotations {
+		if rotation == 0 {
+			iv.verifyColumns(dirPath)
+
+		} else {
+			iv.verifyColumns(RotationDirPath(dirPath, rotation))
+		}
+	}
+	if len(iv.manifest.PosAttrs) > 0 {
+		iv.verifyPosAttrs()
+	}
+	return iv.report
+}
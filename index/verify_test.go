@@ -0,0 +1,94 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index/column"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+func saveTestingIndexWithDict(t *testing.T, numWords int) string {
+	dirPath := saveTestingIndex(t)
+	wd := wdict.NewWordDictWriter()
+	for _, w := range []string{"a", "b", "c", "d"}[:numWords] {
+		wd.AddToken(w)
+	}
+	wd.Finalize(dirPath)
+	return dirPath
+}
+
+func failedChecks(report *VerificationReport) []string {
+	ans := make([]string, 0, len(report.Checks))
+	for _, v := range report.Checks {
+		if !v.Passed {
+			ans = append(ans, v.Name)
+		}
+	}
+	return ans
+}
+
+func TestVerifyValidIndex(t *testing.T) {
+	dirPath := saveTestingIndexWithDict(t, 4)
+	defer os.RemoveAll(dirPath)
+	report := VerifyIndex(dirPath)
+	assert.True(t, report.Passed())
+	assert.Equal(t, []string{}, failedChecks(report))
+}
+
+func TestVerifyTruncatedColumn(t *testing.T) {
+	dirPath := saveTestingIndexWithDict(t, 4)
+	defer os.RemoveAll(dirPath)
+	colPath := column.CreateColIdxPath(1, dirPath)
+	finfo, _ := os.Stat(colPath)
+	assert.Nil(t, os.Truncate(colPath, finfo.Size()-8))
+	report := VerifyIndex(dirPath)
+	assert.False(t, report.Passed())
+	assert.Equal(t, []string{"idx_col_1.idx"}, failedChecks(report))
+}
+
+func TestVerifyWordsOutOfRange(t *testing.T) {
+	dirPath := saveTestingIndexWithDict(t, 4)
+	defer os.RemoveAll(dirPath)
+	wd := wdict.NewWordDictWriter()
+	wd.AddToken("a")
+	wd.AddToken("b")
+	wd.AddToken("c")
+	wd.Finalize(dirPath)
+	report := VerifyIndex(dirPath)
+	assert.Contains(t, failedChecks(report), "words.dict")
+	assert.Contains(t, failedChecks(report), "idx_col_2.idx: word ids")
+	assert.Contains(t, failedChecks(report), "rot_1/idx_col_1.idx: word ids")
+}
+
+func TestVerifyBrokenUpTo(t *testing.T) {
+	dirPath := saveTestingIndexWithDict(t, 4)
+	defer os.RemoveAll(dirPath)
+	col := column.NewIndexColumn(3)
+	col.Set(0, &column.IndexItem{Index: 0, UpTo: 2})
+	col.Set(1, &column.IndexItem{Index: 1, UpTo: 1})
+	col.Set(2, &column.IndexItem{Index: 2, UpTo: 3})
+	assert.Nil(t, col.Save(0, dirPath))
+	report := VerifyIndex(dirPath)
+	assert.Equal(t, []string{"idx_col_0.idx: UpTo monotonicity"}, failedChecks(report))
+}
+
+func TestVerifyMissingIndex(t *testing.T) {
+	report := VerifyIndex("/nonexistent/gloomy/index")
+	assert.False(t, report.Passed())
+}
@@ -0,0 +1,244 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/column"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/util"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+// Corpus represents an opened n-gram index (including
+// possible rotated variants) along with its word dictionary
+// and all the indexed metadata attributes.
+//
+// The word dictionary and zero columns are kept in memory
+// while the other columns are loaded on demand by individual
+// searches (each into its own view of the index). The opened
+// indices are read-only so searches on the same Corpus can run
+// concurrently.
+type Corpus struct {
+	id       string
+	path     string
+	wdict    *wdict.WordDictReader
+	manifest *index.Manifest
+	attrs    []string
+	indices  map[int]*index.NgramIndex
+	storage  column.StorageType
+	memSize  int64
+
+	// mutex guards indices
+	mutex sync.Mutex
+
+	// query budgets (zero values mean no limits)
+	queryTimeout   time.Duration
+	maxResultItems int
+
+	// max. number of workers searching a single query
+	numWorkers int
+
+	// posAttrs is an index of positional attribute
+	// tuples (nil if the corpus has no such index)
+	posAttrs *posAttrsIndex
+
+	// folded is a folded-key dictionary used by case
+	// insensitive queries (created on demand)
+	folded     *wdict.FoldedDict
+	foldedOnce sync.Once
+}
+
+// ID returns corpus identifier
+func (c *Corpus) ID() string {
+	return c.id
+}
+
+// MemSize returns a rough estimate of memory occupied
+// by the opened corpus. The value is derived from sizes
+// of data files kept in memory.
+func (c *Corpus) MemSize() int64 {
+	ans := atomic.LoadInt64(&c.memSize)
+	if c.posAttrs != nil {
+		ans += c.posAttrs.memSize()
+	}
+	return ans
+}
+
+// getIndex returns an index with a specified rotation.
+// The index is opened in case it is not already.
+func (c *Corpus) getIndex(rotation int) (*index.NgramIndex, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	idx, ok := c.indices[rotation]
+	if !ok {
+		var err error
+		idx, err = index.LoadIndexWithManifest(c.path, c.manifest, rotation, c.attrs, c.storage)
+		if err != nil {
+			return nil, err
+		}
+		c.indices[rotation] = idx
+		colPath := column.CreateColIdxPath(0, c.path)
+		if rotation > 0 {
+			colPath = column.CreateColIdxPath(0, index.RotationDirPath(c.path, rotation))
+		}
+		atomic.AddInt64(&c.memSize, fileSize(colPath))
+	}
+	return idx, nil
+}
+
+// queryContext derives a context of a single query
+// with the configured time budget applied
+func (c *Corpus) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.queryTimeout > 0 {
+		return context.WithTimeout(ctx, c.queryTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// queryError translates an expired query context (no matter
+// whether the deadline has been set by the configured time
+// budget or by the caller) to a respective budget error
+func (c *Corpus) queryError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		limit := "request deadline"
+		if c.queryTimeout > 0 {
+			limit = c.queryTimeout.String()
+		}
+		return &gerrors.BudgetExceededError{Budget: "time", Limit: limit}
+	}
+	return err
+}
+
+// openSearchableIndex opens an index with a specified rotation
+// for a search restricted by metadata constraints and counts
+// specified in search arguments. All the searches of the returned
+// index share the configured result budget.
+func (c *Corpus) openSearchableIndex(ctx context.Context, rotation int, args SearchArgs) (*index.SearchableIndex, error) {
+	nindex, err := c.getIndex(rotation)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := nindex.NewMetadataFilter(args.Filters)
+	if err != nil {
+		return nil, err
+	}
+	ans := index.OpenSearchableIndex(ctx, nindex, c.wdict)
+	ans.SetResultBudget(index.NewResultBudget(c.maxResultItems))
+	ans.SetNumWorkers(c.numWorkers)
+	ans.SetMetadataFilter(filter)
+	ans.SetCountRange(index.CountRange{Min: args.MinCount, Max: args.MaxCount})
+	return ans, nil
+}
+
+// attrIndices translates requested attribute names
+// to their positions within loaded metadata.
+func (c *Corpus) attrIndices(attrs []string) ([]int, error) {
+	ans := make([]int, len(attrs))
+	for i, attr := range attrs {
+		ans[i] = -1
+		for j, v := range c.attrs {
+			if v == attr {
+				ans[i] = j
+				break
+			}
+		}
+		if ans[i] == -1 {
+			return nil, &gerrors.UnknownAttributeError{Attr: attr, Available: c.attrs}
+		}
+	}
+	return ans, nil
+}
+
+func fileSize(path string) int64 {
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return finfo.Size()
+}
+
+// OpenCorpus opens a corpus identified by corpusID
+// located within the configured data directory.
+func OpenCorpus(conf *gconf.SearchConf, corpusID string) (*Corpus, error) {
+	fullPath := filepath.Join(conf.DataPath, corpusID)
+	if !util.IsDir(fullPath) {
+		return nil, &gerrors.CorpusNotFoundError{CorpusID: corpusID}
+	}
+	ans, err := loadCorpus(conf, corpusID, fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(ans.manifest.PosAttrs) > 0 {
+		ans.posAttrs, err = openPosAttrsIndex(conf, ans)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ans, nil
+}
+
+// loadCorpus loads dictionaries and the main index
+// of a corpus stored within a specified directory
+func loadCorpus(conf *gconf.SearchConf, corpusID string, fullPath string) (*Corpus, error) {
+	storage, err := column.ImportStorageType(conf.ColumnStorage)
+	if err != nil {
+		return nil, err
+	}
+	wd, err := wdict.LoadWordDict(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := index.LoadManifest(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	// zero number of words means the value is unknown
+	if manifest.NumWords > 0 && wd.Size() != manifest.NumWords {
+		return nil, gerrors.NewCorruptDataError(filepath.Join(fullPath, "words.dict"),
+			"dictionary contains %d words, manifest declares %d", wd.Size(), manifest.NumWords)
+	}
+	ans := &Corpus{
+		id:       corpusID,
+		path:     fullPath,
+		wdict:    wd,
+		manifest: manifest,
+		attrs:    manifest.AttrNames(),
+		indices:  make(map[int]*index.NgramIndex),
+		storage:  storage,
+		memSize:  fileSize(filepath.Join(fullPath, "words.dict")),
+
+		queryTimeout:   time.Duration(conf.QueryTimeoutMs) * time.Millisecond,
+		maxResultItems: conf.MaxResultItems,
+		numWorkers:     conf.SearchWorkers,
+	}
+	if ans.numWorkers <= 0 {
+		ans.numWorkers = runtime.GOMAXPROCS(0)
+	}
+	if _, err := ans.getIndex(0); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
@@ -0,0 +1,665 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/column"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+var (
+	testingNgrams = []string{
+		"in any case",
+		"in the case",
+		"in this case",
+		"out of the",
+		"one of the",
+		"the case of",
+		"the end of",
+		"in the case",
+	}
+
+	testingGenres = []string{
+		"fiction",
+		"fiction",
+		"news",
+		"news",
+		"fiction",
+		"news",
+		"fiction",
+		"news",
+	}
+)
+
+// createTestingCorpus creates a small 3-gram corpus (including
+// all the rotated indices) within basePath. Each n-gram has
+// count equal to its position within testingNgrams plus one
+// and attribute doc.genre taken from testingGenres.
+func createTestingCorpus(t *testing.T, basePath string, corpusID string) {
+	dirPath := filepath.Join(basePath, corpusID)
+	assert.Nil(t, os.MkdirAll(dirPath, 0755))
+	wd := wdict.NewWordDictWriter()
+	for _, ng := range testingNgrams {
+		for _, w := range strings.Split(ng, " ") {
+			wd.AddToken(w)
+		}
+	}
+	wd.Finalize(dirPath)
+	nindex := index.NewDynamicNgramIndex(3, 10, map[string]string{"doc.genre": "col8"})
+	type rec struct {
+		ngram []int
+		count int
+		genre column.AttrVal
+	}
+	recs := make([]rec, len(testingNgrams))
+	for i, ng := range testingNgrams {
+		words := strings.Split(ng, " ")
+		recs[i].ngram = make([]int, len(words))
+		for j, w := range words {
+			recs[i].ngram[j] = wd.GetTokenIndex(w)
+		}
+		recs[i].count = i + 1
+		nindex.MetadataWriter().ForEachArg(func(j int, ad *column.ArgsDictWriter, col column.AttrValColumn) {
+			recs[i].genre = column.AttrVal(ad.AddValue(testingGenres[i]))
+		})
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		for k := range recs[i].ngram {
+			if recs[i].ngram[k] != recs[j].ngram[k] {
+				return recs[i].ngram[k] < recs[j].ngram[k]
+			}
+		}
+		return recs[i].genre < recs[j].genre
+	})
+	for _, r := range recs {
+		nindex.AddNgram(r.ngram, r.count, []column.AttrVal{r.genre})
+	}
+	nindex.Finish()
+	for i := 1; i < 3; i++ {
+		assert.Nil(t, nindex.CreateRotation(i).Save(dirPath))
+	}
+	nindex.SetBuildInfo(&index.BuildInfo{NumTokens: 3 * len(testingNgrams), NumWords: wd.Size()})
+	assert.Nil(t, nindex.Save(dirPath))
+}
+
+func createTestingDataDir(t *testing.T, corpora ...string) string {
+	basePath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	for _, c := range corpora {
+		createTestingCorpus(t, basePath, c)
+	}
+	return basePath
+}
+
+func createTestingConf(basePath string) *gconf.SearchConf {
+	return &gconf.SearchConf{DataPath: basePath}
+}
+
+func collectResult(res *SearchResult) []string {
+	ans := make([]string, 0, res.Size())
+	for res.HasNext() {
+		ans = append(ans, strings.Join(res.Next().Ngram, " "))
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+func TestOpenCorpusNotFound(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	_, err := OpenCorpus(createTestingConf(basePath), "foo")
+	assert.True(t, gerrors.IsNotFound(err))
+}
+
+func TestCorpusSearchExact(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, err := OpenCorpus(createTestingConf(basePath), "test")
+	assert.Nil(t, err)
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in any case", "in the case", "in this case"}, collectResult(res))
+}
+
+func TestCorpusSearchPrefix(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "o*", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one of the", "out of the"}, collectResult(res))
+}
+
+func TestCorpusSearchPhrase(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for phrase, expected := range map[string][]string{
+		"in the":     {"in the case"},
+		"the *":      {"the case of", "the end of"},
+		"* of the":   {"one of the", "out of the"},
+		"o* of *":    {"one of the", "out of the"},
+		"in t* case": {"in the case", "in this case"},
+		"* * of":     {"the case of", "the end of"},
+		"in foo":     {},
+		"of the":     {},
+	} {
+		res, err := corp.Search(context.Background(), SearchArgs{Phrase: phrase, Limit: -1})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, collectResult(res), phrase)
+		stats, err := corp.Count(context.Background(), SearchArgs{Phrase: phrase})
+		assert.Nil(t, err)
+		assert.Equal(t, len(expected), stats.NumNgrams, phrase)
+	}
+	for _, phrase := range []string{"in the case of", " "} {
+		_, err := corp.Search(context.Background(), SearchArgs{Phrase: phrase, Limit: -1})
+		assert.True(t, gerrors.IsInvalidInput(err), phrase)
+	}
+}
+
+func TestCorpusSearchPrefixOrder(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	for _, numWorkers := range []int{1, 4} {
+		conf := createTestingConf(basePath)
+		conf.SearchWorkers = numWorkers
+		corp, _ := OpenCorpus(conf, "test")
+		for _, args := range []SearchArgs{{Phrase: "o*", Limit: -1}, {Phrase: ".*", QueryType: 1, Limit: -1}} {
+			res, err := corp.Search(context.Background(), args)
+			assert.Nil(t, err)
+			// the index order is alphabetical
+			ans := make([]string, 0, res.Size())
+			for res.HasNext() {
+				ans = append(ans, strings.Join(res.Next().Ngram, " "))
+			}
+			assert.True(t, sort.StringsAreSorted(ans), "workers: %d", numWorkers)
+			assert.True(t, len(ans) > 1)
+		}
+	}
+}
+
+func TestCorpusSearchRegexpRotated(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one of the", "out of the"}, collectResult(res))
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "in .* case", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in any case", "in the case", "in this case"}, collectResult(res))
+}
+
+func TestCorpusSearchRegexpTokens(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: " in  .*   case ", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in any case", "in the case", "in this case"}, collectResult(res))
+	for _, phrase := range []string{"in the case of", " "} {
+		_, err := corp.Search(context.Background(), SearchArgs{Phrase: phrase, QueryType: 1, Limit: -1})
+		assert.True(t, gerrors.IsInvalidInput(err), phrase)
+	}
+}
+
+func TestCorpusSearchRegexpAlternation(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in|out .* th(e|is)", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"out of the"}, collectResult(res))
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: `\w{2} [a-z]+ case`, QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in any case", "in the case", "in this case"}, collectResult(res))
+}
+
+func TestCorpusSearchRegexpNoPrefix(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "[a-z]+e .* .*", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one of the", "the case of", "the end of"}, collectResult(res))
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: ".* .*f [^c].*", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one of the", "out of the"}, collectResult(res))
+}
+
+func TestCorpusSearchCQL(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for q, expected := range map[string][]string{
+		`[word="in"] [] [word="case"]`:             {"in any case", "in the case", "in this case"},
+		`[] "of" "the"`:                            {"one of the", "out of the"},
+		`[word="o.*" & word!="one"]`:               {"out of the"},
+		`"in" [word!="the|this"]`:                  {"in any case"},
+		`[word="t.*"] [word=".*e.*" & word="e.*"]`: {"the end of"},
+		`[word="foo"]`:                             {},
+	} {
+		res, err := corp.Search(context.Background(), SearchArgs{Phrase: q, QueryType: 2, Limit: -1})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, collectResult(res), q)
+	}
+}
+
+func TestCorpusSearchCQLInvalid(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for _, q := range []string{`[word="in"`, `[lemma="be"]`, `[] [] [] []`, `[word="(in"]`} {
+		_, err := corp.Search(context.Background(), SearchArgs{Phrase: q, QueryType: 2, Limit: -1})
+		assert.True(t, gerrors.IsInvalidInput(err), q)
+	}
+}
+
+func TestCorpusSearchMmap(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	conf := createTestingConf(basePath)
+	conf.ColumnStorage = "mmap"
+	corp, err := OpenCorpus(conf, "test")
+	assert.Nil(t, err)
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"one of the", "out of the"}, collectResult(res))
+}
+
+func TestCorpusSearchUnknownAttr(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	_, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Attrs: []string{"doc.foo"}, Limit: -1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+}
+
+func TestCorpusSearchDistribution(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Attrs: []string{"doc.genre"}, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res.Size())
+	for res.HasNext() {
+		item := res.Next()
+		if strings.Join(item.Ngram, " ") == "in the case" {
+			assert.Equal(t, 10, item.Count)
+			assert.Equal(t, []*AttrValsCount{
+				{Args: []string{"fiction"}, Count: 2},
+				{Args: []string{"news"}, Count: 8},
+			}, item.Distribution)
+		}
+	}
+}
+
+func TestCorpusSearchGroupBy(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", GroupBy: []string{"doc.genre"}, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []*GroupItem{
+		{Args: []string{"news"}, Count: 11, NumNgrams: 2},
+		{Args: []string{"fiction"}, Count: 3, NumNgrams: 2},
+	}, res.Groups)
+}
+
+func TestCorpusSearchFacets(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Facets: []string{"doc.genre"}, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]*FacetItem{
+		"doc.genre": {{Value: "fiction", Count: 5}, {Value: "news", Count: 4}},
+	}, res.Facets)
+}
+
+func TestCorpusSearchGroupByUnknownAttr(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	_, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", GroupBy: []string{"doc.foo"}, Limit: -1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+}
+
+func TestCorpusSearchFilter(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	filters := []index.AttrConstraint{{Attr: "doc.genre", Values: []string{"news"}}}
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Filters: filters, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in the case", "in this case"}, collectResult(res))
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Filters: filters, GroupBy: []string{"doc.genre"}, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []*GroupItem{{Args: []string{"news"}, Count: 4, NumNgrams: 1}}, res.Groups)
+	assert.Equal(t, []string{"out of the"}, collectResult(res))
+}
+
+func collectCounts(res *SearchResult) []int {
+	ans := make([]int, 0, res.Size())
+	for res.HasNext() {
+		ans = append(ans, res.Next().Count)
+	}
+	return ans
+}
+
+func TestCorpusSearchSortByCount(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Sort: "-count", Limit: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{10, 7, 6}, collectCounts(res))
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Sort: "count", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 3, 4, 5, 6, 7, 10}, collectCounts(res))
+}
+
+func TestCorpusSearchSortedPages(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for _, v := range []struct {
+		offset int
+		limit  int
+		counts []int
+	}{
+		{offset: 2, limit: 3, counts: []int{6, 5, 4}},
+		// the last (short) page
+		{offset: 5, limit: 3, counts: []int{3, 1}},
+		{offset: 7, limit: 3, counts: []int{}},
+		{offset: 4, limit: -1, counts: []int{4, 3, 1}},
+		{offset: 0, limit: 0, counts: []int{}},
+		{offset: 3, limit: 0, counts: []int{}},
+	} {
+		res, err := corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Sort: "-count",
+			Offset: v.offset, Limit: v.limit})
+		assert.Nil(t, err)
+		assert.Equal(t, v.counts, collectCounts(res), "offset %d, limit %d", v.offset, v.limit)
+		assert.Equal(t, len(v.counts), res.Size())
+	}
+}
+
+func TestCorpusSearchInvalidPaging(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for _, args := range []SearchArgs{
+		{Phrase: "in", Offset: -2, Limit: 1},
+		{Phrase: "in", Offset: -2, Limit: 1, Sort: "count"},
+		{Phrase: "in", Limit: -3},
+		{Phrase: "in", Limit: -3, Sort: "count"},
+		{Phrase: "in", Offset: -1, Limit: 10},
+	} {
+		_, err := corp.Search(context.Background(), args)
+		assert.True(t, gerrors.IsInvalidInput(err), "offset %d, limit %d", args.Offset, args.Limit)
+	}
+}
+
+func TestCorpusSearchOffsetWithoutLimit(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Offset: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in the case", "in this case"}, collectResult(res))
+}
+
+func TestCorpusSearchSortByPosition(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Sort: "-pos:1", Limit: -1})
+	assert.Nil(t, err)
+	ans := make([]string, 0, 3)
+	for res.HasNext() {
+		ans = append(ans, res.Next().Ngram[1])
+	}
+	assert.Equal(t, []string{"this", "the", "any"}, ans)
+}
+
+func TestCorpusSearchSortByAttr(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Attrs: []string{"doc.genre"},
+		Sort: "-attr:doc.genre", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"news"}, res.Next().Args)
+	assert.Equal(t, []string{"fiction"}, res.Next().Args)
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Attrs: []string{"doc.genre"},
+		Sort: "attr:doc.genre", Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res.Size())
+	assert.Equal(t, []string{"fiction"}, res.Next().Args)
+}
+
+func TestCorpusSearchSortByDominantAttr(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	// "in the case" has rows fiction (2) and news (8)
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Sort: "-attr:doc.genre", Limit: -1})
+	assert.Nil(t, err)
+	ans := make([]string, 0, 3)
+	for res.HasNext() {
+		ans = append(ans, strings.Join(res.Next().Ngram, " "))
+	}
+	assert.Equal(t, []string{"in the case", "in this case", "in any case"}, ans)
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "in", Sort: "-attr:doc.genre", Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in", "the", "case"}, res.Next().Ngram)
+}
+
+func TestDominantValue(t *testing.T) {
+	item := &index.NgramResultItem{Distribution: []*index.MetadataCount{
+		{Metadata: []string{"a", "x"}, Count: 2},
+		{Metadata: []string{"b", "y"}, Count: 1},
+		{Metadata: []string{"a", "y"}, Count: 1},
+	}}
+	assert.Equal(t, "a", dominantValue(item, 0))
+	assert.Equal(t, "x", dominantValue(item, 1))
+	item.Distribution[0].Count = 1
+	assert.Equal(t, "y", dominantValue(item, 1))
+	assert.Equal(t, "", dominantValue(&index.NgramResultItem{}, 0))
+}
+
+func TestCorpusSearchSortedMetadata(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	// metadata are decoded for the selected items
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Attrs: []string{"doc.genre"},
+		Sort: "-count", Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, res.Size())
+	for res.HasNext() {
+		assert.Equal(t, 1, len(res.Next().Args))
+	}
+}
+
+func TestCorpusSearchInvalidSort(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for _, spec := range []string{"foo", "pos:3", "pos:x", "attr:doc.foo"} {
+		_, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Sort: spec, Limit: -1})
+		assert.True(t, gerrors.IsInvalidInput(err), spec)
+	}
+}
+
+func TestCorpusSearchCountRange(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", MinCount: 3, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in the case", "in this case"}, collectResult(res))
+
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "in", MinCount: 3, MaxCount: 9, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"in this case"}, collectResult(res))
+}
+
+func TestCorpusSearchInvalidCountRange(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	_, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", MinCount: -1, Limit: -1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: "in", MinCount: 5, MaxCount: 3, Limit: -1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+}
+
+func TestCorpusSearchResultBudget(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	conf := createTestingConf(basePath)
+	conf.MaxResultItems = 3
+	corp, _ := OpenCorpus(conf, "test")
+	_, err := corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Limit: -1})
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res.Size())
+}
+
+func TestCorpusSearchSortedResultBudget(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	conf := createTestingConf(basePath)
+	conf.MaxResultItems = 3
+	corp, _ := OpenCorpus(conf, "test")
+	// only the first offset + limit items are collected
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Sort: "-count",
+		Offset: 1, Limit: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{7, 6}, collectCounts(res))
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Sort: "-count", Limit: -1})
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+}
+
+func TestCorpusSearchCancelled(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := corp.Search(ctx, SearchArgs{Phrase: "o*", Limit: -1})
+	assert.Equal(t, context.Canceled, err)
+	_, err = corp.Count(ctx, SearchArgs{Phrase: ".*", QueryType: 1})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestCorpusSearchTimeout(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	conf := createTestingConf(basePath)
+	conf.QueryTimeoutMs = 1000
+	corp, _ := OpenCorpus(conf, "test")
+	// an already expired context behaves like an exceeded time budget
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err := corp.Search(ctx, SearchArgs{Phrase: ".*", QueryType: 1, Limit: -1})
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+}
+
+func TestCorpusSearchCallerDeadline(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	// no time budget configured
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err := corp.Search(ctx, SearchArgs{Phrase: ".*", QueryType: 1, Limit: -1})
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+	_, err = corp.Count(ctx, SearchArgs{Phrase: "in"})
+	assert.True(t, gerrors.IsBudgetExceeded(err))
+	assert.Equal(t, http.StatusUnprocessableEntity, errorHTTPCode(err))
+	// wrapped deadline errors are translated too
+	assert.True(t, gerrors.IsBudgetExceeded(corp.queryError(fmt.Errorf("search failed: %w", context.DeadlineExceeded))))
+}
+
+func TestCorpusConcurrentSearches(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, err := OpenCorpus(createTestingConf(basePath), "test")
+	assert.Nil(t, err)
+	queries := []SearchArgs{
+		{Phrase: "in", Limit: -1},
+		{Phrase: "o*", Limit: -1},
+		{Phrase: "* of the", QueryType: 1, Limit: -1},
+		{Phrase: "in .* case", QueryType: 1, Limit: -1},
+		{Phrase: ".*", QueryType: 1, Limit: 2},
+	}
+	expected := [][]string{
+		{"in any case", "in the case", "in this case"},
+		{"one of the", "out of the"},
+		{"one of the", "out of the"},
+		{"in any case", "in the case", "in this case"},
+		nil,
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := range queries {
+				qi := (g + i) % len(queries)
+				res, err := corp.Search(context.Background(), queries[qi])
+				assert.Nil(t, err)
+				if expected[qi] != nil {
+					assert.Equal(t, expected[qi], collectResult(res))
+
+				} else {
+					assert.Equal(t, 2, res.Size())
+				}
+				stats, err := corp.Count(context.Background(), queries[qi])
+				assert.Nil(t, err)
+				if expected[qi] != nil {
+					assert.Equal(t, len(expected[qi]), stats.NumNgrams)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
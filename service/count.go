@@ -0,0 +1,58 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/gconf"
+)
+
+// Counting provides aggregated counts of n-grams matching a query
+// (see SearchArgs) without creating any result items. Arguments
+// related to the result rows (Attrs, Offset, Limit, Sort, GroupBy,
+// Facets) are ignored.
+
+// Count calculates aggregated counts of n-grams matching
+// a query. Like Search, the method can be called concurrently
+// and it stops once ctx is done or the time budget is exceeded.
+func (c *Corpus) Count(ctx context.Context, args SearchArgs) (index.NgramStats, error) {
+	if err := validateQuery(args); err != nil {
+		return index.NgramStats{}, err
+	}
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+
+	qindex, err := c.openQueryIndex(ctx, args)
+	if err != nil {
+		return index.NgramStats{}, err
+	}
+	ans, err := qindex.sindex.CountNgramsInRanges(qindex.ranges)
+	if err != nil {
+		return index.NgramStats{}, c.queryError(err)
+	}
+	return ans, nil
+}
+
+// Count opens a corpus and calculates aggregated counts
+// of n-grams matching a query (see Search).
+func Count(ctx context.Context, conf *gconf.SearchConf, args SearchArgs) (index.NgramStats, error) {
+	corp, err := OpenCorpus(conf, args.CorpusID)
+	if err != nil {
+		return index.NgramStats{}, err
+	}
+	return corp.Count(ctx, args)
+}
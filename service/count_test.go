@@ -0,0 +1,92 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+)
+
+func TestCorpusCount(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	stats, err := corp.Count(context.Background(), SearchArgs{Phrase: "in"})
+	assert.Nil(t, err)
+	assert.Equal(t, index.NgramStats{NumNgrams: 3, TotalCount: 14, MinCount: 1, MaxCount: 10}, stats)
+
+	stats, err = corp.Count(context.Background(), SearchArgs{Phrase: "foo"})
+	assert.Nil(t, err)
+	assert.Equal(t, index.NgramStats{}, stats)
+}
+
+func TestCorpusCountMatchesSearch(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	newsOnly := []index.AttrConstraint{{Attr: "doc.genre", Values: []string{"news"}}}
+	queries := []SearchArgs{
+		{Phrase: "the"},
+		{Phrase: "o*"},
+		{Phrase: ".*", QueryType: 1},
+		{Phrase: "* of the", QueryType: 1},
+		{Phrase: "o.* .* the", QueryType: 1},
+		{Phrase: "t.* .* of", QueryType: 1, MinCount: 7},
+		{Phrase: "in", Filters: newsOnly},
+	}
+	for _, args := range queries {
+		stats, err := corp.Count(context.Background(), args)
+		assert.Nil(t, err)
+		args.Limit = -1
+		res, err := corp.Search(context.Background(), args)
+		assert.Nil(t, err)
+		var expected index.NgramStats
+		for _, count := range collectCounts(res) {
+			expected.Merge(index.NgramStats{NumNgrams: 1, TotalCount: count, MinCount: count, MaxCount: count})
+		}
+		assert.Equal(t, expected, stats, args.Phrase)
+	}
+}
+
+func TestCorpusCountInvalidArgs(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	_, err := corp.Count(context.Background(), SearchArgs{Phrase: "(foo", QueryType: 1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	_, err = corp.Count(context.Background(), SearchArgs{Phrase: "in", MaxCount: -1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+}
+
+func TestServeCount(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	h := newTestingHandler(basePath)
+	resp, _ := serveTestingRequest(h, "/count?corpus=test&q=in&filter=doc.genre%3Dnews")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var ans countResp
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &ans))
+	assert.Equal(t, index.NgramStats{NumNgrams: 2, TotalCount: 11, MinCount: 3, MaxCount: 8}, ans.NgramStats)
+
+	resp, _ = serveTestingRequest(h, "/count?corpus=foo&q=in")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/service/query"
+)
+
+// cqlTokenWords returns (sorted) indices of words matching all
+// the constraints of a CQL token (nil means any word). Only the
+// word attribute can be used.
+func cqlTokenWords(corp *Corpus, token *query.CQLToken) ([]int, error) {
+	var ans []int
+	for _, c := range token.Constraints {
+		if c.Attr != query.DefaultCQLAttr {
+			return nil, posAttrNotIndexedError(c.Attr)
+		}
+		words, err := findWordsByExpr(corp.wdict, corp.normalizeExpr(c.Expr))
+		if err != nil {
+			return nil, err
+		}
+		if c.Negated {
+			words = complementWords(corp.wdict.Size(), words)
+		}
+		if ans == nil {
+			ans = words
+
+		} else {
+			ans = intersectWords(ans, words)
+		}
+	}
+	return ans, nil
+}
+
+// cqlTokenTuples returns (sorted) indices of positional attribute
+// tuples matching all the constraints of a CQL token (nil means
+// any tuple)
+func cqlTokenTuples(pa *posAttrsIndex, token *query.CQLToken) ([]int, error) {
+	var ans []int
+	for _, c := range token.Constraints {
+		attr := pa.attrIndex(c.Attr)
+		if attr == -1 {
+			return nil, posAttrNotIndexedError(c.Attr)
+		}
+		expr := c.Expr
+		if attr == 0 {
+			// only word forms are normalized
+			expr = pa.corpus.normalizeExpr(expr)
+		}
+		values, err := findWordsByExpr(pa.dicts[attr], expr)
+		if err != nil {
+			return nil, err
+		}
+		if c.Negated {
+			values = complementWords(pa.dicts[attr].Size(), values)
+		}
+		tuples := pa.findTuples(attr, values)
+		if ans == nil {
+			ans = tuples
+
+		} else {
+			ans = intersectWords(ans, tuples)
+		}
+	}
+	return ans, nil
+}
+
+// usesWordsOnly tests whether a CQL query
+// constrains only word forms
+func usesWordsOnly(cql *query.CQLQuery) bool {
+	for _, attr := range cql.Attrs() {
+		if attr != query.DefaultCQLAttr {
+			return false
+		}
+	}
+	return true
+}
+
+// newCQLQuery compiles a CQL query into sets of words of individual
+// n-gram positions. Queries constraining only word forms search
+// the main index, other queries search the positional attributes
+// index (if available).
+func newCQLQuery(corp *Corpus, args SearchArgs) (*wordSetQuery, error) {
+	cql, err := query.ParseCQL(args.Phrase)
+	if err != nil {
+		return nil, &gerrors.InvalidArgumentError{Arg: "q", Reason: err.Error()}
+	}
+	if err := checkNumTokens(corp, len(cql.Tokens)); err != nil {
+		return nil, err
+	}
+	tokens := make([][]int, len(cql.Tokens))
+	if usesWordsOnly(cql) || corp.posAttrs == nil {
+		for i, token := range cql.Tokens {
+			tokens[i], err = cqlTokenWords(corp, token)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newWordSetQuery(corp, tokens), nil
+	}
+	for i, token := range cql.Tokens {
+		tokens[i], err = cqlTokenTuples(corp.posAttrs, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ans := newWordSetQuery(corp.posAttrs.corpus, tokens)
+	ans.decoder = corp.posAttrs
+	return ans, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+// foldedDict returns a folded-key dictionary of the corpus
+// words. The dictionary is created once it is needed for
+// the first time.
+func (c *Corpus) foldedDict() *wdict.FoldedDict {
+	c.foldedOnce.Do(func() {
+		c.folded = wdict.NewFoldedDict(c.wdict)
+		atomic.AddInt64(&c.memSize, c.folded.MemSize())
+	})
+	return c.folded
+}
+
+// foldedTokenWords returns (sorted) indices of all the word
+// variants matching a token of a case insensitive query
+// (nil means any word)
+func foldedTokenWords(fd *wdict.FoldedDict, token string) []int {
+	if token == "*" {
+		return nil
+	}
+	if strings.HasSuffix(token, "*") {
+		return fd.FindByPrefix(token[:len(token)-1])
+	}
+	return fd.Find(token)
+}
+
+// newFoldedQuery compiles a case and diacritics insensitive
+// query (with the same syntax as the default one) into sets
+// of all the matching word variants of individual n-gram
+// positions
+func newFoldedQuery(corp *Corpus, args SearchArgs) (*wordSetQuery, error) {
+	phrase, err := queryTokens(corp, args.Phrase)
+	if err != nil {
+		return nil, err
+	}
+	fd := corp.foldedDict()
+	tokens := make([][]int, len(phrase))
+	for i, token := range phrase {
+		tokens[i] = foldedTokenWords(fd, corp.normalizeToken(token))
+	}
+	return newWordSetQuery(corp, tokens), nil
+}
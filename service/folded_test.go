@@ -0,0 +1,81 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+func openTestingCaseSensitiveCorpus(t *testing.T, basePath string) *Corpus {
+	createTestingNormalizedCorpus(t, basePath,
+		[]string{"Praha je", "praha je", "PRAHA je", "Brno je", "Prahy je"},
+		wdict.Normalization{PreserveCase: true, UnicodeForm: wdict.NormNFC})
+	corp, err := OpenCorpus(createTestingConf(basePath), "test")
+	assert.Nil(t, err)
+	return corp
+}
+
+func TestCorpusSearchFolded(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	corp := openTestingCaseSensitiveCorpus(t, basePath)
+	for _, phrase := range []string{"praha", "PRAHA je", "Práha", "* JE", "praha *"} {
+		res, err := corp.Search(context.Background(), SearchArgs{Phrase: phrase, QueryType: 3, Limit: -1})
+		assert.Nil(t, err)
+		if phrase == "* JE" {
+			assert.Equal(t, []string{"Brno je", "PRAHA je", "Praha je", "Prahy je", "praha je"}, collectResult(res))
+
+		} else {
+			assert.Equal(t, []string{"PRAHA je", "Praha je", "praha je"}, collectResult(res), phrase)
+		}
+	}
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "PRÁ*", QueryType: 3, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PRAHA je", "Praha je", "Prahy je", "praha je"}, collectResult(res))
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "ostrava", QueryType: 3, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, collectResult(res))
+	// default queries remain case sensitive
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "praha", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"praha je"}, collectResult(res))
+}
+
+func TestCorpusCountFolded(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	corp := openTestingCaseSensitiveCorpus(t, basePath)
+	memSize := corp.MemSize()
+	ans, err := corp.Count(context.Background(), SearchArgs{Phrase: "praha je", QueryType: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, ans.NumNgrams)
+	assert.True(t, corp.MemSize() > memSize)
+}
+
+func TestCorpusSearchFoldedInvalid(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	corp := openTestingCaseSensitiveCorpus(t, basePath)
+	for _, phrase := range []string{"", "praha je je"} {
+		_, err := corp.Search(context.Background(), SearchArgs{Phrase: phrase, QueryType: 3, Limit: -1})
+		assert.True(t, gerrors.IsInvalidInput(err), phrase)
+	}
+}
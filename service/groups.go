@@ -0,0 +1,121 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+// This file contains aggregation of search results by values
+// of metadata attributes. Both group-by and facets are calculated
+// from n-gram distributions over attribute values (see
+// index.NgramResultItem) which are read from metadata
+// columns along with n-grams.
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tomachalek/gloomy/index"
+)
+
+// GroupItem represents aggregated counts of all the matching
+// n-grams with specific values of group-by attributes
+type GroupItem struct {
+	Args      []string `json:"args"`
+	Count     int      `json:"count"`
+	NumNgrams int      `json:"numNgrams"`
+}
+
+// FacetItem represents a total count of matching
+// n-grams with a specific value of an attribute
+type FacetItem struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// projectDistribution projects distribution of an n-gram count
+// over all the loaded attributes to the attributes specified
+// by their indices. Rows with the same values of the attributes
+// are merged.
+func projectDistribution(item *index.NgramResultItem, attrIdxs []int) []*AttrValsCount {
+	ans := make([]*AttrValsCount, 0, len(item.Distribution))
+	rows := make(map[string]*AttrValsCount)
+	for _, d := range item.Distribution {
+		args := make([]string, len(attrIdxs))
+		for i, v := range attrIdxs {
+			args[i] = d.Metadata[v]
+		}
+		key := strings.Join(args, "\x00")
+		if row, ok := rows[key]; ok {
+			row.Count += d.Count
+
+		} else {
+			rows[key] = &AttrValsCount{Args: args, Count: d.Count}
+			ans = append(ans, rows[key])
+		}
+	}
+	return ans
+}
+
+func compareArgs(a1 []string, a2 []string) bool {
+	for i := 0; i < len(a1) && i < len(a2); i++ {
+		if a1[i] != a2[i] {
+			return a1[i] < a2[i]
+		}
+	}
+	return len(a1) < len(a2)
+}
+
+// groupResult aggregates counts of all the result n-grams by values
+// of attributes specified by attrIdxs. Groups are sorted by
+// their counts in descending order.
+func groupResult(res *index.NgramSearchResult, attrIdxs []int) []*GroupItem {
+	groups := make(map[string]*GroupItem)
+	ans := make([]*GroupItem, 0, 20)
+	res.ResetCursor()
+	for res.HasNext() {
+		for _, d := range projectDistribution(res.Next(), attrIdxs) {
+			key := strings.Join(d.Args, "\x00")
+			if g, ok := groups[key]; ok {
+				g.Count += d.Count
+				g.NumNgrams++
+
+			} else {
+				groups[key] = &GroupItem{Args: d.Args, Count: d.Count, NumNgrams: 1}
+				ans = append(ans, groups[key])
+			}
+		}
+	}
+	res.ResetCursor()
+	sort.Slice(ans, func(i, j int) bool {
+		if ans[i].Count != ans[j].Count {
+			return ans[i].Count > ans[j].Count
+		}
+		return compareArgs(ans[i].Args, ans[j].Args)
+	})
+	return ans
+}
+
+// facetResult calculates total counts of the result n-grams
+// per value of each of the specified attributes
+func facetResult(res *index.NgramSearchResult, attrs []string, attrIdxs []int) map[string][]*FacetItem {
+	ans := make(map[string][]*FacetItem)
+	for i, attr := range attrs {
+		groups := groupResult(res, attrIdxs[i:i+1])
+		items := make([]*FacetItem, len(groups))
+		for j, g := range groups {
+			items[j] = &FacetItem{Value: g.Args[0], Count: g.Count}
+		}
+		ans[attr] = items
+	}
+	return ans
+}
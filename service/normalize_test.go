@@ -0,0 +1,100 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+// createTestingNormalizedCorpus creates a 2-gram corpus of already
+// normalized n-grams along with a specified normalization
+func createTestingNormalizedCorpus(t *testing.T, basePath string, ngrams []string, norm wdict.Normalization) {
+	dirPath := filepath.Join(basePath, "test")
+	assert.Nil(t, os.MkdirAll(dirPath, 0755))
+	words := wdict.NewWordDictWriter()
+	tokens := make([][]string, len(ngrams))
+	for i, ng := range ngrams {
+		tokens[i] = strings.Split(ng, " ")
+		for _, w := range tokens[i] {
+			words.AddToken(w)
+		}
+	}
+	words.Finalize(dirPath)
+	saveTestingNgrams(t, dirPath, tokens, words, &index.BuildInfo{NumWords: words.Size(), Normalization: norm})
+}
+
+func TestCorpusSearchLowercasedQuery(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	for _, args := range []SearchArgs{
+		{Phrase: "IN The", Limit: -1},
+		{Phrase: "IN T*", Limit: -1},
+		{Phrase: "I(N|X) THE", QueryType: 1, Limit: -1},
+		{Phrase: `[word="IN"] [word="THE|XX"]`, QueryType: 2, Limit: -1},
+	} {
+		res, err := corp.Search(context.Background(), args)
+		assert.Nil(t, err)
+		if args.Phrase == "IN T*" {
+			assert.Equal(t, []string{"in the case", "in this case"}, collectResult(res))
+
+		} else {
+			assert.Equal(t, []string{"in the case"}, collectResult(res), args.Phrase)
+		}
+	}
+}
+
+func TestCorpusSearchPreservedCase(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	createTestingNormalizedCorpus(t, basePath, []string{"Praha je", "praha je", "PRAHA je"},
+		wdict.Normalization{PreserveCase: true, UnicodeForm: wdict.NormNFC})
+	corp, err := OpenCorpus(createTestingConf(basePath), "test")
+	assert.Nil(t, err)
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "Praha", Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Praha je"}, collectResult(res))
+	res, err = corp.Search(context.Background(), SearchArgs{Phrase: "P.*", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"PRAHA je", "Praha je"}, collectResult(res))
+}
+
+func TestCorpusSearchStrippedDiacritics(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	createTestingNormalizedCorpus(t, basePath, []string{"zluty kun", "cerny kun"},
+		wdict.Normalization{StripDiacritics: true})
+	corp, err := OpenCorpus(createTestingConf(basePath), "test")
+	assert.Nil(t, err)
+	for _, args := range []SearchArgs{
+		{Phrase: "Žlutý kůň", Limit: -1},
+		// decomposed (NFD) query
+		{Phrase: "Z\u030cluty\u0301 k*", Limit: -1},
+		{Phrase: "žlut[ýí] kůň", QueryType: 1, Limit: -1},
+		{Phrase: `"Žlutý"`, QueryType: 2, Limit: -1},
+	} {
+		res, err := corp.Search(context.Background(), args)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"zluty kun"}, collectResult(res), args.Phrase)
+	}
+}
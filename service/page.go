@@ -0,0 +1,69 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+)
+
+// Paged search walks the index only until the requested number
+// of n-grams is found. The position where the walking stopped is
+// returned as an opaque cursor which can be used to continue with
+// the next page (without searching through the previous pages again).
+
+// isPageable tests whether a search can be performed
+// page by page (i.e. without collecting the whole result)
+func isPageable(args SearchArgs) bool {
+	return args.Limit > 0 && args.Offset == 0 && args.Sort == "" &&
+		len(args.GroupBy) == 0 && len(args.Facets) == 0
+}
+
+func validateCursor(args SearchArgs) error {
+	if args.Cursor != "" && !isPageable(args) {
+		return &gerrors.InvalidArgumentError{
+			Arg:    "cursor",
+			Reason: "cursor requires a limit and cannot be combined with offset, sort, groupBy or facets",
+		}
+	}
+	return nil
+}
+
+// searchPage performs a paged search (see isPageable)
+func (c *Corpus) searchPage(ctx context.Context, args SearchArgs, attrIdxs []int) (*SearchResult, error) {
+	var cursor *index.Cursor
+	if args.Cursor != "" {
+		var err error
+		cursor, err = index.DecodeCursor(args.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	qindex, err := c.openQueryIndex(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	res, next, err := qindex.sindex.GetNgramsPage(qindex.ranges, cursor, args.Limit)
+	if err != nil {
+		return nil, err
+	}
+	ans := &SearchResult{result: res, wdict: qindex.decoder, attrIdxs: attrIdxs}
+	if next != nil {
+		ans.NextCursor = next.Encode()
+	}
+	return ans, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+// searchAllPages collects all the pages of a paged search
+func searchAllPages(t *testing.T, corp *Corpus, args SearchArgs) []string {
+	ans := []string{}
+	for {
+		res, err := corp.Search(context.Background(), args)
+		assert.Nil(t, err)
+		assert.True(t, res.Size() <= args.Limit)
+		ans = append(ans, collectResult(res)...)
+		if res.NextCursor == "" {
+			return ans
+		}
+		args.Cursor = res.NextCursor
+	}
+}
+
+func TestCorpusSearchPages(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	queries := []SearchArgs{
+		{Phrase: "in"},
+		{Phrase: "o*"},
+		{Phrase: ".*", QueryType: 1},
+		{Phrase: "* of the", QueryType: 1},
+		{Phrase: "o.* .* the", QueryType: 1},
+	}
+	for _, args := range queries {
+		args.Limit = -1
+		res, err := corp.Search(context.Background(), args)
+		assert.Nil(t, err)
+		expected := collectResult(res)
+		for _, limit := range []int{1, 2, 5} {
+			args.Limit = limit
+			assert.Equal(t, expected, searchAllPages(t, corp, args), "%s, limit %d", args.Phrase, limit)
+		}
+	}
+}
+
+func TestCorpusSearchInvalidCursor(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: 1})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", res.NextCursor)
+
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: 1, Sort: "count", Cursor: res.NextCursor})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: -1, Cursor: res.NextCursor})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: 1, Cursor: "foo"})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	// cursor of the main index used with a rotated one
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: "* of the", QueryType: 1, Limit: 1, Cursor: res.NextCursor})
+	assert.True(t, gerrors.IsInvalidInput(err))
+}
+
+func TestServeSearchPages(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	h := newTestingHandler(basePath)
+	resp, _ := serveTestingRequest(h, "/search?corpus=test&q=in&limit=2")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var ans resultRowsResp
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &ans))
+	assert.Equal(t, 2, ans.Size)
+	assert.NotEqual(t, "", ans.NextCursor)
+
+	resp, _ = serveTestingRequest(h, "/search?corpus=test&q=in&limit=2&cursor="+ans.NextCursor)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var ans2 resultRowsResp
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &ans2))
+	assert.Equal(t, 1, ans2.Size)
+	assert.Equal(t, []string{"in", "this", "case"}, ans2.Rows[0].Ngram)
+	assert.Equal(t, "", ans2.NextCursor)
+}
@@ -0,0 +1,141 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/gconf"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+// posAttrsIndex is an index of n-grams of positional attribute
+// tuples (word form, lemma, tag,...) along with dictionaries
+// of the individual attributes. The index is opened as a nested
+// corpus sharing the main corpus' configuration.
+type posAttrsIndex struct {
+	corpus *Corpus
+
+	// names contains attribute names (word form first)
+	names []string
+
+	// dicts contains dictionaries of values of individual
+	// attributes (the main word dictionary for word forms)
+	dicts []*wdict.WordDictReader
+
+	// values contains (for each attribute) values
+	// of individual tuples as indices within dicts
+	values [][]int32
+}
+
+// attrIndex returns a position of an attribute
+// within tuples (-1 if not found)
+func (p *posAttrsIndex) attrIndex(name string) int {
+	for i, v := range p.names {
+		if v == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// findTuples returns (sorted) indices of all the tuples with
+// a value of an attribute within (sorted) values
+func (p *posAttrsIndex) findTuples(attr int, values []int) []int {
+	set := newWordSet(p.dicts[attr].Size(), values)
+	ans := make([]int, 0, len(values))
+	for t, v := range p.values[attr] {
+		if set.contains(int(v)) {
+			ans = append(ans, t)
+		}
+	}
+	return ans
+}
+
+// DecodeNgram decodes an n-gram of tuples. Each tuple is
+// represented by values of its attributes separated by '/'
+// (e.g. "dogs/dog/NNS").
+func (p *posAttrsIndex) DecodeNgram(ngram []int) []string {
+	ans := p.corpus.wdict.DecodeNgram(ngram)
+	for i, v := range ans {
+		ans[i] = strings.Join(index.SplitTuple(v), "/")
+	}
+	return ans
+}
+
+// memSize returns an estimated memory occupied
+// by the index (see Corpus.MemSize)
+func (p *posAttrsIndex) memSize() int64 {
+	ans := p.corpus.MemSize()
+	for i, name := range p.names[1:] {
+		ans += fileSize(filepath.Join(p.corpus.path, name+".dict")) + int64(4*len(p.values[i+1]))
+	}
+	return ans + int64(4*len(p.values[0]))
+}
+
+// openPosAttrsIndex opens the positional attributes
+// index of a corpus
+func openPosAttrsIndex(conf *gconf.SearchConf, corp *Corpus) (*posAttrsIndex, error) {
+	nested, err := loadCorpus(conf, corp.id, index.PosAttrsDirPath(corp.path))
+	if err != nil {
+		return nil, err
+	}
+	ans := &posAttrsIndex{
+		corpus: nested,
+		names:  corp.manifest.PosAttrs,
+		dicts:  make([]*wdict.WordDictReader, len(corp.manifest.PosAttrs)),
+		values: make([][]int32, len(corp.manifest.PosAttrs)),
+	}
+	ans.dicts[0] = corp.wdict
+	for i, name := range ans.names[1:] {
+		ans.dicts[i+1], err = wdict.LoadNamedWordDict(nested.path, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i := range ans.values {
+		ans.values[i] = make([]int32, nested.wdict.Size())
+	}
+	for t := 0; t < nested.wdict.Size(); t++ {
+		tuple := nested.wdict.DecodeToken(t)
+		values := index.SplitTuple(tuple)
+		if len(values) != len(ans.names) {
+			return nil, gerrors.NewCorruptDataError(nested.path, "tuple %d has %d values, %d attributes declared",
+				t, len(values), len(ans.names))
+		}
+		for i, v := range values {
+			w := ans.dicts[i].Find(v)
+			if w == -1 {
+				return nil, gerrors.NewCorruptDataError(nested.path, "value %s of attribute %s not found",
+					v, ans.names[i])
+			}
+			ans.values[i][t] = int32(w)
+		}
+	}
+	return ans, nil
+}
+
+// posAttrNotIndexedError returns an error of a query
+// using a positional attribute which is not indexed
+func posAttrNotIndexedError(attr string) error {
+	return &gerrors.InvalidArgumentError{
+		Arg:    "q",
+		Reason: fmt.Sprintf("positional attribute %s is not indexed", attr),
+	}
+}
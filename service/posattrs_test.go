@@ -0,0 +1,121 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/column"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+var testingTupleNgrams = []string{
+	"dogs/dog/NNS run/run/VBP",
+	"run/run/VBP fast/fast/RB",
+	"the/the/DT dog/dog/NN",
+	"dog/dog/NN runs/run/VBZ",
+	"a/a/DT run/run/NN",
+}
+
+// saveTestingNgrams saves an index of 2-grams of tokens
+// encoded by a dictionary
+func saveTestingNgrams(t *testing.T, dirPath string, ngrams [][]string, wd *wdict.WordDictWriter, info *index.BuildInfo) {
+	encoded := make([][]int, len(ngrams))
+	for i, ng := range ngrams {
+		encoded[i] = []int{wd.GetTokenIndex(ng[0]), wd.GetTokenIndex(ng[1])}
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return encoded[i][0] < encoded[j][0] || encoded[i][0] == encoded[j][0] && encoded[i][1] < encoded[j][1]
+	})
+	nindex := index.NewDynamicNgramIndex(2, 10, map[string]string{})
+	for _, ng := range encoded {
+		nindex.AddNgram(ng, 1, []column.AttrVal{})
+	}
+	nindex.Finish()
+	nindex.SetBuildInfo(info)
+	assert.Nil(t, nindex.Save(dirPath))
+}
+
+// createTestingPosAttrsCorpus creates a 2-gram corpus with
+// positional attributes lemma and tag (see testingTupleNgrams)
+func createTestingPosAttrsCorpus(t *testing.T, basePath string, corpusID string) {
+	dirPath := filepath.Join(basePath, corpusID)
+	paDirPath := index.PosAttrsDirPath(dirPath)
+	assert.Nil(t, os.MkdirAll(paDirPath, 0755))
+	words := wdict.NewWordDictWriter()
+	tuples := wdict.NewWordDictWriter()
+	attrDicts := []*wdict.WordDictWriter{wdict.NewWordDictWriter(), wdict.NewWordDictWriter()}
+	wordNgrams := make([][]string, len(testingTupleNgrams))
+	tupleNgrams := make([][]string, len(testingTupleNgrams))
+	for i, ng := range testingTupleNgrams {
+		for _, tok := range strings.Split(ng, " ") {
+			values := strings.Split(tok, "/")
+			words.AddToken(values[0])
+			tuples.AddToken(index.JoinTuple(values))
+			attrDicts[0].AddToken(values[1])
+			attrDicts[1].AddToken(values[2])
+			wordNgrams[i] = append(wordNgrams[i], values[0])
+			tupleNgrams[i] = append(tupleNgrams[i], index.JoinTuple(values))
+		}
+	}
+	words.Finalize(dirPath)
+	tuples.Finalize(paDirPath)
+	attrDicts[0].FinalizeAs(paDirPath, "lemma")
+	attrDicts[1].FinalizeAs(paDirPath, "tag")
+	saveTestingNgrams(t, paDirPath, tupleNgrams, tuples, &index.BuildInfo{NumWords: tuples.Size()})
+	saveTestingNgrams(t, dirPath, wordNgrams, words,
+		&index.BuildInfo{NumWords: words.Size(), PosAttrs: []string{"word", "lemma", "tag"}})
+}
+
+func TestCorpusSearchPosAttrs(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	createTestingPosAttrsCorpus(t, basePath, "test")
+	corp, err := OpenCorpus(createTestingConf(basePath), "test")
+	assert.Nil(t, err)
+	for q, expected := range map[string][]string{
+		`[lemma="run"]`:                  {"run/run/VBP fast/fast/RB"},
+		`[lemma="dog"] [lemma="run"]`:    {"dog/dog/NN runs/run/VBZ", "dogs/dog/NNS run/run/VBP"},
+		`[tag="DT"] [tag="N.*"]`:         {"a/a/DT run/run/NN", "the/the/DT dog/dog/NN"},
+		`[] [lemma="run" & tag!="VB.*"]`: {"a/a/DT run/run/NN"},
+		`[word="dog.*" & tag="NN"]`:      {"dog/dog/NN runs/run/VBZ"},
+		`[word="dogs"]`:                  {"dogs run"},
+		`[lemma="foo"]`:                  {},
+	} {
+		res, err := corp.Search(context.Background(), SearchArgs{Phrase: q, QueryType: 2, Limit: -1})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, collectResult(res), q)
+	}
+	stats, err := corp.Count(context.Background(), SearchArgs{Phrase: `[] [lemma="run"]`, QueryType: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, stats.NumNgrams)
+
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: `[tag="DT"]`, QueryType: 2, Limit: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/a/DT run/run/NN"}, collectResult(res))
+	assert.NotEqual(t, "", res.NextCursor)
+
+	_, err = corp.Search(context.Background(), SearchArgs{Phrase: `[pos="N.*"]`, QueryType: 2, Limit: -1})
+	assert.True(t, gerrors.IsInvalidInput(err))
+	assert.True(t, corp.MemSize() > fileSize(filepath.Join(basePath, "test", "words.dict")))
+}
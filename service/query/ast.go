@@ -0,0 +1,222 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Node is a node of a regular expression syntax tree.
+// String returns the node in the syntax of Go's regexp
+// package (with the same meaning).
+type Node interface {
+	String() string
+}
+
+// Literal matches a single character
+type Literal struct {
+	Value rune
+}
+
+func (n *Literal) String() string {
+	return regexp.QuoteMeta(string(n.Value))
+}
+
+// AnyChar matches any character ('.')
+type AnyChar struct{}
+
+func (n *AnyChar) String() string {
+	return "."
+}
+
+// RuneRange is an interval of characters (both ends included)
+type RuneRange struct {
+	From rune
+	To   rune
+}
+
+// NamedClass is a predefined character class (\w, \d, \s)
+type NamedClass rune
+
+const (
+	WordClass  NamedClass = 'w'
+	DigitClass NamedClass = 'd'
+	SpaceClass NamedClass = 's'
+)
+
+func (c NamedClass) matches(r rune) bool {
+	switch c {
+	case WordClass:
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+	case DigitClass:
+		return unicode.IsDigit(r)
+	case SpaceClass:
+		return unicode.IsSpace(r)
+	}
+	return false
+}
+
+func (c NamedClass) String() string {
+	switch c {
+	case WordClass:
+		return `\pL\p{Nd}_`
+	case DigitClass:
+		return `\p{Nd}`
+	case SpaceClass:
+		return `\s`
+	}
+	return ""
+}
+
+// CharClass matches a single character from (or, in case
+// it is negated, not from) a set of ranges and named classes
+type CharClass struct {
+	Ranges  []RuneRange
+	Named   []NamedClass
+	Negated bool
+}
+
+// Matches tests whether the class matches a character
+func (n *CharClass) Matches(r rune) bool {
+	ans := false
+	for _, rng := range n.Ranges {
+		if rng.From <= r && r <= rng.To {
+			ans = true
+			break
+		}
+	}
+	for i := 0; !ans && i < len(n.Named); i++ {
+		ans = n.Named[i].matches(r)
+	}
+	return ans != n.Negated
+}
+
+// runes returns all the characters matched by the class
+// (in the order they were specified) in case there are at
+// most limit of them. Otherwise nil is returned.
+func (n *CharClass) runes(limit int) []rune {
+	if n.Negated || len(n.Named) > 0 {
+		return nil
+	}
+	ans := make([]rune, 0, len(n.Ranges))
+	for _, rng := range n.Ranges {
+		if len(ans)+int(rng.To-rng.From)+1 > limit {
+			return nil
+		}
+		for r := rng.From; r <= rng.To; r++ {
+			ans = append(ans, r)
+		}
+	}
+	return ans
+}
+
+func (n *CharClass) String() string {
+	var buf strings.Builder
+	buf.WriteRune('[')
+	if n.Negated {
+		buf.WriteRune('^')
+	}
+	for _, rng := range n.Ranges {
+		buf.WriteString(quoteClassRune(rng.From))
+		if rng.To != rng.From {
+			buf.WriteRune('-')
+			buf.WriteString(quoteClassRune(rng.To))
+		}
+	}
+	for _, c := range n.Named {
+		buf.WriteString(c.String())
+	}
+	buf.WriteRune(']')
+	return buf.String()
+}
+
+func quoteClassRune(r rune) string {
+	if strings.ContainsRune(`\-]^[`, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
+
+// Concat matches a sequence of expressions
+type Concat struct {
+	Items []Node
+}
+
+func (n *Concat) String() string {
+	var buf strings.Builder
+	for _, item := range n.Items {
+		if _, ok := item.(*Alternation); ok {
+			buf.WriteString("(?:" + item.String() + ")")
+
+		} else {
+			buf.WriteString(item.String())
+		}
+	}
+	return buf.String()
+}
+
+// Alternation matches any of the alternatives
+type Alternation struct {
+	Alts []Node
+}
+
+func (n *Alternation) String() string {
+	items := make([]string, len(n.Alts))
+	for i, alt := range n.Alts {
+		items[i] = alt.String()
+	}
+	return strings.Join(items, "|")
+}
+
+// Repeat matches an expression repeated at least Min and
+// at most Max times (Max = -1 means no upper limit)
+type Repeat struct {
+	Sub Node
+	Min int
+	Max int
+}
+
+func (n *Repeat) String() string {
+	var sub string
+	switch n.Sub.(type) {
+	case *Literal, *AnyChar, *CharClass:
+		sub = n.Sub.String()
+	default:
+		sub = "(?:" + n.Sub.String() + ")"
+	}
+	switch {
+	case n.Min == 0 && n.Max == -1:
+		return sub + "*"
+	case n.Min == 1 && n.Max == -1:
+		return sub + "+"
+	case n.Min == 0 && n.Max == 1:
+		return sub + "?"
+	case n.Max == -1:
+		return fmt.Sprintf("%s{%d,}", sub, n.Min)
+	case n.Min == n.Max:
+		return fmt.Sprintf("%s{%d}", sub, n.Min)
+	}
+	return fmt.Sprintf("%s{%d,%d}", sub, n.Min, n.Max)
+}
+
+// Empty matches an empty string
+type Empty struct{}
+
+func (n *Empty) String() string {
+	return ""
+}
@@ -0,0 +1,315 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// Automaton is compiled from a syntax tree to a nondeterministic
+// automaton (Thompson's construction) which is then lazily turned
+// into a deterministic one (each deterministic state is a set of
+// nondeterministic states reachable after reading some input).
+// Deterministic states are created on demand and cached so
+// an Automaton must not be used concurrently.
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxNFAStates limits a size of an expression
+// (e.g. because of nested bounded repetitions)
+const maxNFAStates = 100000
+
+type nfaKind int
+
+const (
+	nfaRune nfaKind = iota
+	nfaClass
+	nfaAny
+	nfaSplit // leads to out and (in case out1 >= 0) out1 without reading anything
+	nfaMatch
+)
+
+type nfaState struct {
+	kind  nfaKind
+	value rune
+	class *CharClass
+	out   int
+	out1  int
+}
+
+func (s *nfaState) accepts(r rune) bool {
+	switch s.kind {
+	case nfaRune:
+		return s.value == r
+	case nfaClass:
+		return s.class.Matches(r)
+	case nfaAny:
+		return true
+	}
+	return false
+}
+
+// danglingOut identifies an unconnected output
+// of a state (which = 0 for out, 1 for out1)
+type danglingOut struct {
+	state int
+	which int
+}
+
+type nfaFragment struct {
+	start int
+	outs  []danglingOut
+}
+
+type nfaBuilder struct {
+	states []nfaState
+}
+
+func (b *nfaBuilder) add(s nfaState) (int, error) {
+	if len(b.states) >= maxNFAStates {
+		return -1, fmt.Errorf("Expression too complex")
+	}
+	b.states = append(b.states, s)
+	return len(b.states) - 1, nil
+}
+
+func (b *nfaBuilder) patch(outs []danglingOut, target int) {
+	for _, o := range outs {
+		if o.which == 0 {
+			b.states[o.state].out = target
+
+		} else {
+			b.states[o.state].out1 = target
+		}
+	}
+}
+
+// single creates a fragment with one state
+func (b *nfaBuilder) single(s nfaState) (nfaFragment, error) {
+	s.out = -1
+	s.out1 = -1
+	idx, err := b.add(s)
+	if err != nil {
+		return nfaFragment{}, err
+	}
+	return nfaFragment{start: idx, outs: []danglingOut{{state: idx}}}, nil
+}
+
+func (b *nfaBuilder) concat(f1 nfaFragment, f2 nfaFragment) nfaFragment {
+	b.patch(f1.outs, f2.start)
+	return nfaFragment{start: f1.start, outs: f2.outs}
+}
+
+// optional creates a fragment matching f or nothing; in case
+// loop is true, f can be repeated
+func (b *nfaBuilder) optional(f nfaFragment, loop bool) (nfaFragment, error) {
+	split, err := b.add(nfaState{kind: nfaSplit, out: f.start, out1: -1})
+	if err != nil {
+		return nfaFragment{}, err
+	}
+	outs := []danglingOut{{state: split, which: 1}}
+	if loop {
+		b.patch(f.outs, split)
+
+	} else {
+		outs = append(outs, f.outs...)
+	}
+	return nfaFragment{start: split, outs: outs}, nil
+}
+
+func (b *nfaBuilder) build(node Node) (nfaFragment, error) {
+	switch n := node.(type) {
+	case *Literal:
+		return b.single(nfaState{kind: nfaRune, value: n.Value})
+	case *AnyChar:
+		return b.single(nfaState{kind: nfaAny})
+	case *CharClass:
+		return b.single(nfaState{kind: nfaClass, class: n})
+	case *Concat:
+		ans, err := b.single(nfaState{kind: nfaSplit})
+		if err != nil {
+			return ans, err
+		}
+		for _, item := range n.Items {
+			f, err := b.build(item)
+			if err != nil {
+				return f, err
+			}
+			ans = b.concat(ans, f)
+		}
+		return ans, nil
+	case *Alternation:
+		ans := nfaFragment{start: -1}
+		for i := len(n.Alts) - 1; i >= 0; i-- {
+			f, err := b.build(n.Alts[i])
+			if err != nil {
+				return f, err
+			}
+			if ans.start == -1 {
+				ans = f
+				continue
+			}
+			split, err := b.add(nfaState{kind: nfaSplit, out: f.start, out1: ans.start})
+			if err != nil {
+				return f, err
+			}
+			ans = nfaFragment{start: split, outs: append(f.outs, ans.outs...)}
+		}
+		return ans, nil
+	case *Repeat:
+		ans, err := b.single(nfaState{kind: nfaSplit})
+		if err != nil {
+			return ans, err
+		}
+		for i := 0; i < n.Min; i++ {
+			f, err := b.build(n.Sub)
+			if err != nil {
+				return f, err
+			}
+			ans = b.concat(ans, f)
+		}
+		numOptional := n.Max - n.Min
+		if n.Max == -1 {
+			numOptional = 1
+		}
+		for i := 0; i < numOptional; i++ {
+			f, err := b.build(n.Sub)
+			if err != nil {
+				return f, err
+			}
+			f, err = b.optional(f, n.Max == -1)
+			if err != nil {
+				return f, err
+			}
+			ans = b.concat(ans, f)
+		}
+		return ans, nil
+	}
+	return b.single(nfaState{kind: nfaSplit})
+}
+
+// ----------------------------------------------------------------------------
+
+// Automaton is a deterministic finite automaton matching
+// whole words described by a regular expression. States
+// are identified by non-negative numbers, -1 means a state
+// from which no word can be matched.
+type Automaton struct {
+	nfa       []nfaState
+	sets      [][]int
+	setIDs    map[string]int
+	steps     []map[rune]int
+	accepting []bool
+}
+
+// closure adds states reachable from state s without reading
+// any input to set (split states are not added)
+func (a *Automaton) closure(s int, visited map[int]bool, set []int) []int {
+	if s < 0 || visited[s] {
+		return set
+	}
+	visited[s] = true
+	if a.nfa[s].kind == nfaSplit {
+		set = a.closure(a.nfa[s].out, visited, set)
+		return a.closure(a.nfa[s].out1, visited, set)
+	}
+	return append(set, s)
+}
+
+// stateOf returns an existing or a new deterministic
+// state for a set of nondeterministic states
+func (a *Automaton) stateOf(set []int) int {
+	if len(set) == 0 {
+		return -1
+	}
+	sort.Ints(set)
+	keyItems := make([]string, len(set))
+	accepting := false
+	for i, s := range set {
+		keyItems[i] = strconv.Itoa(s)
+		accepting = accepting || a.nfa[s].kind == nfaMatch
+	}
+	key := strings.Join(keyItems, ",")
+	if id, ok := a.setIDs[key]; ok {
+		return id
+	}
+	a.sets = append(a.sets, set)
+	a.steps = append(a.steps, make(map[rune]int))
+	a.accepting = append(a.accepting, accepting)
+	a.setIDs[key] = len(a.sets) - 1
+	return len(a.sets) - 1
+}
+
+// Start returns the initial state
+func (a *Automaton) Start() int {
+	return 0
+}
+
+// Step returns a state the automaton reaches from state
+// after reading r
+func (a *Automaton) Step(state int, r rune) int {
+	if state < 0 {
+		return -1
+	}
+	if next, ok := a.steps[state][r]; ok {
+		return next
+	}
+	visited := make(map[int]bool)
+	var set []int
+	for _, s := range a.sets[state] {
+		if a.nfa[s].accepts(r) {
+			set = a.closure(a.nfa[s].out, visited, set)
+		}
+	}
+	next := a.stateOf(set)
+	a.steps[state][r] = next
+	return next
+}
+
+// IsAccepting tests whether a word read up to
+// the state is matched
+func (a *Automaton) IsAccepting(state int) bool {
+	return state >= 0 && a.accepting[state]
+}
+
+// Matches tests whether a whole word is matched
+func (a *Automaton) Matches(word string) bool {
+	state := a.Start()
+	for _, r := range word {
+		state = a.Step(state, r)
+		if state < 0 {
+			return false
+		}
+	}
+	return a.IsAccepting(state)
+}
+
+// NewAutomaton compiles a syntax tree into an automaton
+func NewAutomaton(node Node) (*Automaton, error) {
+	b := &nfaBuilder{}
+	f, err := b.build(node)
+	if err != nil {
+		return nil, err
+	}
+	match, err := b.add(nfaState{kind: nfaMatch, out: -1, out1: -1})
+	if err != nil {
+		return nil, err
+	}
+	b.patch(f.outs, match)
+	ans := &Automaton{nfa: b.states, setIDs: make(map[string]int)}
+	ans.stateOf(ans.closure(f.start, make(map[int]bool), nil))
+	return ans, nil
+}
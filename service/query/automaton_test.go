@@ -0,0 +1,63 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func compileAutomaton(t *testing.T, expr string) *Automaton {
+	p := NewParser()
+	assert.Nil(t, p.Parse(expr))
+	a, err := NewAutomaton(p.AST())
+	assert.Nil(t, err)
+	return a
+}
+
+func TestAutomatonMatches(t *testing.T) {
+	words := []string{"", "a", "ab", "abab", "abc", "foo", "bar", "baz", "žluťoučký", "x9_", "12", "aaa", "aaaa"}
+	exprs := []string{"foo|bar", "ba[rz]", "(ab)+", "(ab)*c?", "a{2,3}", "a{3}", "a{2,}", `\w+`, `\d+`,
+		"[^a-c]+", "žlu.*", ".", "(a|)b", "a?b?c?", `\D{3}`}
+	for _, expr := range exprs {
+		a := compileAutomaton(t, expr)
+		p := NewParser()
+		p.Parse(expr)
+		rx := regexp.MustCompile("^(?:" + p.AST().String() + ")$")
+		for _, w := range words {
+			assert.Equal(t, rx.MatchString(w), a.Matches(w), "%s ~ %s", w, expr)
+		}
+	}
+}
+
+func TestAutomatonDeadState(t *testing.T) {
+	a := compileAutomaton(t, "ab.")
+	s := a.Step(a.Start(), 'a')
+	assert.True(t, s >= 0)
+	assert.False(t, a.IsAccepting(s))
+	assert.Equal(t, -1, a.Step(a.Start(), 'b'))
+	assert.Equal(t, -1, a.Step(-1, 'a'))
+	// states are cached
+	assert.Equal(t, s, a.Step(a.Start(), 'a'))
+}
+
+func TestAutomatonTooComplex(t *testing.T) {
+	p := NewParser()
+	assert.Nil(t, p.Parse("((a{1000}){1000}){10}"))
+	_, err := NewAutomaton(p.AST())
+	assert.Error(t, err)
+}
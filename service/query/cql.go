@@ -0,0 +1,270 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+grammar of the supported CQL subset (a query is a sequence
+of token positions, each constrained by positional attributes):
+
+Q -> T
+Q -> TQ
+T -> []
+T -> [C]
+T -> "regexp"       (a shorthand for [word="regexp"])
+C -> A
+C -> A&C
+A -> attr="regexp"
+A -> attr!="regexp"
+
+*/
+
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// DefaultCQLAttr is a positional attribute
+// of constraints without explicit attribute name
+const DefaultCQLAttr = "word"
+
+// CQLConstraint is a constraint of a single positional
+// attribute (the expression must match a whole value)
+type CQLConstraint struct {
+	Attr    string
+	Expr    Node
+	Negated bool
+}
+
+func (c *CQLConstraint) String() string {
+	op := "="
+	if c.Negated {
+		op = "!="
+	}
+	return fmt.Sprintf("%s%s\"%s\"", c.Attr, op, strings.Replace(c.Expr.String(), `"`, `\"`, -1))
+}
+
+// CQLToken contains constraints of a single token
+// position. All the constraints must match, a token
+// without constraints matches any token.
+type CQLToken struct {
+	Constraints []*CQLConstraint
+}
+
+func (t *CQLToken) String() string {
+	items := make([]string, len(t.Constraints))
+	for i, c := range t.Constraints {
+		items[i] = c.String()
+	}
+	return "[" + strings.Join(items, " & ") + "]"
+}
+
+// CQLQuery is a parsed CQL query
+type CQLQuery struct {
+	Tokens []*CQLToken
+}
+
+func (q *CQLQuery) String() string {
+	items := make([]string, len(q.Tokens))
+	for i, t := range q.Tokens {
+		items[i] = t.String()
+	}
+	return strings.Join(items, " ")
+}
+
+// Attrs returns names of all the positional
+// attributes used by the query
+func (q *CQLQuery) Attrs() []string {
+	ans := make([]string, 0, 3)
+	for _, t := range q.Tokens {
+		for _, c := range t.Constraints {
+			found := false
+			for _, v := range ans {
+				if v == c.Attr {
+					found = true
+					break
+				}
+			}
+			if !found {
+				ans = append(ans, c.Attr)
+			}
+		}
+	}
+	return ans
+}
+
+// ---------------------------------------------------------
+
+type cqlParser struct {
+	curr     int
+	inputStr []rune
+}
+
+func (p *cqlParser) currChar() rune {
+	if p.curr < len(p.inputStr) {
+		return p.inputStr[p.curr]
+	}
+	return endOfInput
+}
+
+func (p *cqlParser) fetchNextChar() {
+	p.curr++
+}
+
+func (p *cqlParser) skipSpaces() {
+	for unicode.IsSpace(p.currChar()) {
+		p.fetchNextChar()
+	}
+}
+
+func (p *cqlParser) match(c rune) error {
+	if p.currChar() == c {
+		p.fetchNextChar()
+		return nil
+	}
+	if p.currChar() == endOfInput {
+		return fmt.Errorf("Parse error - unexpected end of query, expected: %c", c)
+	}
+	return fmt.Errorf("Parse error at position %d - invalid input: %c, expected: %c", p.curr, p.currChar(), c)
+}
+
+// Q -> T
+// Q -> TQ
+func (p *cqlParser) parseQuery() (*CQLQuery, error) {
+	ans := &CQLQuery{Tokens: make([]*CQLToken, 0, 5)}
+	p.skipSpaces()
+	for p.currChar() != endOfInput {
+		token, err := p.parseToken()
+		if err != nil {
+			return nil, err
+		}
+		ans.Tokens = append(ans.Tokens, token)
+		p.skipSpaces()
+	}
+	if len(ans.Tokens) == 0 {
+		return nil, fmt.Errorf("Parse error - empty query")
+	}
+	return ans, nil
+}
+
+// T -> []
+// T -> [C]
+// T -> "regexp"
+func (p *cqlParser) parseToken() (*CQLToken, error) {
+	if p.currChar() == '"' {
+		expr, err := p.parseValue(DefaultCQLAttr)
+		if err != nil {
+			return nil, err
+		}
+		return &CQLToken{Constraints: []*CQLConstraint{{Attr: DefaultCQLAttr, Expr: expr}}}, nil
+	}
+	if err := p.match('['); err != nil {
+		return nil, err
+	}
+	ans := &CQLToken{Constraints: make([]*CQLConstraint, 0, 2)}
+	p.skipSpaces()
+	if p.currChar() == ']' {
+		p.fetchNextChar()
+		return ans, nil
+	}
+	for {
+		c, err := p.parseConstraint()
+		if err != nil {
+			return nil, err
+		}
+		ans.Constraints = append(ans.Constraints, c)
+		p.skipSpaces()
+		if p.currChar() != '&' {
+			break
+		}
+		p.fetchNextChar()
+		p.skipSpaces()
+	}
+	if err := p.match(']'); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// A -> attr="regexp"
+// A -> attr!="regexp"
+func (p *cqlParser) parseConstraint() (*CQLConstraint, error) {
+	start := p.curr
+	for c := p.currChar(); unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'; c = p.currChar() {
+		p.fetchNextChar()
+	}
+	if start == p.curr {
+		return nil, fmt.Errorf("Parse error at position %d - attribute name expected", p.curr)
+	}
+	ans := &CQLConstraint{Attr: string(p.inputStr[start:p.curr])}
+	p.skipSpaces()
+	if p.currChar() == '!' {
+		ans.Negated = true
+		p.fetchNextChar()
+	}
+	if err := p.match('='); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	var err error
+	ans.Expr, err = p.parseValue(ans.Attr)
+	if err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+// parseValue parses a quoted regular expression. Escaped
+// quotes are unescaped, other escape sequences are left
+// to the regular expression parser.
+func (p *cqlParser) parseValue(attr string) (Node, error) {
+	if err := p.match('"'); err != nil {
+		return nil, err
+	}
+	var expr strings.Builder
+	for p.currChar() != '"' {
+		c := p.currChar()
+		if c == endOfInput {
+			return nil, fmt.Errorf("Parse error - unterminated value of attribute %s", attr)
+		}
+		p.fetchNextChar()
+		if c == '\\' && p.currChar() == '"' {
+			c = '"'
+			p.fetchNextChar()
+
+		} else if c == '\\' && p.currChar() != endOfInput {
+			expr.WriteRune(c)
+			c = p.currChar()
+			p.fetchNextChar()
+		}
+		expr.WriteRune(c)
+	}
+	p.fetchNextChar()
+	parser := NewParser()
+	if err := parser.Parse(expr.String()); err != nil {
+		return nil, fmt.Errorf("Invalid expression of attribute %s: %s", attr, err)
+	}
+	return parser.AST(), nil
+}
+
+// ParseCQL parses a query written in a subset of the Corpus
+// Query Language - a sequence of token positions like
+// [word="run.*" & tag="V.*"] [lemma!="fast"] [] "dogs?".
+// Constraints within a position can be combined only by
+// conjunction.
+func ParseCQL(input string) (*CQLQuery, error) {
+	p := &cqlParser{inputStr: []rune(input)}
+	return p.parseQuery()
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCQLSingleToken(t *testing.T) {
+	q, err := ParseCQL(`[word="run.*"]`)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(q.Tokens))
+	assert.Equal(t, 1, len(q.Tokens[0].Constraints))
+	c := q.Tokens[0].Constraints[0]
+	assert.Equal(t, "word", c.Attr)
+	assert.False(t, c.Negated)
+	assert.Equal(t, "run.*", c.Expr.String())
+}
+
+func TestCQLConjunction(t *testing.T) {
+	q, err := ParseCQL(`[ word = "run.*" & tag!="V.*" ] [lemma="fast"]`)
+	assert.Nil(t, err)
+	assert.Equal(t, `[word="run.*" & tag!="V.*"] [lemma="fast"]`, q.String())
+	assert.True(t, q.Tokens[0].Constraints[1].Negated)
+	assert.Equal(t, []string{"word", "tag", "lemma"}, q.Attrs())
+}
+
+func TestCQLAnyToken(t *testing.T) {
+	q, err := ParseCQL(`"in" [] "case"`)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(q.Tokens))
+	assert.Equal(t, 0, len(q.Tokens[1].Constraints))
+	assert.Equal(t, `[word="in"] [] [word="case"]`, q.String())
+	assert.Equal(t, []string{"word"}, q.Attrs())
+}
+
+func TestCQLEscapedQuote(t *testing.T) {
+	q, err := ParseCQL(`[word="a\"b\.c"]`)
+	assert.Nil(t, err)
+	assert.Equal(t, `[word="a\"b\.c"]`, q.String())
+}
+
+func TestCQLInvalid(t *testing.T) {
+	for _, v := range []string{
+		``,
+		`  `,
+		`[word="foo"`,
+		`[word="foo]`,
+		`[="foo"]`,
+		`[word~"foo"]`,
+		`[word="foo" | tag="N"]`,
+		`[word="(foo"]`,
+		`word="foo"`,
+		`[word=foo]`,
+	} {
+		_, err := ParseCQL(v)
+		assert.Error(t, err, v)
+	}
+}
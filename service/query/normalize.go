@@ -0,0 +1,88 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// NormalizeLiterals returns a copy of a syntax tree with literal
+// characters normalized by fn (e.g. lowercased to match words
+// of a dictionary created with the same normalization). Consecutive
+// literals are normalized together so e.g. a letter followed by
+// a combining mark can be composed. Characters of classes are
+// normalized one by one and only in case fn maps a character to
+// a single one. Character ranges are left unchanged.
+func NormalizeLiterals(node Node, fn func(string) string) Node {
+	switch n := node.(type) {
+	case *Literal:
+		return concatOf(normalizeRun([]rune{n.Value}, fn, nil))
+	case *Concat:
+		items := make([]Node, 0, len(n.Items))
+		run := make([]rune, 0, len(n.Items))
+		for _, item := range n.Items {
+			if lit, ok := item.(*Literal); ok {
+				run = append(run, lit.Value)
+				continue
+			}
+			items = normalizeRun(run, fn, items)
+			run = run[:0]
+			items = append(items, NormalizeLiterals(item, fn))
+		}
+		return concatOf(normalizeRun(run, fn, items))
+	case *Alternation:
+		alts := make([]Node, len(n.Alts))
+		for i, alt := range n.Alts {
+			alts[i] = NormalizeLiterals(alt, fn)
+		}
+		return &Alternation{Alts: alts}
+	case *Repeat:
+		return &Repeat{Sub: NormalizeLiterals(n.Sub, fn), Min: n.Min, Max: n.Max}
+	case *CharClass:
+		ans := &CharClass{
+			Ranges:  make([]RuneRange, len(n.Ranges)),
+			Named:   n.Named,
+			Negated: n.Negated,
+		}
+		for i, rng := range n.Ranges {
+			ans.Ranges[i] = rng
+			if rng.From == rng.To {
+				if r := []rune(fn(string(rng.From))); len(r) == 1 {
+					ans.Ranges[i] = RuneRange{From: r[0], To: r[0]}
+				}
+			}
+		}
+		return ans
+	}
+	return node
+}
+
+// normalizeRun normalizes a run of literal characters
+// and appends the resulting literals to items
+func normalizeRun(run []rune, fn func(string) string, items []Node) []Node {
+	if len(run) == 0 {
+		return items
+	}
+	for _, r := range fn(string(run)) {
+		items = append(items, &Literal{Value: r})
+	}
+	return items
+}
+
+func concatOf(items []Node) Node {
+	switch len(items) {
+	case 0:
+		return &Empty{}
+	case 1:
+		return items[0]
+	}
+	return &Concat{Items: items}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func normalizeExpr(t *testing.T, expr string, fn func(string) string) string {
+	p := NewParser()
+	assert.Nil(t, p.Parse(expr))
+	return NormalizeLiterals(p.AST(), fn).String()
+}
+
+func TestNormalizeLiterals(t *testing.T) {
+	assert.Equal(t, "praha", normalizeExpr(t, "Praha", strings.ToLower))
+	assert.Equal(t, "pr(?:a|e)ha.*", normalizeExpr(t, "PR(A|E)HA.*", strings.ToLower))
+	assert.Equal(t, `[ab][^\pL\p{Nd}_]+x?`, normalizeExpr(t, `[AB]\W+X?`, strings.ToLower))
+	assert.Equal(t, "[A-Z]", normalizeExpr(t, "[A-Z]", strings.ToLower))
+}
+
+func TestNormalizeLiteralsToMultipleChars(t *testing.T) {
+	expand := func(s string) string {
+		return strings.Replace(s, "\u00df", "ss", -1)
+	}
+	assert.Equal(t, "stra(?:ss)?e", normalizeExpr(t, "straß?e", expand))
+	assert.Equal(t, "strasse", normalizeExpr(t, "straße", expand))
+	assert.Equal(t, "[ßx]", normalizeExpr(t, "[ßx]", expand))
+}
+
+func TestNormalizeLiteralsRemoved(t *testing.T) {
+	strip := func(s string) string {
+		return strings.Replace(s, "\u030c", "", -1)
+	}
+	assert.Equal(t, "za", normalizeExpr(t, "z\u030ca", strip))
+	assert.Equal(t, "", normalizeExpr(t, "\u030c", strip))
+}
@@ -13,17 +13,26 @@
 // limitations under the License.
 
 /*
-grammar:
-
-R -> T
-R -> TR
-T -> F
-T -> F?
-T -> F*
-T -> F|T ('|' is a consumed character here)
+grammar (standard precedence - repetition binds tighter
+than concatenation which binds tighter than alternation):
+
+R -> C
+R -> C|R
+C -> eps
+C -> PC
+P -> F
+P -> PQ
+Q -> * | + | ? | {m} | {m,} | {m,n}
 F -> atom
+F -> .
+F -> \w | \W | \d | \D | \s | \S | \<special char>
 F -> (R)
 F -> [L]
+F -> [^L]
+L -> I
+L -> IL
+I -> atom | \<char> | \w | \d | \s
+I -> atom-atom
 
 */
 
@@ -31,25 +40,34 @@ package query
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"unicode"
 )
 
-func isAlnum(s rune) rune {
-	if unicode.IsLetter(s) {
-		return s
-	}
-	/*
-		if s != '(' && s != ')' && s != '[' && s != ']' && s != '*' && s != '?' && s != '+' && s != '\u0003' {
-			return s
-		}*/
-	return '\u0000'
+const (
+	// endOfInput is returned by currChar once the whole
+	// input is consumed
+	endOfInput = '\u0003'
+
+	// maxRepeat is max. allowed bound of a repetition
+	maxRepeat = 1000
+
+	// specialChars cannot be used as atoms without escaping
+	specialChars = `.[]()|*+?{}\`
+)
+
+func isAtom(c rune) bool {
+	return c != endOfInput && !strings.ContainsRune(specialChars, c) && !unicode.IsSpace(c)
 }
 
+// Parser parses a regular expression matching a single
+// token into a syntax tree (see Node) and derives prefixes
+// of words the expression can match.
 type Parser struct {
 	curr     int
 	inputStr []rune
-	stack    *altStack
-	startAlt *atnstate
+	ast      Node
 }
 
 func (p *Parser) currChar() rune {
@@ -57,7 +75,7 @@ func (p *Parser) currChar() rune {
 		return p.inputStr[p.curr]
 
 	}
-	return '\u0003'
+	return endOfInput
 }
 
 func (p *Parser) fetchNextChar() {
@@ -65,177 +83,281 @@ func (p *Parser) fetchNextChar() {
 }
 
 func (p *Parser) Parse(input string) error {
-	p.curr = -1
+	p.curr = 0
 	p.inputStr = []rune(input)
-	p.startAlt = newState()
-	p.stack.Push(p.startAlt)
-	p.fetchNextChar()
-	err := p.parseRegex()
+	p.ast = nil
+	ast, err := p.parseRegex()
 	if err != nil {
 		return err
 	}
 	if p.curr < len(p.inputStr) {
 		return fmt.Errorf("Incomplete expression, position %d", p.curr)
 	}
+	p.ast = ast
 	return nil
 }
 
+// AST returns the syntax tree of the last successfully
+// parsed expression
+func (p *Parser) AST() Node {
+	return p.ast
+}
+
+// GetAllPrefixes returns strings describing all the words
+// the last parsed expression can match. A string ending
+// with '*' means any word with the preceding prefix, other
+// strings are whole words. In case the number of the strings
+// would be too high, a single common prefix is returned ("*"
+// means any word).
 func (p *Parser) GetAllPrefixes() []string {
-	return p.startAlt.getAll()
+	if p.ast == nil {
+		return []string{}
+	}
+	return findPrefixes(p.ast)
 }
 
-// R -> TR'
-func (p *Parser) parseRegex() error {
-	var err error
-	c := p.currChar()
-	switch c {
-	case isAlnum(c), '(', '[', '.':
-		err = p.parseTerm()
+// R -> C
+// R -> C|R
+func (p *Parser) parseRegex() (Node, error) {
+	alts := make([]Node, 0, 1)
+	for {
+		alt, err := p.parseConcat()
 		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, alt)
+		if p.currChar() != '|' {
 			break
 		}
-		err = p.parseRegexRest()
-	default:
-		return fmt.Errorf("Failed to parse [rule R]")
+		p.fetchNextChar()
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
 	}
-	return err
+	return &Alternation{Alts: alts}, nil
 }
 
-// R' -> R
-// R' -> eps
-func (p *Parser) parseRegexRest() error {
-	var err error
-	c := p.currChar()
-	switch c {
-	case '(', '[', isAlnum(c), '.':
-		err = p.parseRegex()
-		lastState := p.stack.Pop()
-		p.stack.Peek().getLast().appendState(lastState)
-	case ')':
-		break
-	case '\u0003':
-		lastState := p.stack.Pop()
-		p.stack.Peek().getLast().appendState(lastState)
-		break // end of input
-	default:
-		err = fmt.Errorf("Failed to parse at %d [rule R']", p.curr)
-	}
-	return err
-}
-
-// T -> FT'
-func (p *Parser) parseTerm() error {
-	var err error
-	c := p.currChar()
-	switch c {
-	case '(', '[', isAlnum(c), '.':
-		err = p.parseFactor()
-		if err != nil {
+// C -> eps
+// C -> PC
+func (p *Parser) parseConcat() (Node, error) {
+	items := make([]Node, 0, 10)
+	for {
+		c := p.currChar()
+		if c == '|' || c == ')' || c == endOfInput {
 			break
 		}
-		err = p.parseTermRest()
-	default:
-		err = fmt.Errorf("Failed to parse at %d [rule T]", p.curr)
+		item, err := p.parsePiece()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	switch len(items) {
+	case 0:
+		return &Empty{}, nil
+	case 1:
+		return items[0], nil
 	}
-	return err
+	return &Concat{Items: items}, nil
 }
 
-// T' -> eps
-// T' -> F?
-// T' -> F*
-// T' -> F|T ('|' is a consumed character here)
-func (p *Parser) parseTermRest() error {
-	var err error
-	c := p.currChar()
-	switch c {
-	case '*', '?':
-		curr := p.stack.Pop()
-		beg := newState()
-		end := newState()
-		beg.appendState(curr)
-		curr.getLast().appendState(end)
-		beg.appendState(end)
-		p.stack.Push(beg)
+// P -> F
+// P -> PQ
+func (p *Parser) parsePiece() (Node, error) {
+	ans, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.currChar() {
+		case '*':
+			ans = &Repeat{Sub: ans, Min: 0, Max: -1}
+		case '+':
+			ans = &Repeat{Sub: ans, Min: 1, Max: -1}
+		case '?':
+			ans = &Repeat{Sub: ans, Min: 0, Max: 1}
+		case '{':
+			min, max, err := p.parseBounds()
+			if err != nil {
+				return nil, err
+			}
+			ans = &Repeat{Sub: ans, Min: min, Max: max}
+			continue // parseBounds consumes the closing bracket
+		default:
+			return ans, nil
+		}
 		p.fetchNextChar()
-	case '+':
-		// we can't do anything reasonable here
-		// in terms of prefix; we just stick
-		// with the original term and no repeat.
+	}
+}
+
+// Q -> {m} | {m,} | {m,n}
+func (p *Parser) parseBounds() (int, int, error) {
+	start := p.curr
+	p.fetchNextChar()
+	min, err := p.parseNumber()
+	if err != nil {
+		return 0, 0, err
+	}
+	max := min
+	if p.currChar() == ',' {
 		p.fetchNextChar()
-	case '|':
+		if p.currChar() == '}' {
+			max = -1
+
+		} else {
+			max, err = p.parseNumber()
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if err := p.match('}'); err != nil {
+		return 0, 0, err
+	}
+	if min > maxRepeat || max > maxRepeat || max != -1 && max < min {
+		return 0, 0, fmt.Errorf("Parse error at position %d - invalid repetition bounds", start)
+	}
+	return min, max, nil
+}
+
+func (p *Parser) parseNumber() (int, error) {
+	start := p.curr
+	for p.currChar() >= '0' && p.currChar() <= '9' {
 		p.fetchNextChar()
-		err = p.parseTerm()
-		t2 := p.stack.Pop()
-		t1 := p.stack.Pop()
-		forkState := newState()
-		forkState.appendState(t1)
-		forkState.appendState(t2)
-		joinState := newState()
-		t1.getLast().appendState(joinState)
-		t2.getLast().appendState(joinState)
-		p.stack.Push(forkState)
-	case '(', ')', '[', isAlnum(c), '.', '\u0003':
-		break
-	default:
-		err = fmt.Errorf("Parse error [nonterm T']")
-	}
-	return err
+	}
+	if start == p.curr {
+		return 0, fmt.Errorf("Parse error at position %d - a number expected", p.curr)
+	}
+	ans, err := strconv.Atoi(string(p.inputStr[start:p.curr]))
+	if err != nil || ans > maxRepeat {
+		return 0, fmt.Errorf("Parse error at position %d - invalid repetition bounds", start)
+	}
+	return ans, nil
 }
 
 // F -> atom
+// F -> .
+// F -> \<char>
 // F -> (R)
 // F -> [L]
-func (p *Parser) parseFactor() error {
-	var err error
+func (p *Parser) parseFactor() (Node, error) {
 	c := p.currChar()
-	switch c {
-	case '(':
+	switch {
+	case c == '(':
 		p.fetchNextChar()
-		err = p.parseRegex()
+		ans, err := p.parseRegex()
 		if err != nil {
-			break
+			return nil, err
+		}
+		if err := p.match(')'); err != nil {
+			return nil, err
 		}
-		err = p.match(')')
-	case '[':
-		p.stack.Push(newState())
+		return ans, nil
+	case c == '[':
 		p.fetchNextChar()
-		err = p.parseList()
+		ans, err := p.parseList()
 		if err != nil {
-			break
+			return nil, err
 		}
-		err = p.match(']')
-		if err == nil {
-			joinState := newState()
-			for _, c := range p.stack.Peek().children {
-				c.appendState(joinState)
-			}
+		if err := p.match(']'); err != nil {
+			return nil, err
 		}
-	case isAlnum(c):
-		p.stack.Push(newRune(c))
+		return ans, nil
+	case c == '.':
 		p.fetchNextChar()
-	case '.':
-		p.stack.Push(newDot())
+		return &AnyChar{}, nil
+	case c == '\\':
+		r, named, negated, err := p.parseEscape()
+		if err != nil {
+			return nil, err
+		}
+		if named != 0 {
+			return &CharClass{Named: []NamedClass{named}, Negated: negated}, nil
+		}
+		return &Literal{Value: r}, nil
+	case isAtom(c):
 		p.fetchNextChar()
-	default:
-		err = fmt.Errorf("Parse error [nonterm F]")
+		return &Literal{Value: c}, nil
 	}
-	return err
+	return nil, fmt.Errorf("Parse error at position %d - unexpected character %c", p.curr, c)
 }
 
-func (p *Parser) parseList() error {
-	var err error
+// parseEscape parses an escaped character. In case of a predefined
+// class, the class is returned (along with information whether it
+// is negated - e.g. \W), otherwise the escaped character.
+func (p *Parser) parseEscape() (rune, NamedClass, bool, error) {
+	p.fetchNextChar()
 	c := p.currChar()
+	if c == endOfInput {
+		return 0, 0, false, fmt.Errorf("Parse error at position %d - missing escaped character", p.curr)
+	}
+	p.fetchNextChar()
 	switch c {
-	case isAlnum(c):
-		p.stack.Peek().addRune(c)
+	case 'w', 'd', 's':
+		return 0, NamedClass(c), false, nil
+	case 'W', 'D', 'S':
+		return 0, NamedClass(unicode.ToLower(c)), true, nil
+	}
+	if unicode.IsLetter(c) || unicode.IsDigit(c) {
+		return 0, 0, false, fmt.Errorf("Parse error at position %d - unsupported escape sequence \\%c", p.curr-2, c)
+	}
+	return c, 0, false, nil
+}
+
+// L -> I
+// L -> IL
+func (p *Parser) parseList() (Node, error) {
+	ans := &CharClass{}
+	if p.currChar() == '^' {
+		ans.Negated = true
 		p.fetchNextChar()
-		err = p.parseList()
-	case ']':
-		break
-	default:
-		err = fmt.Errorf("Parse error at position %d - incorrect character list", p.curr)
 	}
-	return err
+	for p.currChar() != ']' {
+		from, named, err := p.parseListItem()
+		if err != nil {
+			return nil, err
+		}
+		if named != 0 {
+			ans.Named = append(ans.Named, named)
+			continue
+		}
+		to := from
+		if p.currChar() == '-' && p.curr+1 < len(p.inputStr) && p.inputStr[p.curr+1] != ']' {
+			p.fetchNextChar()
+			to, named, err = p.parseListItem()
+			if err != nil {
+				return nil, err
+			}
+			if named != 0 || to < from {
+				return nil, fmt.Errorf("Parse error at position %d - invalid character range", p.curr)
+			}
+		}
+		ans.Ranges = append(ans.Ranges, RuneRange{From: from, To: to})
+	}
+	if len(ans.Ranges) == 0 && len(ans.Named) == 0 {
+		return nil, fmt.Errorf("Parse error at position %d - empty character list", p.curr)
+	}
+	return ans, nil
+}
+
+// I -> atom | \<char> | \w | \d | \s
+func (p *Parser) parseListItem() (rune, NamedClass, error) {
+	c := p.currChar()
+	switch c {
+	case '\\':
+		r, named, negated, err := p.parseEscape()
+		if err != nil {
+			return 0, 0, err
+		}
+		if negated {
+			return 0, 0, fmt.Errorf("Parse error at position %d - negated classes cannot be used in a character list", p.curr-2)
+		}
+		return r, named, nil
+	case endOfInput, '(', ')', '[':
+		return 0, 0, fmt.Errorf("Parse error at position %d - incorrect character list", p.curr)
+	}
+	p.fetchNextChar()
+	return c, 0, nil
 }
 
 func (p *Parser) match(c rune) error {
@@ -247,5 +369,5 @@ func (p *Parser) match(c rune) error {
 }
 
 func NewParser() *Parser {
-	return &Parser{stack: newAltStack()}
+	return &Parser{}
 }
@@ -84,8 +84,8 @@ func TestAlternativesPriority(t *testing.T) {
 	assert.Nil(t, err)
 	alts := p.GetAllPrefixes()
 	assert.Equal(t, 2, len(alts))
-	assert.Equal(t, "fooar", alts[0])
-	assert.Equal(t, "fobar", alts[1])
+	assert.Equal(t, "foo", alts[0])
+	assert.Equal(t, "bar", alts[1])
 }
 
 // Combined stuff
@@ -162,3 +162,79 @@ func TestPlaceholder2(t *testing.T) {
 	assert.Equal(t, "foo*", alts[0])
 	assert.Equal(t, "fooz", alts[1])
 }
+
+func TestCharRanges(t *testing.T) {
+	p := NewParser()
+	err := p.Parse("x[a-c_]")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"xa", "xb", "xc", "x_"}, p.GetAllPrefixes())
+}
+
+func TestNegatedAndNamedClasses(t *testing.T) {
+	p := NewParser()
+	for _, expr := range []string{"ab[^c]d", `ab\wd`, `ab[\d-]d`, `ab\Sd`} {
+		err := p.Parse(expr)
+		assert.Nil(t, err, expr)
+		assert.Equal(t, []string{"ab*"}, p.GetAllPrefixes(), expr)
+	}
+}
+
+func TestBoundedRepetition(t *testing.T) {
+	p := NewParser()
+	err := p.Parse("a(bc){1,2}")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"abcbc", "abc"}, p.GetAllPrefixes())
+
+	err = p.Parse("x{2,}y")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"xxx*", "xxy"}, p.GetAllPrefixes())
+}
+
+func TestEscapedSpecialChars(t *testing.T) {
+	p := NewParser()
+	err := p.Parse(`a\.b\*`)
+	assert.Nil(t, err)
+	assert.Equal(t, &Concat{Items: []Node{
+		&Literal{Value: 'a'}, &Literal{Value: '.'}, &Literal{Value: 'b'}, &Literal{Value: '*'}}}, p.AST())
+}
+
+func TestTooManyPrefixes(t *testing.T) {
+	p := NewParser()
+	err := p.Parse("pre[a-z][a-z][a-z]x")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pre*"}, p.GetAllPrefixes())
+
+	err = p.Parse("(a|b)[a-z][a-z][a-z]")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"*"}, p.GetAllPrefixes())
+}
+
+func TestInvalidExpressions(t *testing.T) {
+	p := NewParser()
+	for _, expr := range []string{"a{2", "a{3,1}", "a{5000}", `a\q`, "[z-a]", "[]", "(ab", "a|b)", "*a", `[\W]`, "a b"} {
+		assert.Error(t, p.Parse(expr), expr)
+	}
+}
+
+func TestASTString(t *testing.T) {
+	p := NewParser()
+	for expr, expected := range map[string]string{
+		"foo|ba[rz]":  "foo|ba[rz]",
+		"x(a|b)+y":    "x(?:a|b)+y",
+		`\d{2,}\.\w?`: `[\p{Nd}]{2,}\.[\pL\p{Nd}_]?`,
+		"(ab){3}[^-]": "(?:ab){3}[^\\-]",
+	} {
+		assert.Nil(t, p.Parse(expr))
+		assert.Equal(t, expected, p.AST().String(), expr)
+	}
+}
+
+func TestCharClassMatches(t *testing.T) {
+	c := &CharClass{Ranges: []RuneRange{{From: 'a', To: 'c'}}, Named: []NamedClass{DigitClass}}
+	assert.True(t, c.Matches('b'))
+	assert.True(t, c.Matches('7'))
+	assert.False(t, c.Matches('x'))
+	c.Negated = true
+	assert.True(t, c.Matches('x'))
+	assert.True(t, (&CharClass{Named: []NamedClass{WordClass}}).Matches('ř'))
+}
@@ -0,0 +1,213 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package query
+
+// Prefixes of words an expression can match are derived
+// by building an alternatives graph (see atnstate) where
+// a dot state means "any continuation". Characters of small
+// non-negated classes are enumerated, other classes are
+// treated like dots. Unbounded repetitions are expanded
+// to their minimal count (a word ends here) and to one more
+// repetition followed by any continuation.
+
+const (
+	// maxPrefixes is max. number of generated prefixes. Once
+	// exceeded, only a common prefix of all the words is used.
+	maxPrefixes = 256
+
+	// maxClassRunes is max. number of characters of a class
+	// enumerated as separate prefixes
+	maxClassRunes = 32
+)
+
+// countAlternatives estimates number of alternatives generated
+// for a node. The returned value is never higher than limit + 1.
+func countAlternatives(node Node, limit int) int {
+	saturate := func(v int) int {
+		if v > limit {
+			return limit + 1
+		}
+		return v
+	}
+	switch n := node.(type) {
+	case *CharClass:
+		if r := n.runes(maxClassRunes); r != nil {
+			return saturate(len(r))
+		}
+		return 1
+	case *Concat:
+		ans := 1
+		for _, item := range n.Items {
+			ans = saturate(ans * countAlternatives(item, limit))
+		}
+		return ans
+	case *Alternation:
+		ans := 0
+		for _, alt := range n.Alts {
+			ans = saturate(ans + countAlternatives(alt, limit))
+		}
+		return ans
+	case *Repeat:
+		sub := countAlternatives(n.Sub, limit)
+		max := n.Max
+		if max == -1 {
+			max = n.Min + 1
+		}
+		ans := 0
+		for k := n.Min; k <= max; k++ {
+			v := 1
+			for i := 0; i < k && v <= limit; i++ {
+				v = saturate(v * sub)
+			}
+			ans = saturate(ans + v)
+			if ans > limit {
+				break
+			}
+		}
+		return ans
+	}
+	return 1
+}
+
+// buildAlternatives creates an alternatives graph fragment
+// for a node. The fragment is identified by its first and
+// last state.
+func buildAlternatives(node Node) (*atnstate, *atnstate) {
+	switch n := node.(type) {
+	case *Literal:
+		ans := newRune(n.Value)
+		return ans, ans
+	case *CharClass:
+		runes := n.runes(maxClassRunes)
+		if runes == nil {
+			return buildAnyContinuation()
+		}
+		fork := newState()
+		join := newState()
+		for _, r := range runes {
+			fork.addRune(r).appendState(join)
+		}
+		return fork, join
+	case *Concat:
+		first := newState()
+		last := first
+		for _, item := range n.Items {
+			beg, end := buildAlternatives(item)
+			last.appendState(beg)
+			last = end
+		}
+		return first, last
+	case *Alternation:
+		fork := newState()
+		join := newState()
+		for _, alt := range n.Alts {
+			beg, end := buildAlternatives(alt)
+			fork.appendState(beg)
+			end.appendState(join)
+		}
+		return fork, join
+	case *Repeat:
+		fork := newState()
+		join := newState()
+		if n.Max == -1 {
+			beg, end := buildRepetition(n.Sub, n.Min+1)
+			dot, dotEnd := buildAnyContinuation()
+			end.appendState(dot)
+			fork.appendState(beg)
+			dotEnd.appendState(join)
+			beg, end = buildRepetition(n.Sub, n.Min)
+			fork.appendState(beg)
+			end.appendState(join)
+
+		} else {
+			for k := n.Max; k >= n.Min; k-- {
+				beg, end := buildRepetition(n.Sub, k)
+				fork.appendState(beg)
+				end.appendState(join)
+			}
+		}
+		return fork, join
+	case *AnyChar:
+		return buildAnyContinuation()
+	}
+	ans := newState()
+	return ans, ans
+}
+
+// buildRepetition creates a fragment matching a node
+// repeated exactly count times
+func buildRepetition(node Node, count int) (*atnstate, *atnstate) {
+	first := newState()
+	last := first
+	for i := 0; i < count; i++ {
+		beg, end := buildAlternatives(node)
+		last.appendState(beg)
+		last = end
+	}
+	return first, last
+}
+
+// buildAnyContinuation creates a dot state followed
+// by an empty state (as a dot cannot be followed by
+// more states than one)
+func buildAnyContinuation() (*atnstate, *atnstate) {
+	dot := newDot()
+	end := newState()
+	dot.appendState(end)
+	return dot, end
+}
+
+// literalPrefix returns a sequence of literals
+// an expression starts with
+func literalPrefix(node Node) string {
+	switch n := node.(type) {
+	case *Literal:
+		return string(n.Value)
+	case *Concat:
+		ans := ""
+		for _, item := range n.Items {
+			lit, ok := item.(*Literal)
+			if !ok {
+				return ans + literalPrefix(item)
+			}
+			ans += string(lit.Value)
+		}
+		return ans
+	case *Repeat:
+		if n.Min > 0 {
+			return literalPrefix(n.Sub)
+		}
+	}
+	return ""
+}
+
+// findPrefixes returns prefixes of words matched by
+// an expression (see Parser.GetAllPrefixes)
+func findPrefixes(node Node) []string {
+	if countAlternatives(node, maxPrefixes) > maxPrefixes {
+		return []string{literalPrefix(node) + "*"}
+	}
+	beg, _ := buildAlternatives(node)
+	alts := beg.getAll()
+	ans := make([]string, 0, len(alts))
+	used := make(map[string]bool)
+	for _, v := range alts {
+		if !used[v] {
+			ans = append(ans, v)
+			used[v] = true
+		}
+	}
+	return ans
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"container/list"
+	"log"
+	"sync"
+
+	"github.com/tomachalek/gloomy/index/gconf"
+)
+
+const (
+	defaultMaxOpenCorpora = 10
+)
+
+type registryEntry struct {
+	corpus *Corpus
+	err    error
+	loaded chan struct{}
+	elm    *list.Element
+}
+
+// CorpusRegistry keeps opened corpora in memory so they
+// can be shared between requests. Each corpus is opened
+// only once (even if requested concurrently). In case
+// the number of opened corpora or their estimated memory
+// size exceeds configured limits, the least recently used
+// corpora are closed.
+type CorpusRegistry struct {
+	conf           *gconf.SearchConf
+	maxOpenCorpora int
+	memLimit       int64
+	entries        map[string]*registryEntry
+	lru            *list.List
+	mutex          sync.Mutex
+}
+
+// Get returns an opened corpus identified by corpusID.
+// The corpus is opened in case it is not already.
+func (r *CorpusRegistry) Get(corpusID string) (*Corpus, error) {
+	r.mutex.Lock()
+	entry, ok := r.entries[corpusID]
+	if ok {
+		r.lru.MoveToFront(entry.elm)
+		r.mutex.Unlock()
+		<-entry.loaded
+		return entry.corpus, entry.err
+	}
+	entry = &registryEntry{loaded: make(chan struct{})}
+	entry.elm = r.lru.PushFront(corpusID)
+	r.entries[corpusID] = entry
+	r.mutex.Unlock()
+
+	entry.corpus, entry.err = OpenCorpus(r.conf, corpusID)
+	close(entry.loaded)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if entry.err != nil {
+		r.remove(corpusID)
+
+	} else {
+		log.Printf("Opened corpus %s", corpusID)
+		r.evict()
+	}
+	return entry.corpus, entry.err
+}
+
+// Size returns number of corpora kept in the registry
+func (r *CorpusRegistry) Size() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.entries)
+}
+
+func (r *CorpusRegistry) remove(corpusID string) {
+	if entry, ok := r.entries[corpusID]; ok {
+		r.lru.Remove(entry.elm)
+		delete(r.entries, corpusID)
+	}
+}
+
+// memSize returns estimated memory size of all
+// the loaded corpora.
+func (r *CorpusRegistry) memSize() int64 {
+	var ans int64
+	for _, entry := range r.entries {
+		select {
+		case <-entry.loaded:
+			if entry.corpus != nil {
+				ans += entry.corpus.MemSize()
+			}
+		default:
+		}
+	}
+	return ans
+}
+
+// evict removes least recently used corpora until the limits
+// are met. The most recently used corpus is always kept.
+// Searches already running on an evicted corpus are not
+// affected.
+func (r *CorpusRegistry) evict() {
+	for r.lru.Len() > 1 && (r.lru.Len() > r.maxOpenCorpora ||
+		r.memLimit > 0 && r.memSize() > r.memLimit) {
+		corpusID := r.lru.Back().Value.(string)
+		r.remove(corpusID)
+		log.Printf("Closed corpus %s", corpusID)
+	}
+}
+
+// NewCorpusRegistry creates a new registry for corpora
+// as configured in conf (data path, corpusCacheSize,
+// corpusCacheMemoryMB).
+func NewCorpusRegistry(conf *gconf.SearchConf) *CorpusRegistry {
+	maxOpenCorpora := conf.CorpusCacheSize
+	if maxOpenCorpora <= 0 {
+		maxOpenCorpora = defaultMaxOpenCorpora
+	}
+	return &CorpusRegistry{
+		conf:           conf,
+		maxOpenCorpora: maxOpenCorpora,
+		memLimit:       int64(conf.CorpusCacheMemoryMB) * 1024 * 1024,
+		entries:        make(map[string]*registryEntry),
+		lru:            list.New(),
+	}
+}
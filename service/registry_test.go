@@ -0,0 +1,97 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestingRegistry(basePath string, maxOpenCorpora int, memLimit int64) *CorpusRegistry {
+	conf := createTestingConf(basePath)
+	conf.CorpusCacheSize = maxOpenCorpora
+	ans := NewCorpusRegistry(conf)
+	ans.memLimit = memLimit
+	return ans
+}
+
+func TestRegistryKeepsCorpusOpened(t *testing.T) {
+	basePath := createTestingDataDir(t, "c1")
+	defer os.RemoveAll(basePath)
+	r := newTestingRegistry(basePath, 2, 0)
+	c1, err := r.Get("c1")
+	assert.Nil(t, err)
+	c2, err := r.Get("c1")
+	assert.Nil(t, err)
+	assert.True(t, c1 == c2)
+	assert.Equal(t, 1, r.Size())
+}
+
+func TestRegistryConcurrentGet(t *testing.T) {
+	basePath := createTestingDataDir(t, "c1")
+	defer os.RemoveAll(basePath)
+	r := newTestingRegistry(basePath, 2, 0)
+	var wg sync.WaitGroup
+	ans := make([]*Corpus, 10)
+	for i := range ans {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ans[i], _ = r.Get("c1")
+		}(i)
+	}
+	wg.Wait()
+	for i := range ans {
+		assert.True(t, ans[0] == ans[i])
+	}
+}
+
+func TestRegistryNotFound(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	r := newTestingRegistry(basePath, 2, 0)
+	_, err := r.Get("foo")
+	assert.Error(t, err)
+	assert.Equal(t, 0, r.Size())
+}
+
+func TestRegistryEvictsLRU(t *testing.T) {
+	basePath := createTestingDataDir(t, "c1", "c2", "c3")
+	defer os.RemoveAll(basePath)
+	r := newTestingRegistry(basePath, 2, 0)
+	c1, _ := r.Get("c1")
+	r.Get("c2")
+	r.Get("c1")
+	r.Get("c3") // c2 is the least recently used one
+	assert.Equal(t, 2, r.Size())
+	_, ok := r.entries["c2"]
+	assert.False(t, ok)
+	c1b, _ := r.Get("c1")
+	assert.True(t, c1 == c1b)
+}
+
+func TestRegistryEvictsByMemory(t *testing.T) {
+	basePath := createTestingDataDir(t, "c1", "c2")
+	defer os.RemoveAll(basePath)
+	r := newTestingRegistry(basePath, 10, 1)
+	r.Get("c1")
+	r.Get("c2")
+	assert.Equal(t, 1, r.Size())
+	_, ok := r.entries["c2"]
+	assert.True(t, ok)
+}
@@ -15,19 +15,32 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"github.com/tomachalek/gloomy/gerrors"
 	"github.com/tomachalek/gloomy/index"
+	"github.com/tomachalek/gloomy/index/gconf"
 	"github.com/tomachalek/gloomy/service/query"
 	"github.com/tomachalek/gloomy/wdict"
-	"path/filepath"
-	"regexp"
 	"strings"
 )
 
+// AttrValsCount is a number of occurrences of an n-gram
+// with specific values of the requested attributes
+type AttrValsCount struct {
+	Args  []string `json:"args"`
+	Count int      `json:"count"`
+}
+
 type SearchResultItem struct {
 	Ngram []string `json:"ngram"`
 	Count int      `json:"count"`
 	Args  []string `json:"args"`
+
+	// Distribution contains counts of the n-gram per values
+	// of the requested attributes (empty if no attributes
+	// are requested)
+	Distribution []*AttrValsCount `json:"distribution,omitempty"`
 }
 
 // --------------------------------------------------------------
@@ -39,26 +52,128 @@ type SearchArgs struct {
 	Offset    int
 	Limit     int
 	QueryType int
+
+	// GroupBy specifies attributes to aggregate counts
+	// of all the matching n-grams by
+	GroupBy []string
+
+	// Facets specifies attributes to calculate counts
+	// per value for (each attribute separately)
+	Facets []string
+
+	// Filters restricts the search to n-grams with specified
+	// metadata attribute values (all the constraints must match)
+	Filters []index.AttrConstraint
+
+	// Sort specifies an order of result items (see sort.go);
+	// empty value means the index order
+	Sort string
+
+	// MinCount and MaxCount restrict the search to n-grams
+	// with total count within the range (zero = no limit)
+	MinCount int
+	MaxCount int
+
+	// Cursor is a continuation token returned with a previous
+	// page of the same query (see SearchResult.NextCursor)
+	Cursor string
 }
 
 func (s SearchArgs) clone() SearchArgs {
-	var newAttrs []string
-	copy(newAttrs, s.Attrs)
 	return SearchArgs{
 		CorpusID:  s.CorpusID,
 		Phrase:    s.Phrase,
-		Attrs:     newAttrs,
+		Attrs:     append([]string{}, s.Attrs...),
 		Offset:    s.Offset,
 		Limit:     s.Limit,
 		QueryType: s.QueryType,
+		GroupBy:   append([]string{}, s.GroupBy...),
+		Facets:    append([]string{}, s.Facets...),
+		Filters:   append([]index.AttrConstraint{}, s.Filters...),
+		Sort:      s.Sort,
+		MinCount:  s.MinCount,
+		MaxCount:  s.MaxCount,
+		Cursor:    s.Cursor,
 	}
 }
 
+// validateQuery validates arguments common
+// to searching and counting
+func validateQuery(args SearchArgs) error {
+	if args.QueryType < 0 || args.QueryType > 3 {
+		return &gerrors.InvalidArgumentError{Arg: "qtype", Reason: "unknown query type"}
+	}
+	if args.Offset < 0 {
+		return &gerrors.InvalidArgumentError{Arg: "offset", Reason: "negative value"}
+	}
+	if args.Limit < -1 {
+		return &gerrors.InvalidArgumentError{Arg: "limit", Reason: "value must be -1 (no limit) or higher"}
+	}
+	return validateCountRange(args.MinCount, args.MaxCount)
+}
+
+func validateCountRange(minCount int, maxCount int) error {
+	if minCount < 0 {
+		return &gerrors.InvalidArgumentError{Arg: "minCount", Reason: "negative value"}
+	}
+	if maxCount < 0 {
+		return &gerrors.InvalidArgumentError{Arg: "maxCount", Reason: "negative value"}
+	}
+	if maxCount > 0 && maxCount < minCount {
+		return &gerrors.InvalidArgumentError{Arg: "maxCount", Reason: "smaller than minCount"}
+	}
+	return nil
+}
+
+// ParseAttrConstraint parses a metadata attribute constraint
+// in one of the following forms:
+//
+//	attr=value
+//	attr=value1|value2|...|valueN  (any of the values)
+//	attr~regexp                    (applied to whole values)
+func ParseAttrConstraint(expr string) (index.AttrConstraint, error) {
+	sep := strings.IndexAny(expr, "=~")
+	if sep < 1 {
+		return index.AttrConstraint{}, &gerrors.InvalidArgumentError{
+			Arg:    "filter",
+			Reason: fmt.Sprintf("invalid attribute constraint '%s'", expr),
+		}
+	}
+	ans := index.AttrConstraint{Attr: expr[:sep]}
+	if expr[sep] == '~' {
+		ans.Regexp = expr[sep+1:]
+
+	} else {
+		ans.Values = strings.Split(expr[sep+1:], "|")
+	}
+	return ans, nil
+}
+
 // ---------------------------------------------------------------
 
+// ngramDecoder translates encoded n-grams to strings
+type ngramDecoder interface {
+	DecodeNgram(ngram []int) []string
+}
+
 type SearchResult struct {
-	result *index.NgramSearchResult
-	wdict  *wdict.WordDictReader
+	result   *index.NgramSearchResult
+	wdict    ngramDecoder
+	attrIdxs []int
+
+	// Groups contains aggregated counts of all the matching
+	// n-grams (i.e. offset and limit are not applied) in case
+	// SearchArgs.GroupBy is specified
+	Groups []*GroupItem
+
+	// Facets contains counts per attribute value for each
+	// of SearchArgs.Facets attributes (calculated from all
+	// the matching n-grams)
+	Facets map[string][]*FacetItem
+
+	// NextCursor is a continuation token for the next page
+	// of a paged search (empty if there are no more n-grams)
+	NextCursor string
 }
 
 func (sr *SearchResult) Size() int {
@@ -69,13 +184,31 @@ func (sr *SearchResult) HasNext() bool {
 	return sr.result.HasNext()
 }
 
+func (sr *SearchResult) selectArgs(metadata []string) []string {
+	args := make([]string, len(sr.attrIdxs))
+	for i, v := range sr.attrIdxs {
+		args[i] = metadata[v]
+	}
+	return args
+}
+
+// distribution projects item's distribution to the requested
+// attributes (merging rows with the same values of the attributes)
+func (sr *SearchResult) distribution(item *index.NgramResultItem) []*AttrValsCount {
+	if len(sr.attrIdxs) == 0 {
+		return nil
+	}
+	return projectDistribution(item, sr.attrIdxs)
+}
+
 func (sr *SearchResult) Next() *SearchResultItem {
 	ans := sr.result.Next()
 	if ans != nil {
 		return &SearchResultItem{
-			Ngram: sr.wdict.DecodeNgram(ans.Ngram),
-			Count: ans.Count,
-			Args:  ans.Metadata,
+			Ngram:        sr.wdict.DecodeNgram(ans.Ngram),
+			Count:        ans.Count,
+			Args:         sr.selectArgs(ans.Metadata),
+			Distribution: sr.distribution(ans),
 		}
 	}
 	return nil
@@ -83,126 +216,413 @@ func (sr *SearchResult) Next() *SearchResultItem {
 
 // ---------------------------------------------------------------
 
-func loadRange(index *index.SearchableIndex, indices []int) {
-	min := indices[0]
-	max := indices[0]
-	for _, v := range indices {
-		if v < min {
-			min = v
-		}
-		if v > max {
-			max = v
+// translateWidxToColIdx returns zero column rows of words
+// (a repeated 1-gram may occupy more rows)
+func translateWidxToColIdx(sindex *index.SearchableIndex, indices []int) []int {
+	ans := make([]int, 0, len(indices))
+	for _, widx := range indices {
+		for _, rng := range sindex.WordRows(&index.WordRange{From: widx, To: widx}) {
+			for row := rng.From; row <= rng.To; row++ {
+				ans = append(ans, row)
+			}
 		}
 	}
-	index.LoadRange(min, max)
+	return ans
 }
 
-func translateWidxToColIdx(index *index.SearchableIndex, indices []int) []int {
-	wi := 0
-	for i := 0; i < len(indices); i++ {
-		indices[wi] = index.GetCol0Idx(indices[i])
-		if indices[wi] > -1 {
-			wi++
-		}
-	}
-	return indices[:wi]
+// isWildcardToken tests whether a query token matches
+// any word (i.e. it does not constrain respective
+// n-gram position at all).
+func isWildcardToken(token string) bool {
+	return token == "*" || token == ".*"
 }
 
-func searchByPrefix(wd *wdict.WordDictReader, sindex *index.SearchableIndex, args SearchArgs) *index.NgramSearchResult {
-	var res *index.NgramSearchResult
-	indices := wd.FindByPrefix(args.Phrase[:len(args.Phrase)-1])
-	indices = translateWidxToColIdx(sindex, indices)
-	loadRange(sindex, indices)
-	ch := make(chan *index.NgramSearchResult, len(indices))
-	for _, colIdx := range indices {
-		go func(v int) {
-			ch <- sindex.GetNgramsOfColIdx(v)
-		}(colIdx)
-	}
-	var chunk *index.NgramSearchResult
-	for range indices {
-		chunk = <-ch
-		if res == nil {
-			res = chunk
+// selectRotation chooses an index rotation where the longest
+// (cyclic) run of constrained query tokens starts at the first
+// position. This allows narrowing the search by tokens other
+// than the first one (e.g. "* of the"). In case no position
+// is constrained, the main index (0) is returned.
+func selectRotation(phrase []string, ngramSize int, rotations []int) int {
+	constrained := make([]bool, len(phrase))
+	for i, token := range phrase {
+		constrained[i] = !isWildcardToken(token)
+	}
+	return selectConstrainedRotation(constrained, ngramSize, rotations)
+}
 
-		} else {
-			res.Append(chunk)
+// selectConstrainedRotation is a variant of selectRotation
+// with constrained query positions already known
+func selectConstrainedRotation(constrained []bool, ngramSize int, rotations []int) int {
+	isConstrained := func(pos int) bool {
+		return pos < len(constrained) && constrained[pos]
+	}
+	bestRotation := 0
+	bestRunLen := 0
+	for _, rot := range rotations {
+		runLen := 0
+		for runLen < ngramSize && isConstrained((rot+runLen)%ngramSize) {
+			runLen++
+		}
+		if runLen > bestRunLen {
+			bestRotation = rot
+			bestRunLen = runLen
 		}
 	}
-	close(ch)
-	return res
+	return bestRotation
 }
 
-func searchByRegexp(wd *wdict.WordDictReader, sindex *index.SearchableIndex, args SearchArgs) *index.NgramSearchResult {
-	parser := query.NewParser()
-	phrase := strings.Split(args.Phrase, " ")
-	// now we try to restrict the searched set by
-	// the first token
-	parser.Parse(phrase[0])
-	prefixes := parser.GetAllPrefixes()
+// wordSetQuery is a query of n-grams with tokens from specified
+// sets of words (used by regexp and CQL queries) prepared for
+// a search within a selected index rotation
+type wordSetQuery struct {
+	// corpus is a corpus (or a nested positional
+	// attributes corpus) the query searches in
+	corpus *Corpus
+
+	// decoder decodes n-grams of the searched index
+	decoder ngramDecoder
 
-	ans := &index.NgramSearchResult{}
-	for _, prefix := range prefixes {
-		args2 := args.clone()
-		args2.Phrase = prefix
-		args2.QueryType = 0 // not needed here; just to keep things consistent
-		if strings.HasSuffix(args2.Phrase, "*") {
-			ans.Append(searchByPrefix(wd, sindex, args2))
+	rotation int
+
+	// words contains (sorted) indices of words matching the first
+	// token of the selected index (nil means any word)
+	words []int
+
+	// matcher tests the other tokens of the n-grams
+	matcher index.NgramMatcher
+}
+
+// searchesAll tests whether all the n-grams of the index
+// must be tested by the matcher
+func (wq *wordSetQuery) searchesAll() bool {
+	return wq.words == nil
+}
+
+// newWordSetQuery creates a query from (sorted) lists of words
+// matching individual tokens (nil means any word). Words of the first
+// token of the selected index determine the searched part of the index,
+// the other n-gram positions are tested by the query's matcher.
+func newWordSetQuery(corp *Corpus, tokens [][]int) *wordSetQuery {
+	constrained := make([]bool, len(tokens))
+	for i, words := range tokens {
+		constrained[i] = words != nil
+	}
+	ans := &wordSetQuery{
+		corpus:   corp,
+		decoder:  corp.wdict,
+		rotation: selectConstrainedRotation(constrained, corp.manifest.NgramSize, corp.manifest.Rotations),
+	}
+	sets := make([]wordSet, len(tokens))
+	for i, words := range tokens {
+		if words == nil {
+			continue
+		}
+		if i == ans.rotation {
+			ans.words = words
 
 		} else {
-			ans.Append(sindex.GetNgramsOf(args2.Phrase))
+			sets[i] = newWordSet(corp.wdict.Size(), words)
 		}
 	}
-	rgList := make([]*regexp.Regexp, len(phrase))
-	for i, p := range phrase {
-		rgList[i] = regexp.MustCompile(fmt.Sprintf("^%s$", p))
-	}
-	ans.Filter(func(v *index.NgramResultItem) bool {
-		ngram := wd.DecodeNgram(v.Ngram)
-		matches := true
-		for i, ptr := range rgList {
-			if !ptr.MatchString(ngram[i]) {
-				matches = false
-				break
+	ans.matcher = func(ngram []int) bool {
+		for i, set := range sets {
+			if set != nil && i < len(ngram) && !set.contains(ngram[i]) {
+				return false
 			}
 		}
-		return matches
-	})
+		return true
+	}
 	return ans
 }
 
-func Search(basePath string, args SearchArgs) (*SearchResult, error) {
-	fullPath := filepath.Join(basePath, args.CorpusID)
-	gindex := index.LoadNgramIndex(fullPath, args.Attrs)
-	wd, err := wdict.LoadWordDict(fullPath)
+// newRegexpQuery finds words matching the expressions
+// of all the constrained query tokens
+func newRegexpQuery(corp *Corpus, args SearchArgs) (*wordSetQuery, error) {
+	phrase, err := queryTokens(corp, args.Phrase)
 	if err != nil {
 		return nil, err
 	}
-	sindex := index.OpenSearchableIndex(gindex, wd)
-	var res *index.NgramSearchResult
+	tokens := make([][]int, len(phrase))
+	for i, p := range phrase {
+		if isWildcardToken(p) {
+			continue
+		}
+		words, err := findMatchingWords(corp, p)
+		if err != nil {
+			return nil, err
+		}
+		tokens[i] = words
+	}
+	return newWordSetQuery(corp, tokens), nil
+}
 
-	if args.QueryType == 1 {
-		res = searchByRegexp(wd, sindex, args)
+// phraseQuery is a default query prepared for a search within
+// a selected index rotation. The query consists of space separated
+// tokens - exact words, prefixes (ending with '*') and '*' for any word.
+type phraseQuery struct {
+	rotation int
 
-	} else {
-		if strings.HasSuffix(args.Phrase, "*") {
-			res = searchByPrefix(wd, sindex, args)
+	// words contains ranges of words matching
+	// individual tokens (nil = any word)
+	words []*index.WordRange
+}
 
-		} else {
-			res = sindex.GetNgramsOf(args.Phrase)
+// normalizeToken normalizes a token of a default query the same
+// way words of the corpus have been normalized (a trailing '*'
+// of a prefix is kept)
+func (c *Corpus) normalizeToken(token string) string {
+	if strings.HasSuffix(token, "*") {
+		return c.manifest.Normalization.Apply(token[:len(token)-1]) + "*"
+	}
+	return c.manifest.Normalization.Apply(token)
+}
+
+// normalizeExpr normalizes literals of a regular expression
+// the same way words of the corpus have been normalized
+func (c *Corpus) normalizeExpr(expr query.Node) query.Node {
+	if c.manifest.Normalization.IsIdentity() {
+		return expr
+	}
+	return query.NormalizeLiterals(expr, c.manifest.Normalization.Apply)
+}
+
+// tokenWords returns a range of words matching a token
+// of a default query (nil means any word)
+func tokenWords(wd *wdict.WordDictReader, token string) *index.WordRange {
+	if token == "*" {
+		return nil
+	}
+	if strings.HasSuffix(token, "*") {
+		// words are sorted so the ones with the same
+		// prefix form a continuous range
+		indices := wd.FindByPrefix(token[:len(token)-1])
+		if len(indices) == 0 {
+			return &index.WordRange{From: 0, To: -1}
+		}
+		ans := &index.WordRange{From: indices[0], To: indices[0]}
+		for _, v := range indices {
+			if v < ans.From {
+				ans.From = v
+			}
+			if v > ans.To {
+				ans.To = v
+			}
+		}
+		return ans
+	}
+	w := wd.Find(token)
+	if w == -1 {
+		return &index.WordRange{From: 0, To: -1}
+	}
+	return &index.WordRange{From: w, To: w}
+}
+
+// checkNumTokens tests whether a query with a specified
+// number of tokens can be searched in the corpus
+func checkNumTokens(corp *Corpus, numTokens int) error {
+	if numTokens > corp.manifest.NgramSize {
+		return &gerrors.InvalidArgumentError{
+			Arg:    "q",
+			Reason: fmt.Sprintf("query contains more tokens than n-gram size (%d)", corp.manifest.NgramSize),
 		}
 	}
-	if res.Size() >= args.Offset+args.Limit {
-		res.Slice(args.Offset, args.Offset+args.Limit)
+	return nil
+}
+
+// queryTokens splits a query into (space separated) tokens
+// and checks their number
+func queryTokens(corp *Corpus, query string) ([]string, error) {
+	ans := strings.Fields(query)
+	if len(ans) == 0 {
+		return nil, &gerrors.InvalidArgumentError{Arg: "q", Reason: "empty query"}
+	}
+	if err := checkNumTokens(corp, len(ans)); err != nil {
+		return nil, err
+	}
+	return ans, nil
+}
+
+func newPhraseQuery(corp *Corpus, args SearchArgs) (*phraseQuery, error) {
+	phrase, err := queryTokens(corp, args.Phrase)
+	if err != nil {
+		return nil, err
+	}
+	ans := &phraseQuery{
+		rotation: selectRotation(phrase, corp.manifest.NgramSize, corp.manifest.Rotations),
+		words:    make([]*index.WordRange, len(phrase)),
+	}
+	for i, token := range phrase {
+		ans.words[i] = tokenWords(corp.wdict, corp.normalizeToken(token))
 	}
-	ans := &SearchResult{result: res, wdict: wd}
 	return ans, nil
 }
 
+// queryIndex is an index opened for a query
+type queryIndex struct {
+	sindex *index.SearchableIndex
+
+	// ranges contains sorted ranges of zero column
+	// rows the query has to search in
+	ranges []index.RowRange
+
+	// decoder decodes n-grams of the index
+	decoder ngramDecoder
+}
+
+// openQueryIndex opens an index suitable for a query
+// along with ranges of rows the query has to search in.
+func (c *Corpus) openQueryIndex(ctx context.Context, args SearchArgs) (*queryIndex, error) {
+	if args.QueryType == 0 {
+		pq, err := newPhraseQuery(c, args)
+		if err != nil {
+			return nil, err
+		}
+		sindex, err := c.openSearchableIndex(ctx, pq.rotation, args)
+		if err != nil {
+			return nil, err
+		}
+		sindex.SetWordRanges(pq.words)
+		var first *index.WordRange
+		if pq.rotation < len(pq.words) {
+			first = pq.words[pq.rotation]
+		}
+		return &queryIndex{sindex: sindex, ranges: sindex.WordRows(first), decoder: c.wdict}, nil
+	}
+	var wq *wordSetQuery
+	var err error
+	if args.QueryType == 2 {
+		wq, err = newCQLQuery(c, args)
+
+	} else if args.QueryType == 3 {
+		wq, err = newFoldedQuery(c, args)
+
+	} else {
+		wq, err = newRegexpQuery(c, args)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sindex, err := wq.corpus.openSearchableIndex(ctx, wq.rotation, args)
+	if err != nil {
+		return nil, err
+	}
+	sindex.SetNgramMatcher(wq.matcher)
+	ans := &queryIndex{sindex: sindex, decoder: wq.decoder}
+	if wq.searchesAll() {
+		ans.ranges = sindex.AllRows()
+
+	} else {
+		ans.ranges = index.NewRowRanges(translateWidxToColIdx(sindex, wq.words))
+	}
+	return ans, nil
+}
+
+// Search performs a search on the corpus. The method
+// can be called concurrently. The search stops once
+// ctx is done or a configured query budget is exceeded.
+func (c *Corpus) Search(ctx context.Context, args SearchArgs) (*SearchResult, error) {
+	attrIdxs, err := c.attrIndices(args.Attrs)
+	if err != nil {
+		return nil, err
+	}
+	groupByIdxs, err := c.attrIndices(args.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	facetIdxs, err := c.attrIndices(args.Facets)
+	if err != nil {
+		return nil, err
+	}
+	sortLess, sortUsesMetadata, err := c.parseSort(args.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateQuery(args); err != nil {
+		return nil, err
+	}
+	if err := validateCursor(args); err != nil {
+		return nil, err
+	}
+	ctx, cancel := c.queryContext(ctx)
+	defer cancel()
+	if isPageable(args) {
+		ans, err := c.searchPage(ctx, args, attrIdxs)
+		return ans, c.queryError(err)
+	}
+	qindex, err := c.openQueryIndex(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	ans := &SearchResult{wdict: qindex.decoder, attrIdxs: attrIdxs}
+	var res *index.NgramSearchResult
+	if sortLess != nil && args.Limit >= 0 && len(groupByIdxs) == 0 && len(facetIdxs) == 0 {
+		// we need only the first offset + limit items
+		res, err = qindex.sindex.GetTopNgramsInRanges(qindex.ranges, args.Offset+args.Limit,
+			sortLess, sortUsesMetadata)
+		if err != nil {
+			return nil, c.queryError(err)
+		}
+
+	} else {
+		res, err = qindex.sindex.GetNgramsInRanges(qindex.ranges)
+		if err != nil {
+			return nil, c.queryError(err)
+		}
+		if len(groupByIdxs) > 0 {
+			ans.Groups = groupResult(res, groupByIdxs)
+		}
+		if len(facetIdxs) > 0 {
+			ans.Facets = facetResult(res, args.Facets, facetIdxs)
+		}
+		if sortLess != nil && args.Limit >= 0 {
+			res.TopK(args.Offset+args.Limit, sortLess)
+
+		} else if sortLess != nil {
+			res.Sort(sortLess)
+		}
+	}
+	sliceResult(res, args.Offset, args.Limit)
+	ans.result = res
+	return ans, nil
+}
+
+// sliceResult keeps only the result items starting from offset
+// up to offset + limit (a negative limit means no limit)
+func sliceResult(res *index.NgramSearchResult, offset int, limit int) {
+	rightIdx := res.Size()
+	if limit >= 0 && offset+limit < rightIdx {
+		rightIdx = offset + limit
+	}
+	if offset >= rightIdx {
+		res.Clear()
+		return
+	}
+	res.Slice(offset, rightIdx)
+}
+
+// Search opens a corpus and performs a search. For repeated
+// searches, it is better to keep the corpus opened
+// (see OpenCorpus, CorpusRegistry).
+func Search(ctx context.Context, conf *gconf.SearchConf, args SearchArgs) (*SearchResult, error) {
+	corp, err := OpenCorpus(conf, args.CorpusID)
+	if err != nil {
+		return nil, err
+	}
+	return corp.Search(ctx, args)
+}
+
 // ---------------------------------------------------------
 
 type resultRowsResp struct {
-	Size       int                 `json:"size"`
-	Rows       []*SearchResultItem `json:"rows"`
-	SearchTime float64             `json:"searchTime"`
+	Size       int                     `json:"size"`
+	Rows       []*SearchResultItem     `json:"rows"`
+	Groups     []*GroupItem            `json:"groups,omitempty"`
+	Facets     map[string][]*FacetItem `json:"facets,omitempty"`
+	NextCursor string                  `json:"nextCursor,omitempty"`
+	SearchTime float64                 `json:"searchTime"`
+}
+
+type countResp struct {
+	index.NgramStats
+	SearchTime float64 `json:"searchTime"`
 }
@@ -0,0 +1,98 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/index"
+)
+
+func TestSelectRotationFirstConstrained(t *testing.T) {
+	ans := selectRotation([]string{"in", "any", "case"}, 3, []int{0, 1, 2})
+	assert.Equal(t, 0, ans)
+}
+
+func TestSelectRotationLeadingWildcard(t *testing.T) {
+	ans := selectRotation([]string{"*", "of", "the"}, 3, []int{0, 1, 2})
+	assert.Equal(t, 1, ans)
+}
+
+func TestSelectRotationMiddleWildcard(t *testing.T) {
+	ans := selectRotation([]string{"in", ".*", "case"}, 3, []int{0, 1, 2})
+	assert.Equal(t, 2, ans)
+}
+
+func TestSelectRotationNotAvailable(t *testing.T) {
+	ans := selectRotation([]string{"*", "of", "the"}, 3, []int{0})
+	assert.Equal(t, 0, ans)
+}
+
+func TestSelectRotationShortPhrase(t *testing.T) {
+	ans := selectRotation([]string{"*", "of"}, 3, []int{0, 1, 2})
+	assert.Equal(t, 1, ans)
+}
+
+func TestSelectRotationNoConstraints(t *testing.T) {
+	ans := selectRotation([]string{"*", ".*"}, 3, []int{0, 1, 2})
+	assert.Equal(t, 0, ans)
+}
+
+func TestSearchResultDistribution(t *testing.T) {
+	sr := &SearchResult{attrIdxs: []int{1}}
+	item := &index.NgramResultItem{
+		Count: 6,
+		Distribution: []*index.MetadataCount{
+			{Metadata: []string{"a.txt", "fiction"}, Count: 1},
+			{Metadata: []string{"b.txt", "news"}, Count: 2},
+			{Metadata: []string{"c.txt", "fiction"}, Count: 3},
+		},
+	}
+	assert.Equal(t, []*AttrValsCount{
+		{Args: []string{"fiction"}, Count: 4},
+		{Args: []string{"news"}, Count: 2},
+	}, sr.distribution(item))
+}
+
+func TestSearchResultNoDistribution(t *testing.T) {
+	sr := &SearchResult{attrIdxs: []int{}}
+	item := &index.NgramResultItem{
+		Count:        1,
+		Distribution: []*index.MetadataCount{{Metadata: []string{"fiction"}, Count: 1}},
+	}
+	assert.Nil(t, sr.distribution(item))
+}
+
+func TestParseAttrConstraint(t *testing.T) {
+	c, err := ParseAttrConstraint("doc.genre=fiction")
+	assert.Nil(t, err)
+	assert.Equal(t, index.AttrConstraint{Attr: "doc.genre", Values: []string{"fiction"}}, c)
+
+	c, err = ParseAttrConstraint("doc.genre=fiction|news")
+	assert.Nil(t, err)
+	assert.Equal(t, index.AttrConstraint{Attr: "doc.genre", Values: []string{"fiction", "news"}}, c)
+
+	c, err = ParseAttrConstraint("doc.year~19[67].")
+	assert.Nil(t, err)
+	assert.Equal(t, index.AttrConstraint{Attr: "doc.year", Regexp: "19[67]."}, c)
+}
+
+func TestParseAttrConstraintInvalid(t *testing.T) {
+	_, err := ParseAttrConstraint("doc.genre")
+	assert.Error(t, err)
+	_, err = ParseAttrConstraint("=fiction")
+	assert.Error(t, err)
+}
@@ -15,8 +15,12 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
 	"github.com/tomachalek/gloomy/index/gconf"
 	"github.com/tomachalek/gloomy/util"
 	"log"
@@ -52,6 +56,24 @@ func (e DefaultServerError) HTTPCode() int {
 	return e.Code
 }
 
+// errorHTTPCode maps an error to a respective HTTP code
+// based on its type (see package gerrors)
+func errorHTTPCode(err error) int {
+	if gerrors.IsNotFound(err) {
+		return http.StatusNotFound
+
+	} else if gerrors.IsInvalidInput(err) {
+		return http.StatusBadRequest
+
+	} else if gerrors.IsBudgetExceeded(err) {
+		return http.StatusUnprocessableEntity
+
+	} else if errors.Is(err, context.Canceled) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
 func newServerError(desc interface{}, code int) ServerError {
 	switch desc.(type) {
 	case error:
@@ -63,12 +85,16 @@ func newServerError(desc interface{}, code int) ServerError {
 	}
 }
 
-// ImportQueryType imports end-user encoded query type (default, regexp)
+// ImportQueryType imports end-user encoded query type (default, regexp, cql, ci)
 // to internal numeric ones. Returns -1 in case query type is not found.
 func ImportQueryType(qtype string) int {
 	switch qtype {
 	case "regexp":
 		return 1
+	case "cql":
+		return 2
+	case "ci":
+		return 3
 	case "default":
 		return 0
 	}
@@ -106,41 +132,110 @@ func requireStringArg(args map[string][]string, key string) (string, error) {
 type serviceHandler struct {
 	appVersion string
 	conf       *gconf.SearchConf
+	corpora    *CorpusRegistry
 }
 
 func (s *serviceHandler) parsePath(p string) []string {
 	return strings.Split(strings.Trim(p, "/"), "/")
 }
 
-func (s *serviceHandler) actionSearch(p []string, args map[string][]string) (interface{}, ServerError) {
-	var err1, err2, err3, err4, err5 error
-	t1 := time.Now()
+// parseSearchArgs imports HTTP request arguments
+// shared by searching and counting
+func parseSearchArgs(args map[string][]string) (SearchArgs, ServerError) {
+	var err1, err2, err3, err4, err5, err6, err7 error
 	offset, err1 := fetchIntArg(args, "offset", 0)
 	limit, err2 := fetchIntArg(args, "limit", -1)
 	qtype, err3 := fetchStringArg(args, "qtype", "default")
+	sortSpec, _ := fetchStringArg(args, "sort", "")
+	cursor, _ := fetchStringArg(args, "cursor", "")
 	corpusID, err4 := requireStringArg(args, "corpus")
 	query, err5 := requireStringArg(args, "q")
-	if err := util.FirstError(err1, err2, err3, err4, err5); err != nil {
-		return nil, newServerError(err, 500)
+	minCount, err6 := fetchIntArg(args, "minCount", 0)
+	maxCount, err7 := fetchIntArg(args, "maxCount", 0)
+	if err := util.FirstError(err1, err2, err3, err4, err5, err6, err7); err != nil {
+		return SearchArgs{}, newServerError(err, http.StatusBadRequest)
 	}
-	queryArgs := SearchArgs{
+	queryType := ImportQueryType(qtype)
+	if queryType < 0 {
+		return SearchArgs{}, newServerError(fmt.Sprintf("Unknown query type %s", qtype), http.StatusBadRequest)
+	}
+	filters := make([]index.AttrConstraint, len(args["filter"]))
+	for i, v := range args["filter"] {
+		filter, err := ParseAttrConstraint(v)
+		if err != nil {
+			return SearchArgs{}, newServerError(err, http.StatusBadRequest)
+		}
+		filters[i] = filter
+	}
+	return SearchArgs{
 		CorpusID:  corpusID,
 		Phrase:    query,
-		QueryType: ImportQueryType(qtype),
+		QueryType: queryType,
 		Attrs:     args["attrs"],
 		Offset:    offset,
 		Limit:     limit,
+		GroupBy:   args["groupBy"],
+		Facets:    args["facets"],
+		Filters:   filters,
+		Sort:      sortSpec,
+		MinCount:  minCount,
+		MaxCount:  maxCount,
+		Cursor:    cursor,
+	}, nil
+}
+
+func (s *serviceHandler) actionSearch(ctx context.Context, p []string, args map[string][]string) (interface{}, ServerError) {
+	t1 := time.Now()
+	queryArgs, srvErr := parseSearchArgs(args)
+	if srvErr != nil {
+		return nil, srvErr
+	}
+	format, _ := fetchStringArg(args, "format", "json")
+	if format != "json" && !isStreamFormat(format) {
+		return nil, newServerError(fmt.Sprintf("Unknown response format %s", format), http.StatusBadRequest)
+	}
+	corp, err := s.corpora.Get(queryArgs.CorpusID)
+	if err != nil {
+		return nil, newServerError(err, errorHTTPCode(err))
 	}
-	res, err := Search(s.conf.DataPath, queryArgs)
+	res, err := corp.Search(ctx, queryArgs)
 	t2 := time.Since(t1)
 	if err != nil {
-		return nil, newServerError(err, 500)
+		return nil, newServerError(err, errorHTTPCode(err))
+	}
+	if isStreamFormat(format) {
+		return newRowsStream(format, queryArgs.Attrs, res), nil
 	}
 	rows := make([]*SearchResultItem, res.Size())
 	for i := 0; res.HasNext(); i++ {
 		rows[i] = res.Next()
 	}
-	return &resultRowsResp{Size: res.Size(), Rows: rows, SearchTime: t2.Seconds()}, nil
+	return &resultRowsResp{
+		Size:       res.Size(),
+		Rows:       rows,
+		Groups:     res.Groups,
+		Facets:     res.Facets,
+		NextCursor: res.NextCursor,
+		SearchTime: t2.Seconds(),
+	}, nil
+}
+
+func (s *serviceHandler) actionCount(ctx context.Context, p []string, args map[string][]string) (interface{}, ServerError) {
+	t1 := time.Now()
+	queryArgs, srvErr := parseSearchArgs(args)
+	if srvErr != nil {
+		return nil, srvErr
+	}
+	corp, err := s.corpora.Get(queryArgs.CorpusID)
+	if err != nil {
+		return nil, newServerError(err, errorHTTPCode(err))
+	}
+	stats, err := corp.Count(ctx, queryArgs)
+	t2 := time.Since(t1)
+	if err != nil {
+		return nil, newServerError(err, errorHTTPCode(err))
+	}
+	return &countResp{NgramStats: stats, SearchTime: t2.Seconds()}, nil
 }
 
 func (s *serviceHandler) actionInfo(p []string, args map[string][]string) (interface{}, ServerError) {
@@ -150,27 +245,44 @@ func (s *serviceHandler) actionInfo(p []string, args map[string][]string) (inter
 	return ans, nil
 }
 
-func (s *serviceHandler) route(path []string, args map[string][]string) (interface{}, ServerError) {
+func (s *serviceHandler) route(ctx context.Context, path []string, args map[string][]string) (interface{}, ServerError) {
 	switch path[0] {
 	case "":
 		return s.actionInfo(path, args)
 	case "search":
-		return s.actionSearch(path, args)
+		return s.actionSearch(ctx, path, args)
+	case "count":
+		return s.actionCount(ctx, path, args)
 	default:
 		return nil, newServerError(fmt.Sprintf("Action '%s' not found", path[0]), http.StatusNotFound)
 	}
 }
 
+func writeServerError(resp http.ResponseWriter, err ServerError) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(err.HTTPCode())
+	fmt.Fprintln(resp, err.ToJSON())
+}
+
 func (s *serviceHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	defer func() {
 		if r := recover(); r != nil {
-			http.Error(resp, fmt.Sprintf("%s", r), 500)
+			log.Printf("Recovered from panic: %s", r)
+			writeServerError(resp, newServerError(fmt.Sprintf("%s", r), http.StatusInternalServerError))
 		}
 	}()
 	resp.Header().Set("Content-Type", "application/json")
 	values := req.URL.Query()
-	ans, procErr := s.route(s.parsePath(req.URL.Path), values)
-	if procErr == nil {
+	// the request context is cancelled once the client disconnects
+	ans, procErr := s.route(req.Context(), s.parsePath(req.URL.Path), values)
+	if stream, ok := ans.(streamedResponse); ok && procErr == nil {
+		// the response status has been already sent
+		// so we can only log the error here
+		if err := stream.writeTo(req.Context(), resp); err != nil {
+			log.Printf("Failed to write streamed response: %s", err)
+		}
+
+	} else if procErr == nil {
 		enc := json.NewEncoder(resp)
 		err := enc.Encode(ans)
 		if err != nil {
@@ -178,7 +290,7 @@ func (s *serviceHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request)
 		}
 
 	} else {
-		http.Error(resp, procErr.ToJSON(), procErr.HTTPCode())
+		writeServerError(resp, procErr)
 	}
 }
 
@@ -189,6 +301,12 @@ func Serve(conf *gconf.SearchConf, appVersion string) {
 	h := &serviceHandler{
 		conf:       conf,
 		appVersion: appVersion,
+		corpora:    NewCorpusRegistry(conf),
+	}
+	for _, corpusID := range conf.PreloadCorpora {
+		if _, err := h.corpora.Get(corpusID); err != nil {
+			log.Printf("Failed to preload corpus %s: %s", corpusID, err)
+		}
 	}
 	addr := fmt.Sprintf("%s:%d", conf.ServerAddress, conf.ServerPort)
 	s := &http.Server{
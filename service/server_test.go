@@ -0,0 +1,145 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tomachalek/gloomy/gerrors"
+)
+
+func newTestingHandler(basePath string) *serviceHandler {
+	conf := createTestingConf(basePath)
+	return &serviceHandler{conf: conf, corpora: NewCorpusRegistry(conf)}
+}
+
+func serveTestingRequest(h *serviceHandler, url string) (*httptest.ResponseRecorder, DefaultServerError) {
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", url, nil))
+	var srvErr DefaultServerError
+	json.Unmarshal(resp.Body.Bytes(), &srvErr)
+	return resp, srvErr
+}
+
+func TestErrorHTTPCode(t *testing.T) {
+	assert.Equal(t, http.StatusNotFound, errorHTTPCode(&gerrors.CorpusNotFoundError{CorpusID: "foo"}))
+	assert.Equal(t, http.StatusBadRequest, errorHTTPCode(&gerrors.UnknownAttributeError{Attr: "doc.foo"}))
+	assert.Equal(t, http.StatusBadRequest, errorHTTPCode(&gerrors.InvalidArgumentError{Arg: "q"}))
+	assert.Equal(t, http.StatusUnprocessableEntity, errorHTTPCode(&gerrors.BudgetExceededError{Budget: "time"}))
+	assert.Equal(t, http.StatusInternalServerError, errorHTTPCode(gerrors.NewCorruptDataError("foo.idx", "bad")))
+	assert.Equal(t, http.StatusNotFound, errorHTTPCode(&gerrors.IndexNotFoundError{Path: "foo"}))
+	// wrapped errors
+	assert.Equal(t, http.StatusBadRequest,
+		errorHTTPCode(fmt.Errorf("search failed: %w", &gerrors.InvalidArgumentError{Arg: "q"})))
+	assert.Equal(t, http.StatusServiceUnavailable, errorHTTPCode(fmt.Errorf("search failed: %w", context.Canceled)))
+}
+
+func TestServeSearch(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&q=in")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var ans resultRowsResp
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &ans))
+	assert.Equal(t, 3, ans.Size)
+}
+
+func TestServeCorpusNotFound(t *testing.T) {
+	basePath := createTestingDataDir(t)
+	defer os.RemoveAll(basePath)
+	resp, srvErr := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=foo&q=in")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusNotFound, srvErr.Code)
+	assert.Contains(t, srvErr.Message, "foo")
+}
+
+func TestServeUnknownAttr(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, srvErr := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&q=in&attrs=doc.foo")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, srvErr.Message, "doc.foo")
+}
+
+func TestServeInvalidRegexp(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&qtype=regexp&q=%28foo")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestServeSearchCQL(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath),
+		"/search?corpus=test&qtype=cql&q=%5Bword%3D%22in%22%5D+%5B%5D+%22case%22")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var ans resultRowsResp
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &ans))
+	assert.Equal(t, 3, ans.Size)
+}
+
+func TestServeMissingArg(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestServeCorruptColumn(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	// declare a column length larger than the file
+	f, err := os.OpenFile(filepath.Join(basePath, "test", "idx_col_2.idx"), os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	assert.Nil(t, binary.Write(f, binary.LittleEndian, int64(1000)))
+	f.Close()
+	resp, srvErr := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&q=in")
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	assert.Contains(t, srvErr.Message, "idx_col_2.idx")
+}
+
+func TestServeFilter(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	h := newTestingHandler(basePath)
+	resp, _ := serveTestingRequest(h, "/search?corpus=test&q=in&filter=doc.genre%7Efic.*")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var ans resultRowsResp
+	assert.Nil(t, json.Unmarshal(resp.Body.Bytes(), &ans))
+	assert.Equal(t, 2, ans.Size)
+
+	resp, _ = serveTestingRequest(h, "/search?corpus=test&q=in&filter=doc.genre")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	resp, _ = serveTestingRequest(h, "/search?corpus=test&q=in&filter=doc.foo%3Dbar")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestServeNegativeOffset(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&q=in&offset=-2&limit=1&sort=count")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+// This file contains parsing of result sort specifications.
+// A specification has one of the following forms (a leading
+// '-' means a descending order):
+//
+//	count, -count          by n-gram count
+//	ngram, -ngram          alphabetically by whole n-grams
+//	pos:N, -pos:N          alphabetically by a token at position N
+//	                       (starting from zero)
+//	attr:NAME, -attr:NAME  by a dominant value of a metadata attribute
+//	                       (see dominantValue)
+//
+// Items equal according to the specified key are sorted
+// alphabetically (word dictionary indices are assigned
+// in alphabetical order so no decoding is needed).
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/index"
+)
+
+func compareWordIndices(n1 []int, n2 []int) int {
+	for i := 0; i < len(n1) && i < len(n2); i++ {
+		if n1[i] < n2[i] {
+			return -1
+
+		} else if n1[i] > n2[i] {
+			return 1
+		}
+	}
+	return len(n1) - len(n2)
+}
+
+// dominantValue returns a value of an attribute with the highest
+// count within item's distribution. In case of a tie, the smaller
+// value is returned. For items without metadata, the value is empty.
+func dominantValue(item *index.NgramResultItem, attrIdx int) string {
+	var ans string
+	var ansCount int
+	for _, row := range projectDistribution(item, []int{attrIdx}) {
+		if row.Count > ansCount || row.Count == ansCount && row.Args[0] < ans {
+			ans = row.Args[0]
+			ansCount = row.Count
+		}
+	}
+	return ans
+}
+
+func invalidSortError(spec string, reason string) error {
+	return &gerrors.InvalidArgumentError{Arg: "sort", Reason: reason + ": " + spec}
+}
+
+// parseSort creates a function comparing result items
+// according to a sort specification. In case the specification
+// is empty, nil is returned (= index order). The returned flag
+// tells whether the function compares item metadata.
+func (c *Corpus) parseSort(spec string) (index.ItemLess, bool, error) {
+	if spec == "" {
+		return nil, false, nil
+	}
+	key := strings.TrimPrefix(spec, "-")
+	desc := key != spec
+	usesMetadata := false
+	var cmp func(item1 *index.NgramResultItem, item2 *index.NgramResultItem) int
+
+	switch {
+	case key == "count":
+		cmp = func(item1 *index.NgramResultItem, item2 *index.NgramResultItem) int {
+			return item1.Count - item2.Count
+		}
+	case key == "ngram":
+		cmp = func(item1 *index.NgramResultItem, item2 *index.NgramResultItem) int {
+			return 0 // solved by the alphabetical fallback
+		}
+	case strings.HasPrefix(key, "pos:"):
+		pos, err := strconv.Atoi(key[len("pos:"):])
+		if err != nil || pos < 0 || pos >= c.manifest.NgramSize {
+			return nil, false, invalidSortError(spec, "invalid n-gram position")
+		}
+		cmp = func(item1 *index.NgramResultItem, item2 *index.NgramResultItem) int {
+			return item1.Ngram[pos] - item2.Ngram[pos]
+		}
+	case strings.HasPrefix(key, "attr:"):
+		attrIdxs, err := c.attrIndices([]string{key[len("attr:"):]})
+		if err != nil {
+			return nil, false, err
+		}
+		usesMetadata = true
+		cmp = func(item1 *index.NgramResultItem, item2 *index.NgramResultItem) int {
+			return strings.Compare(dominantValue(item1, attrIdxs[0]), dominantValue(item2, attrIdxs[0]))
+		}
+	default:
+		return nil, false, invalidSortError(spec, "unknown sort key")
+	}
+	return func(item1 *index.NgramResultItem, item2 *index.NgramResultItem) bool {
+		ans := cmp(item1, item2)
+		if desc {
+			ans = -ans
+		}
+		if ans == 0 {
+			ans = compareWordIndices(item1.Ngram, item2.Ngram)
+			if desc && key == "ngram" {
+				ans = -ans
+			}
+		}
+		return ans < 0
+	}, usesMetadata, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Streamed responses write result rows while the result is
+// iterated instead of encoding them into a single response
+// first. This allows exporting large results without keeping
+// the whole encoded response in memory (matching n-grams are
+// still collected by the search itself).
+
+const (
+	// streamFlushInterval specifies how many rows are written
+	// before the response is flushed to the client
+	streamFlushInterval = 1000
+
+	// streamWriteTimeout is a write deadline applied to each
+	// flushed part of a streamed response (instead of the whole
+	// response as configured for the server)
+	streamWriteTimeout = 10 * time.Second
+)
+
+// streamedResponse is a response written by itself
+// instead of being encoded by the server
+type streamedResponse interface {
+	writeTo(ctx context.Context, resp http.ResponseWriter) error
+}
+
+// rowsStream writes search result rows either as
+// newline-delimited JSON (ndjson) or tab-separated
+// values with a header line (tsv)
+type rowsStream struct {
+	format     string
+	attrs      []string
+	result     *SearchResult
+	flushEvery int
+}
+
+func isStreamFormat(format string) bool {
+	return format == "ndjson" || format == "tsv"
+}
+
+func newRowsStream(format string, attrs []string, result *SearchResult) *rowsStream {
+	return &rowsStream{
+		format:     format,
+		attrs:      attrs,
+		result:     result,
+		flushEvery: streamFlushInterval,
+	}
+}
+
+func (rs *rowsStream) contentType() string {
+	if rs.format == "tsv" {
+		return "text/tab-separated-values; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// tsvValue replaces characters which cannot be part
+// of a TSV value
+func tsvValue(v string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(v)
+}
+
+func (rs *rowsStream) writeTSVRow(w *bufio.Writer, values []string) error {
+	for i, v := range values {
+		values[i] = tsvValue(v)
+	}
+	_, err := fmt.Fprintln(w, strings.Join(values, "\t"))
+	return err
+}
+
+func (rs *rowsStream) writeRow(w *bufio.Writer, item *SearchResultItem) error {
+	if rs.format == "tsv" {
+		values := append([]string{strings.Join(item.Ngram, " "), fmt.Sprintf("%d", item.Count)}, item.Args...)
+		return rs.writeTSVRow(w, values)
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
+
+// extendWriteDeadline sets the write deadline
+// for the next part of the response
+func extendWriteDeadline(rc *http.ResponseController) error {
+	if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// flush sends buffered rows to the client and extends
+// the write deadline for the next part of the response
+func (rs *rowsStream) flush(w *bufio.Writer, rc *http.ResponseController) error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return extendWriteDeadline(rc)
+}
+
+// writeTo writes all the result rows. The writing stops
+// once the request context is done (e.g. client disconnected).
+func (rs *rowsStream) writeTo(ctx context.Context, resp http.ResponseWriter) error {
+	rc := http.NewResponseController(resp)
+	resp.Header().Set("Content-Type", rs.contentType())
+	w := bufio.NewWriter(resp)
+	// the server's write timeout has been running since
+	// the request was read (i.e. also during the search)
+	if err := extendWriteDeadline(rc); err != nil {
+		return err
+	}
+	if err := rs.flush(w, rc); err != nil {
+		return err
+	}
+	if rs.format == "tsv" {
+		if err := rs.writeTSVRow(w, append([]string{"ngram", "count"}, rs.attrs...)); err != nil {
+			return err
+		}
+	}
+	for i := 1; rs.result.HasNext(); i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := rs.writeRow(w, rs.result.Next()); err != nil {
+			return err
+		}
+		if i%rs.flushEvery == 0 {
+			if err := rs.flush(w, rc); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeSearchNDJSON(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&q=in&format=ndjson")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+	var ngrams []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var item SearchResultItem
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &item))
+		ngrams = append(ngrams, strings.Join(item.Ngram, " "))
+	}
+	assert.Equal(t, []string{"in any case", "in the case", "in this case"}, ngrams)
+}
+
+func TestServeSearchTSV(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath),
+		"/search?corpus=test&q=.*+of+the&qtype=regexp&attrs=doc.genre&format=tsv")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "ngram\tcount\tdoc.genre\none of the\t5\tfiction\nout of the\t4\tnews\n", resp.Body.String())
+}
+
+func TestServeSearchUnknownFormat(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	resp, _ := serveTestingRequest(newTestingHandler(basePath), "/search?corpus=test&q=in&format=xml")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestRowsStreamFlushing(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: ".*", QueryType: 1, Limit: -1})
+	assert.Nil(t, err)
+	stream := newRowsStream("tsv", []string{}, res)
+	stream.flushEvery = 2
+	resp := httptest.NewRecorder()
+	assert.Nil(t, stream.writeTo(context.Background(), resp))
+	assert.True(t, resp.Flushed)
+	assert.Equal(t, 8, strings.Count(resp.Body.String(), "\n"))
+}
+
+func TestRowsStreamCancelled(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	res, err := corp.Search(context.Background(), SearchArgs{Phrase: "in", Limit: -1})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp := httptest.NewRecorder()
+	err = newRowsStream("ndjson", []string{}, res).writeTo(ctx, resp)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "", resp.Body.String())
+}
+
+func TestRowsStreamSlowQuery(t *testing.T) {
+	basePath := createTestingDataDir(t, "test")
+	defer os.RemoveAll(basePath)
+	corp, _ := OpenCorpus(createTestingConf(basePath), "test")
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		res, err := corp.Search(req.Context(), SearchArgs{Phrase: "in", Limit: -1})
+		assert.Nil(t, err)
+		// the search took longer than the server's write timeout
+		time.Sleep(200 * time.Millisecond)
+		assert.Nil(t, newRowsStream("tsv", []string{}, res).writeTo(req.Context(), resp))
+	}))
+	srv.Config.WriteTimeout = 100 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, strings.Count(string(body), "\n"))
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package service
+
+import (
+	"github.com/tomachalek/gloomy/gerrors"
+	"github.com/tomachalek/gloomy/service/query"
+	"github.com/tomachalek/gloomy/wdict"
+)
+
+// wordSet is a set of word dictionary indices
+// (a bit for each word of the dictionary)
+type wordSet []uint64
+
+func newWordSet(dictSize int, words []int) wordSet {
+	ans := make(wordSet, (dictSize+63)/64)
+	for _, w := range words {
+		ans[w/64] |= 1 << uint(w%64)
+	}
+	return ans
+}
+
+func (ws wordSet) contains(w int) bool {
+	return w >= 0 && w/64 < len(ws) && ws[w/64]&(1<<uint(w%64)) != 0
+}
+
+// complementWords returns (sorted) dictionary indices
+// of all the words not contained in (sorted) words
+func complementWords(dictSize int, words []int) []int {
+	ans := make([]int, 0, dictSize-len(words))
+	j := 0
+	for w := 0; w < dictSize; w++ {
+		if j < len(words) && words[j] == w {
+			j++
+			continue
+		}
+		ans = append(ans, w)
+	}
+	return ans
+}
+
+// intersectWords returns words contained in both (sorted) lists
+func intersectWords(words1 []int, words2 []int) []int {
+	ans := make([]int, 0, len(words1))
+	for i, j := 0, 0; i < len(words1) && j < len(words2); {
+		if words1[i] < words2[j] {
+			i++
+
+		} else if words1[i] > words2[j] {
+			j++
+
+		} else {
+			ans = append(ans, words1[i])
+			i++
+			j++
+		}
+	}
+	return ans
+}
+
+// findWordsByExpr returns (sorted) dictionary indices
+// of all the words matching a parsed regular expression
+func findWordsByExpr(wd *wdict.WordDictReader, expr query.Node) ([]int, error) {
+	automaton, err := query.NewAutomaton(expr)
+	if err != nil {
+		return nil, &gerrors.InvalidArgumentError{Arg: "q", Reason: err.Error()}
+	}
+	return wd.FindByAutomaton(automaton), nil
+}
+
+// findMatchingWords returns (sorted) dictionary indices of all
+// the words matching a regular expression. Literals of the
+// expression are normalized the same way as the words.
+func findMatchingWords(corp *Corpus, expr string) ([]int, error) {
+	parser := query.NewParser()
+	if err := parser.Parse(expr); err != nil {
+		return nil, &gerrors.InvalidArgumentError{Arg: "q", Reason: err.Error()}
+	}
+	return findWordsByExpr(corp.wdict, corp.normalizeExpr(parser.AST()))
+}
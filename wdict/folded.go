@@ -0,0 +1,119 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wdict
+
+import (
+	"sort"
+	"strings"
+)
+
+// folding is a normalization used to create keys
+// of FoldedDict (lowercase, no diacritics)
+var folding = Normalization{StripDiacritics: true}
+
+// FoldWord returns a folded form of a word (i.e. lowercased
+// and without diacritical marks) as used by FoldedDict
+func FoldWord(word string) string {
+	return folding.Apply(word)
+}
+
+// FoldedDict is a secondary dictionary mapping folded forms
+// of words (see FoldWord) to indices of all the words of
+// a WordDictReader with the same folded form (e.g. "praha"
+// to indices of "Praha", "praha" and "PRAHA"). This allows
+// case and diacritics insensitive search on indices storing
+// original word forms.
+type FoldedDict struct {
+	// keys contains sorted distinct folded forms
+	keys []string
+
+	// words of keys[i] are stored in
+	// words[offsets[i]:offsets[i+1]]
+	offsets []int
+
+	words []int
+}
+
+type foldedItem struct {
+	key  string
+	word int
+}
+
+// NewFoldedDict creates a folded dictionary
+// of all the words of a dictionary
+func NewFoldedDict(wd *WordDictReader) *FoldedDict {
+	items := make([]foldedItem, len(wd.data))
+	for i, w := range wd.data {
+		items[i] = foldedItem{key: FoldWord(w), word: i}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].key != items[j].key {
+			return items[i].key < items[j].key
+		}
+		return items[i].word < items[j].word
+	})
+	ans := &FoldedDict{
+		keys:    make([]string, 0, len(items)),
+		offsets: make([]int, 0, len(items)+1),
+		words:   make([]int, len(items)),
+	}
+	for i, item := range items {
+		if i == 0 || item.key != items[i-1].key {
+			ans.keys = append(ans.keys, item.key)
+			ans.offsets = append(ans.offsets, i)
+		}
+		ans.words[i] = item.word
+	}
+	ans.offsets = append(ans.offsets, len(items))
+	return ans
+}
+
+// Find returns (sorted) indices of all the words
+// with the same folded form as word
+func (f *FoldedDict) Find(word string) []int {
+	key := FoldWord(word)
+	i := sort.SearchStrings(f.keys, key)
+	if i < len(f.keys) && f.keys[i] == key {
+		return append([]int{}, f.words[f.offsets[i]:f.offsets[i+1]]...)
+	}
+	return []int{}
+}
+
+// FindByPrefix returns (sorted) indices of all the words
+// with folded forms starting with the folded prefix
+func (f *FoldedDict) FindByPrefix(prefix string) []int {
+	key := FoldWord(prefix)
+	ans := make([]int, 0, 10)
+	for i := sort.SearchStrings(f.keys, key); i < len(f.keys) && strings.HasPrefix(f.keys[i], key); i++ {
+		ans = append(ans, f.words[f.offsets[i]:f.offsets[i+1]]...)
+	}
+	sort.Ints(ans)
+	return ans
+}
+
+// Size returns number of distinct folded forms
+func (f *FoldedDict) Size() int {
+	return len(f.keys)
+}
+
+// MemSize returns an estimated size of memory
+// occupied by the dictionary
+func (f *FoldedDict) MemSize() int64 {
+	var ans int64
+	for _, k := range f.keys {
+		ans += int64(len(k)) + 16
+	}
+	return ans + int64(8*(len(f.offsets)+len(f.words)))
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wdict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFoldedDictFind(t *testing.T) {
+	d := createTestingDict(t, "Praha", "praha", "PRAHA", "Brno", "práh", "prahy")
+	f := NewFoldedDict(d)
+	assert.Equal(t, 4, f.Size())
+	words := func(indices []int) []string {
+		ans := make([]string, len(indices))
+		for i, v := range indices {
+			ans[i] = d.DecodeToken(v)
+		}
+		return ans
+	}
+	assert.Equal(t, []string{"PRAHA", "Praha", "praha"}, words(f.Find("praha")))
+	assert.Equal(t, []string{"PRAHA", "Praha", "praha"}, words(f.Find("PRÁHA")))
+	assert.Equal(t, []string{"práh"}, words(f.Find("Prah")))
+	assert.Equal(t, []string{}, words(f.Find("foo")))
+}
+
+func TestFoldedDictFindByPrefix(t *testing.T) {
+	d := createTestingDict(t, "Praha", "praha", "PRAHA", "Brno", "práh", "prahy")
+	f := NewFoldedDict(d)
+	assert.Equal(t, 5, len(f.FindByPrefix("PRA")))
+	assert.Equal(t, 3, len(f.FindByPrefix("praha")))
+	assert.Equal(t, 6, len(f.FindByPrefix("")))
+	assert.Equal(t, 0, len(f.FindByPrefix("x")))
+	indices := f.FindByPrefix("p")
+	for i := 1; i < len(indices); i++ {
+		assert.True(t, indices[i-1] < indices[i])
+	}
+}
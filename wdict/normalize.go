@@ -0,0 +1,92 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wdict
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// NormNone leaves Unicode composition of words unchanged
+	NormNone = ""
+
+	// NormNFC composes characters (canonical equivalence)
+	NormNFC = "nfc"
+
+	// NormNFKC composes characters (compatibility equivalence,
+	// e.g. ligatures are split into individual letters)
+	NormNFKC = "nfkc"
+)
+
+// Normalization specifies how words are normalized before they
+// are added to a dictionary. Query terms must be normalized the
+// same way to match the stored words. The zero value lowercases
+// words only (which is the behavior of older versions).
+type Normalization struct {
+	PreserveCase    bool   `json:"preserveCase"`
+	UnicodeForm     string `json:"unicodeForm"`
+	StripDiacritics bool   `json:"stripDiacritics"`
+}
+
+// Validate tests whether the normalization is supported
+func (n Normalization) Validate() error {
+	switch n.UnicodeForm {
+	case NormNone, NormNFC, NormNFKC:
+		return nil
+	}
+	return fmt.Errorf("unknown Unicode normalization form %s", n.UnicodeForm)
+}
+
+// IsIdentity tests whether the normalization
+// leaves all the words unchanged
+func (n Normalization) IsIdentity() bool {
+	return n.PreserveCase && n.UnicodeForm == NormNone && !n.StripDiacritics
+}
+
+// Apply normalizes a word. The Unicode form is applied first
+// as compatibility decompositions may produce uppercase letters
+// and combining marks (e.g. "㎒" is decomposed to "MHz").
+func (n Normalization) Apply(word string) string {
+	switch n.UnicodeForm {
+	case NormNFC:
+		word = norm.NFC.String(word)
+	case NormNFKC:
+		word = norm.NFKC.String(word)
+	}
+	if !n.PreserveCase {
+		word = strings.ToLower(word)
+	}
+	if n.StripDiacritics {
+		word = stripDiacritics(word)
+	}
+	return word
+}
+
+// stripDiacritics removes combining marks from a word.
+// The result is NFC composed.
+func stripDiacritics(word string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	ans, _, err := transform.String(t, word)
+	if err != nil {
+		return word
+	}
+	return ans
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wdict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizationDefault(t *testing.T) {
+	n := Normalization{}
+	assert.Equal(t, "praha", n.Apply("Praha"))
+	// decomposed characters are left decomposed
+	assert.Equal(t, "z\u030cluva", n.Apply("Z\u030cluva"))
+}
+
+func TestNormalizationNFC(t *testing.T) {
+	n := Normalization{PreserveCase: true, UnicodeForm: NormNFC}
+	assert.Equal(t, "\u017dluva", n.Apply("Z\u030cluva"))
+	assert.Equal(t, "\u017dluva", n.Apply("\u017dluva"))
+}
+
+func TestNormalizationNFKC(t *testing.T) {
+	n := Normalization{UnicodeForm: NormNFKC}
+	assert.Equal(t, "office", n.Apply("Oﬃce"))
+	n.UnicodeForm = NormNFC
+	assert.Equal(t, "oﬃce", n.Apply("Oﬃce"))
+}
+
+func TestNormalizationNFKCCaseAndDiacritics(t *testing.T) {
+	// compatibility decompositions produce uppercase letters
+	n := Normalization{UnicodeForm: NormNFKC}
+	assert.Equal(t, "mhz", n.Apply("\u3392"))
+	assert.Equal(t, "h", n.Apply("\u210c"))
+	// halfwidth katakana with a voiced sound mark
+	n.StripDiacritics = true
+	assert.Equal(t, "\u30cf", n.Apply("\uff8a\uff9e"))
+}
+
+func TestNormalizationStripDiacritics(t *testing.T) {
+	n := Normalization{StripDiacritics: true}
+	assert.Equal(t, "zlutoucky kun", n.Apply("Žluťoučký kůň"))
+	assert.Equal(t, "zlutoucky", n.Apply("Žluťoučký"))
+}
+
+func TestNormalizationValidate(t *testing.T) {
+	assert.Nil(t, Normalization{UnicodeForm: NormNFKC}.Validate())
+	assert.Error(t, Normalization{UnicodeForm: "nfd"}.Validate())
+	assert.True(t, Normalization{PreserveCase: true}.IsIdentity())
+	assert.False(t, Normalization{}.IsIdentity())
+}
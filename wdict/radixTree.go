@@ -16,6 +16,7 @@ package wdict
 
 import (
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -118,6 +119,9 @@ func commonPrefixLen(s1 string, s2 string) int {
 func writeTraversingTree(fromNode *rtNode, srch string, idx int) *RTEdge {
 	for _, edge := range fromNode.edges {
 		if srch == edge.value {
+			if edge.idx == -1 { // the edge has been created by a split of other words
+				edge.idx = idx
+			}
 			return edge
 
 		} else if strings.HasPrefix(srch, edge.value) {
@@ -210,6 +214,50 @@ func (rt *RadixTree) FindIndicesByPrefix(prefix string) []int {
 	return []int{}
 }
 
+// Automaton is a deterministic finite automaton over
+// characters (e.g. a compiled regular expression). States
+// are identified by non-negative numbers, -1 means a state
+// from which no word can be matched.
+type Automaton interface {
+	Start() int
+	Step(state int, r rune) int
+	IsAccepting(state int) bool
+}
+
+// collectMatching traverses the tree along with an automaton
+// and collects indices of words accepted by the automaton.
+// As edges may split multi-byte characters, bytes of a character
+// not read yet by the automaton are passed in pending.
+func collectMatching(fromNode *rtNode, a Automaton, state int, pending []byte, ans []int) []int {
+	for _, edge := range fromNode.edges {
+		edgeState := state
+		edgePending := append([]byte{}, pending...)
+		for i := 0; i < len(edge.value) && edgeState > -1; i++ {
+			edgePending = append(edgePending, edge.value[i])
+			if utf8.FullRune(edgePending) {
+				r, _ := utf8.DecodeRune(edgePending)
+				edgeState = a.Step(edgeState, r)
+				edgePending = edgePending[:0]
+			}
+		}
+		if edgeState == -1 {
+			continue
+		}
+		if edge.idx > -1 && len(edgePending) == 0 && a.IsAccepting(edgeState) {
+			ans = append(ans, edge.idx)
+		}
+		ans = collectMatching(edge.node, a, edgeState, edgePending, ans)
+	}
+	return ans
+}
+
+// FindIndicesByAutomaton finds indices of all the words
+// accepted by an automaton. Subtrees which cannot contain
+// such words are not traversed.
+func (rt *RadixTree) FindIndicesByAutomaton(a Automaton) []int {
+	return collectMatching(rt.root, a, a.Start(), []byte{}, make([]int, 0, 10))
+}
+
 // Add adds a word and its dictionary index to the
 // tree.
 func (rt *RadixTree) Add(word string, idx int) *RTEdge {
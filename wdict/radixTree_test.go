@@ -15,8 +15,11 @@
 package wdict
 
 import (
-	"github.com/stretchr/testify/assert"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestRTNodeAddEdge(t *testing.T) {
@@ -206,3 +209,58 @@ func TestFindIndicesByPrefixNonExisting(t *testing.T) {
 	assert.Equal(t, 13, ans[2])
 	assert.Equal(t, 3, len(ans))
 }
+
+func TestAddWordOfSplitEdge(t *testing.T) {
+	rt := NewRadixTree()
+	rt.Add("foobar", 0)
+	rt.Add("foobaz", 1)
+	rt.Add("fooba", 2)
+	assert.Equal(t, 2, rt.Find("fooba"))
+	assert.Equal(t, []int{2, 0, 1}, rt.FindIndicesByPrefix("foob"))
+}
+
+// setAutomaton accepts words from a set; each state
+// represents a prefix of some of the words
+type setAutomaton struct {
+	words    []string
+	prefixes []string
+}
+
+func (a *setAutomaton) Start() int {
+	return 0
+}
+
+func (a *setAutomaton) Step(state int, r rune) int {
+	prefix := a.prefixes[state] + string(r)
+	for _, w := range a.words {
+		if strings.HasPrefix(w, prefix) {
+			a.prefixes = append(a.prefixes, prefix)
+			return len(a.prefixes) - 1
+		}
+	}
+	return -1
+}
+
+func (a *setAutomaton) IsAccepting(state int) bool {
+	for _, w := range a.words {
+		if w == a.prefixes[state] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFindIndicesByAutomaton(t *testing.T) {
+	rt := NewRadixTree()
+	// 'č' and 'ć' share the first byte so the tree splits them
+	for i, w := range []string{"čaj", "ćap", "čas", "ča", "sun", "sunflower"} {
+		rt.Add(w, i)
+	}
+	a := &setAutomaton{words: []string{"ćap", "ča", "sunflower", "foo"}, prefixes: []string{""}}
+	ans := rt.FindIndicesByAutomaton(a)
+	sort.Ints(ans)
+	assert.Equal(t, []int{1, 3, 5}, ans)
+
+	a = &setAutomaton{words: []string{"x"}, prefixes: []string{""}}
+	assert.Equal(t, []int{}, rt.FindIndicesByAutomaton(a))
+}
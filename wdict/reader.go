@@ -19,7 +19,10 @@ import (
 	"encoding/binary"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+
+	"github.com/tomachalek/gloomy/gerrors"
 )
 
 func loadWords(srcPath string) (*WordDictReader, error) {
@@ -27,18 +30,26 @@ func loadWords(srcPath string) (*WordDictReader, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	fr := bufio.NewScanner(f)
 	fr.Scan() // size
 	size, err := strconv.ParseInt(fr.Text(), 10, 64)
 	if err != nil {
-		panic(err)
+		return nil, gerrors.NewCorruptDataError(srcPath, "invalid dictionary size: %s", err)
 	}
 	words := make([]string, size)
 	tree := NewRadixTree()
-	for i := 0; fr.Scan(); i++ {
+	i := 0
+	for ; fr.Scan(); i++ {
+		if i >= len(words) {
+			return nil, gerrors.NewCorruptDataError(srcPath, "more than %d words found", size)
+		}
 		words[i] = fr.Text()
 		tree.Add(fr.Text(), i)
 	}
+	if i < len(words) {
+		return nil, gerrors.NewCorruptDataError(srcPath, "%d words declared, %d found", size, i)
+	}
 	ans := &WordDictReader{data: words, tree: tree}
 	return ans, nil
 }
@@ -83,30 +94,19 @@ func LoadWordDict(dataPath string) (*WordDictReader, error) {
 	return loadWords(filepath.Join(dataPath, "words.dict"))
 }
 
+// LoadNamedWordDict loads a dictionary saved
+// by WordDictWriter.FinalizeAs
+func LoadNamedWordDict(dataPath string, name string) (*WordDictReader, error) {
+	return loadWords(filepath.Join(dataPath, name+".dict"))
+}
+
 // Find searches (in O(log(n) time) for an index value
 // of a specified word.
 // In case the word is not found, -1 is returned.
 func (w *WordDictReader) Find(word string) int {
-	left := 0
-	right := len(w.data) - 1
-	pivot := len(w.data) / 2
-	for right-left > 1 && w.data[pivot] != word {
-		if w.data[left] <= word && word <= w.data[pivot] {
-			tmp := pivot
-			pivot = (left + pivot) / 2
-			right = tmp
-
-		} else if w.data[pivot] < word && word <= w.data[right] {
-			tmp := pivot
-			pivot = (pivot + right) / 2
-			left = tmp
-
-		} else {
-			break
-		}
-	}
-	if word == w.data[pivot] {
-		return pivot
+	i := sort.SearchStrings(w.data, word)
+	if i < len(w.data) && w.data[i] == word {
+		return i
 	}
 	return -1
 }
@@ -115,6 +115,14 @@ func (w *WordDictReader) FindByPrefix(prefix string) []int {
 	return w.tree.FindIndicesByPrefix(prefix)
 }
 
+// FindByAutomaton finds (sorted) indices of all the words
+// accepted by an automaton
+func (w *WordDictReader) FindByAutomaton(a Automaton) []int {
+	ans := w.tree.FindIndicesByAutomaton(a)
+	sort.Ints(ans)
+	return ans
+}
+
 // DecodeNgram finds a string representation of a word array (= n-gram).
 func (w *WordDictReader) DecodeNgram(ngram []int) []string {
 	ans := make([]string, len(ngram))
@@ -124,6 +132,11 @@ func (w *WordDictReader) DecodeNgram(ngram []int) []string {
 	return ans
 }
 
+// Size returns number of words in the dictionary
+func (w *WordDictReader) Size() int {
+	return len(w.data)
+}
+
 func (w *WordDictReader) DecodeToken(widx int) string {
 	return w.data[widx]
 }
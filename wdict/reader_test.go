@@ -0,0 +1,50 @@
+// Copyright 2017 Tomas Machalek <tomas.machalek@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wdict
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestingDict(t *testing.T, words ...string) *WordDictReader {
+	dirPath, err := ioutil.TempDir("", "gloomy-test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dirPath)
+	w := NewWordDictWriter()
+	for _, v := range words {
+		w.AddToken(v)
+	}
+	w.FinalizeAs(dirPath, "test")
+	ans, err := LoadNamedWordDict(dirPath, "test")
+	assert.Nil(t, err)
+	return ans
+}
+
+func TestFind(t *testing.T) {
+	for _, words := range [][]string{{"a"}, {"b", "a"}, {"c", "a", "b"}, {"d", "", "b", "c", "a"}} {
+		d := createTestingDict(t, words...)
+		for _, v := range words {
+			i := d.Find(v)
+			assert.True(t, i >= 0, v)
+			assert.Equal(t, v, d.DecodeToken(i))
+		}
+		assert.Equal(t, -1, d.Find("x"))
+		assert.Equal(t, -1, d.Find("aa"))
+	}
+}
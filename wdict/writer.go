@@ -56,11 +56,22 @@ func (w *WordDictWriter) GetTokenIndex(token string) int {
 	return -1
 }
 
+// Size returns number of words in the dictionary
+func (w *WordDictWriter) Size() int {
+	return len(w.index)
+}
+
 // Finalize sorts the dictionary, attaches final
 // indices (from 0 to N) to the tokens and saves the data.
 // Please note that this means that before Finalize is called
 // the indices are only temporary and cannot be used.
 func (w *WordDictWriter) Finalize(dstPath string) {
+	w.FinalizeAs(dstPath, "words")
+}
+
+// FinalizeAs is a variant of Finalize saving the data
+// to a file with a specified name (<name>.dict)
+func (w *WordDictWriter) FinalizeAs(dstPath string, name string) {
 	tmp := make([]string, len(w.index))
 	i := 0
 	for k := range w.index {
@@ -73,11 +84,11 @@ func (w *WordDictWriter) Finalize(dstPath string) {
 		w.index[v] = i
 		i++
 	}
-	w.save(tmp, filepath.Join(dstPath, "words.dict"))
+	w.save(tmp, filepath.Join(dstPath, name+".dict"))
 }
 
 func (w *WordDictWriter) save(data []string, dstPath string) error {
-	f, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY, 0664)
+	f, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0664)
 	defer f.Close()
 	if err != nil {
 		return err